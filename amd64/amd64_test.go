@@ -0,0 +1,156 @@
+package amd64
+
+import (
+	"bytes"
+	"debug/elf"
+	"encoding/hex"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"testing"
+
+	"tinycompiler/tiny/tinytest"
+)
+
+// TestEncoding checks instructions against the encodings an assembler
+// gives them, including the REX and SIB cases
+func TestEncoding(t *testing.T) {
+	tests := []struct {
+		name string
+		emit func(a *assembler)
+		want string
+	}{
+		{"mov rax, rcx", func(a *assembler) { a.movRR(rax, rcx) }, "4889c8"},
+		{"mov r15, rsp", func(a *assembler) { a.movRR(r15, rsp) }, "4989e7"},
+		{"mov rax, 1", func(a *assembler) { a.movRI(rax, 1) }, "48c7c001000000"},
+		{"mov rax, -1", func(a *assembler) { a.movRI(rax, -1) }, "48c7c0ffffffff"},
+		{"mov rcx, 1<<32", func(a *assembler) { a.movRI(rcx, 1<<32) }, "48b90000000001000000"},
+		{"mov rax, [r15+8]", func(a *assembler) { a.load(rax, r15, 8) }, "498b8708000000"},
+		{"mov rcx, [rsp+16]", func(a *assembler) { a.load(rcx, rsp, 16) }, "488b8c2410000000"},
+		{"mov [r15+0], rax", func(a *assembler) { a.store(r15, 0, rax) }, "49898700000000"},
+		{"add rax, rcx", func(a *assembler) { a.alu(aluAdd, rax, rcx) }, "4801c8"},
+		{"sub rsp, 8", func(a *assembler) { a.subI(rsp, 8) }, "4881ec08000000"},
+		{"imul rax, rcx", func(a *assembler) { a.imul(rax, rcx) }, "480fafc1"},
+		{"neg rax", func(a *assembler) { a.neg(rax) }, "48f7d8"},
+		{"cqo", func(a *assembler) { a.cqo() }, "4899"},
+		{"idiv rcx", func(a *assembler) { a.idiv(rcx) }, "48f7f9"},
+		{"push r12", func(a *assembler) { a.push(r12) }, "4154"},
+		{"pop rax", func(a *assembler) { a.pop(rax) }, "58"},
+		{"syscall", func(a *assembler) { a.syscall() }, "0f05"},
+		{"ret", func(a *assembler) { a.ret() }, "c3"},
+	}
+	for _, tt := range tests {
+		a := newAssembler()
+		tt.emit(a)
+		if got := hex.EncodeToString(a.code); got != tt.want {
+			t.Errorf("%s: got %s, want %s", tt.name, got, tt.want)
+		}
+	}
+}
+
+// TestLink checks that jumps are resolved relative to the end of the
+// instruction, in both directions
+func TestLink(t *testing.T) {
+	a := newAssembler()
+	a.label("top")
+	a.jmp("bottom")
+	a.jcc(condE, "top")
+	a.label("bottom")
+	if err := a.link(); err != nil {
+		t.Fatal(err)
+	}
+	if got, want := hex.EncodeToString(a.code), "e906000000"+"0f84f5ffffff"; got != want {
+		t.Errorf("got %s, want %s", got, want)
+	}
+
+	a = newAssembler()
+	a.call("missing")
+	if err := a.link(); err == nil {
+		t.Error("undefined label accepted")
+	}
+}
+
+// TestBuildHeader checks the ELF header and segments of an executable
+func TestBuildHeader(t *testing.T) {
+	var b bytes.Buffer
+	if err := Build(&b, tinytest.Parse(t, "read x; write x * 2")); err != nil {
+		t.Fatal(err)
+	}
+	f, err := elf.NewFile(bytes.NewReader(b.Bytes()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if f.Class != elf.ELFCLASS64 || f.Data != elf.ELFDATA2LSB || f.Machine != elf.EM_X86_64 || f.Type != elf.ET_EXEC {
+		t.Errorf("header %+v", f.FileHeader)
+	}
+	if f.Entry != textAddr+headerSize {
+		t.Errorf("entry %#x, want %#x", f.Entry, textAddr+headerSize)
+	}
+	if len(f.Progs) != 2 {
+		t.Fatalf("%d program headers, want 2", len(f.Progs))
+	}
+	text, data := f.Progs[0], f.Progs[1]
+	if text.Type != elf.PT_LOAD || text.Flags != elf.PF_R|elf.PF_X || text.Filesz != uint64(b.Len()) {
+		t.Errorf("text segment %+v, file size %d", text.ProgHeader, b.Len())
+	}
+	if data.Type != elf.PT_LOAD || data.Flags != elf.PF_R|elf.PF_W || data.Filesz != 0 || data.Memsz == 0 {
+		t.Errorf("data segment %+v", data.ProgHeader)
+	}
+	if data.Vaddr%pageSize != 0 || data.Vaddr < text.Vaddr+text.Memsz {
+		t.Errorf("data at %#x overlaps the text or is not page aligned", data.Vaddr)
+	}
+}
+
+// TestBuildRun checks how executables report runtime errors, which needs
+// Linux on amd64. The shared programs of package tinytest check the rest.
+func TestBuildRun(t *testing.T) {
+	if runtime.GOOS != "linux" || runtime.GOARCH != "amd64" {
+		t.Skip("executables only run on linux/amd64")
+	}
+	tests := []struct {
+		name   string
+		src    string
+		input  string
+		want   string
+		stderr string // Runtime error message, if the program fails
+	}{
+		{"division by zero", "write 1;\nwrite 1 / 0", "", "1\n", "runtime error: division by zero at line 2\n"},
+		{"bad input", "read x", "abc", "", "runtime error: "},
+	}
+	dir := t.TempDir()
+	for i, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var b bytes.Buffer
+			if err := Build(&b, tinytest.Parse(t, tt.src)); err != nil {
+				t.Fatal(err)
+			}
+			path := filepath.Join(dir, "prog"+string(rune('a'+i)))
+			if err := os.WriteFile(path, b.Bytes(), 0o755); err != nil {
+				t.Fatal(err)
+			}
+			cmd := exec.Command(path)
+			cmd.Stdin = strings.NewReader(tt.input)
+			var stdout, stderr bytes.Buffer
+			cmd.Stdout, cmd.Stderr = &stdout, &stderr
+			err := cmd.Run()
+
+			if stdout.String() != tt.want {
+				t.Errorf("wrote %q, want %q", stdout.String(), tt.want)
+			}
+			if tt.stderr == "" {
+				if err != nil {
+					t.Errorf("%v: %s", err, stderr.String())
+				}
+				return
+			}
+			if exit, ok := err.(*exec.ExitError); !ok || exit.ExitCode() != 1 {
+				t.Errorf("exit status %v, want 1", err)
+			}
+			if !strings.HasPrefix(stderr.String(), tt.stderr) {
+				t.Errorf("stderr %q, want %q", stderr.String(), tt.stderr)
+			}
+		})
+	}
+}
@@ -0,0 +1,247 @@
+// Package amd64 compiles TINY programs to standalone static Linux x86-64
+// executables. It encodes the machine code and writes the ELF file itself,
+// so no assembler or linker is needed.
+package amd64
+
+import (
+	"encoding/binary"
+	"fmt"
+)
+
+// Register numbers as used in instruction encodings
+const (
+	rax = iota
+	rcx
+	rdx
+	rbx
+	rsp
+	rbp
+	rsi
+	rdi
+	r8
+	r9
+	r10
+	r11
+	r12
+	r13
+	r14
+	r15
+)
+
+// Condition codes for jcc and setcc
+const (
+	condB  = 0x2 // Below (unsigned)
+	condA  = 0x7 // Above (unsigned)
+	condE  = 0x4
+	condNE = 0x5
+	condL  = 0xC
+	condGE = 0xD
+	condLE = 0xE
+	condG  = 0xF
+)
+
+// ALU opcodes for the "op r/m64, r64" forms
+const (
+	aluAdd  = 0x01
+	aluSub  = 0x29
+	aluCmp  = 0x39
+	aluXor  = 0x31
+	aluTest = 0x85
+)
+
+// fixup is a 32-bit displacement to be filled in with the distance from the
+// end of the instruction to a label
+type fixup struct {
+	at    int // Offset of the displacement in the code
+	label string
+}
+
+// assembler encodes the small subset of x86-64 the code generator needs
+type assembler struct {
+	code   []byte
+	labels map[string]int
+	fixups []fixup
+}
+
+func newAssembler() *assembler {
+	return &assembler{labels: make(map[string]int)}
+}
+
+func (a *assembler) emit(b ...byte) {
+	a.code = append(a.code, b...)
+}
+
+func (a *assembler) emit32(v int32) {
+	a.code = binary.LittleEndian.AppendUint32(a.code, uint32(v))
+}
+
+// label defines name at the current position
+func (a *assembler) label(name string) {
+	a.labels[name] = len(a.code)
+}
+
+// ref emits a displacement to name, resolved by link
+func (a *assembler) ref(name string) {
+	a.fixups = append(a.fixups, fixup{at: len(a.code), label: name})
+	a.emit32(0)
+}
+
+// link resolves every label reference
+func (a *assembler) link() error {
+	for _, f := range a.fixups {
+		target, ok := a.labels[f.label]
+		if !ok {
+			return fmt.Errorf("undefined label %s", f.label)
+		}
+		binary.LittleEndian.PutUint32(a.code[f.at:], uint32(int32(target-(f.at+4))))
+	}
+	return nil
+}
+
+// rexW returns the REX prefix of a 64-bit instruction with the given
+// ModRM reg and rm fields
+func rexW(reg, rm int) byte {
+	return 0x48 | byte(reg>>3)<<2 | byte(rm>>3)
+}
+
+func modrm(mod, reg, rm int) byte {
+	return byte(mod<<6 | (reg&7)<<3 | rm&7)
+}
+
+// mem emits the ModRM byte (and SIB if needed) of [base+disp32]
+func (a *assembler) mem(reg, base int, disp int32) {
+	a.emit(modrm(2, reg, base))
+	if base&7 == rsp {
+		a.emit(0x24)
+	}
+	a.emit32(disp)
+}
+
+// movRR: mov dst, src
+func (a *assembler) movRR(dst, src int) {
+	a.emit(rexW(src, dst), 0x89, modrm(3, src, dst))
+}
+
+// movRI: mov dst, imm
+func (a *assembler) movRI(dst int, imm int64) {
+	if imm == int64(int32(imm)) {
+		a.emit(rexW(0, dst), 0xC7, modrm(3, 0, dst))
+		a.emit32(int32(imm))
+		return
+	}
+	a.emit(rexW(0, dst), 0xB8+byte(dst&7))
+	a.code = binary.LittleEndian.AppendUint64(a.code, uint64(imm))
+}
+
+// load: mov dst, [base+disp]
+func (a *assembler) load(dst, base int, disp int32) {
+	a.emit(rexW(dst, base), 0x8B)
+	a.mem(dst, base, disp)
+}
+
+// store: mov [base+disp], src
+func (a *assembler) store(base int, disp int32, src int) {
+	a.emit(rexW(src, base), 0x89)
+	a.mem(src, base, disp)
+}
+
+// storeByte: mov byte [base+disp], src (src must be al, cl, dl or bl)
+func (a *assembler) storeByte(base int, disp int32, src int) {
+	a.emit(0x40|byte(base>>3), 0x88)
+	a.mem(src, base, disp)
+}
+
+// loadByte: movzx dst, byte [base+disp]
+func (a *assembler) loadByte(dst, base int, disp int32) {
+	a.emit(rexW(dst, base), 0x0F, 0xB6)
+	a.mem(dst, base, disp)
+}
+
+// lea: lea dst, [base+disp]
+func (a *assembler) lea(dst, base int, disp int32) {
+	a.emit(rexW(dst, base), 0x8D)
+	a.mem(dst, base, disp)
+}
+
+// leaLabel: lea dst, [rip+label]
+func (a *assembler) leaLabel(dst int, name string) {
+	a.emit(rexW(dst, 0), 0x8D, modrm(0, dst, rbp))
+	a.ref(name)
+}
+
+// alu: op dst, src for one of the alu* opcodes
+func (a *assembler) alu(op byte, dst, src int) {
+	a.emit(rexW(src, dst), op, modrm(3, src, dst))
+}
+
+// aluI: op dst, imm32 where ext selects add (0), sub (5) or cmp (7)
+func (a *assembler) aluI(ext, dst int, imm int32) {
+	a.emit(rexW(0, dst), 0x81, modrm(3, ext, dst))
+	a.emit32(imm)
+}
+
+func (a *assembler) addI(dst int, imm int32) { a.aluI(0, dst, imm) }
+func (a *assembler) subI(dst int, imm int32) { a.aluI(5, dst, imm) }
+func (a *assembler) cmpI(dst int, imm int32) { a.aluI(7, dst, imm) }
+
+// imul: imul dst, src
+func (a *assembler) imul(dst, src int) {
+	a.emit(rexW(dst, src), 0x0F, 0xAF, modrm(3, dst, src))
+}
+
+// unary emits the F7 group: neg (3), div (6) and idiv (7)
+func (a *assembler) unary(ext, r int) {
+	a.emit(rexW(0, r), 0xF7, modrm(3, ext, r))
+}
+
+func (a *assembler) neg(r int)  { a.unary(3, r) }
+func (a *assembler) div(r int)  { a.unary(6, r) }
+func (a *assembler) idiv(r int) { a.unary(7, r) }
+
+// cqo sign-extends rax into rdx:rax
+func (a *assembler) cqo() {
+	a.emit(0x48, 0x99)
+}
+
+// setcc sets rax to 1 if the condition holds, else 0
+func (a *assembler) setcc(cond byte) {
+	a.emit(0x0F, 0x90+cond, modrm(3, 0, rax)) // setcc al
+	a.emit(0x0F, 0xB6, modrm(3, rax, rax))    // movzx eax, al
+}
+
+func (a *assembler) push(r int) {
+	if r >= r8 {
+		a.emit(0x41)
+	}
+	a.emit(0x50 + byte(r&7))
+}
+
+func (a *assembler) pop(r int) {
+	if r >= r8 {
+		a.emit(0x41)
+	}
+	a.emit(0x58 + byte(r&7))
+}
+
+func (a *assembler) jmp(name string) {
+	a.emit(0xE9)
+	a.ref(name)
+}
+
+func (a *assembler) jcc(cond byte, name string) {
+	a.emit(0x0F, 0x80+cond)
+	a.ref(name)
+}
+
+func (a *assembler) call(name string) {
+	a.emit(0xE8)
+	a.ref(name)
+}
+
+func (a *assembler) ret() {
+	a.emit(0xC3)
+}
+
+func (a *assembler) syscall() {
+	a.emit(0x0F, 0x05)
+}
@@ -0,0 +1,269 @@
+package amd64
+
+import (
+	"fmt"
+
+	"tinycompiler/tiny"
+)
+
+// generator translates a syntax tree to machine code. Expressions leave
+// their value in rax; the left operand of a binary operator waits on the
+// stack while the right one is computed. r15 holds the address of the data
+// segment for the whole run.
+type generator struct {
+	*assembler
+	table  *tiny.SymbolTable
+	labels int
+	err    error
+}
+
+// compile generates the code of the program followed by the runtime, and
+// returns it with the size of the data segment it needs
+func compile(tree *tiny.TreeNode, dataAddr int64) ([]byte, int32, error) {
+	table, _ := tiny.BuildSymtab(tree)
+	layout := newDataLayout(table.Len())
+
+	g := &generator{assembler: newAssembler(), table: table}
+	g.movRI(r15, dataAddr)
+	g.stmtSeq(tree)
+	g.movRI(rdi, 0)
+	g.movRI(rax, sysExit)
+	g.syscall()
+	if g.err != nil {
+		return nil, 0, g.err
+	}
+
+	emitRuntime(g.assembler, layout)
+	if err := g.link(); err != nil {
+		return nil, 0, err
+	}
+	return g.code, layout.size, nil
+}
+
+// newLabel returns a fresh label name
+func (g *generator) newLabel() string {
+	g.labels++
+	return fmt.Sprintf("L%d", g.labels)
+}
+
+// slot returns the data segment offset of a variable
+func (g *generator) slot(name string) int32 {
+	return int32(8 * g.table.Lookup(name).Location)
+}
+
+func (g *generator) fail(node *tiny.TreeNode) {
+	if g.err == nil {
+		g.err = fmt.Errorf("line %d: cannot compile a syntax error", node.LineNum)
+	}
+}
+
+func (g *generator) stmtSeq(node *tiny.TreeNode) {
+	for ; node != nil; node = node.Sibling {
+		g.stmt(node)
+	}
+}
+
+func (g *generator) stmt(node *tiny.TreeNode) {
+	if node.NodeKind != tiny.StmtK {
+		g.fail(node)
+		return
+	}
+
+	switch node.StmtKind {
+	case tiny.IfK:
+		elseLabel, endLabel := g.newLabel(), g.newLabel()
+		g.exp(node.Children[0])
+		g.alu(aluTest, rax, rax)
+		g.jcc(condE, elseLabel)
+		g.stmtSeq(node.Children[1])
+		g.jmp(endLabel)
+		g.label(elseLabel)
+		g.stmtSeq(node.Children[2])
+		g.label(endLabel)
+
+	case tiny.RepeatK:
+		top := g.newLabel()
+		g.label(top)
+		g.stmtSeq(node.Children[0])
+		g.exp(node.Children[1])
+		g.alu(aluTest, rax, rax)
+		g.jcc(condE, top)
+
+	case tiny.WhileK:
+		top, end := g.newLabel(), g.newLabel()
+		g.label(top)
+		g.exp(node.Children[0])
+		g.alu(aluTest, rax, rax)
+		g.jcc(condE, end)
+		g.stmtSeq(node.Children[1])
+		g.jmp(top)
+		g.label(end)
+
+	case tiny.ForK:
+		top, end := g.newLabel(), g.newLabel()
+		var exit, update byte = condG, aluAdd
+		if node.Op == "downto" {
+			exit, update = condL, aluSub
+		}
+		g.exp(node.Children[0])
+		g.store(r15, g.slot(node.Name), rax)
+		// The limit and step are evaluated once and wait on the stack until
+		// the loop ends. The body leaves the stack as it found it, so they
+		// stay at the same offsets from rsp.
+		var limit int32
+		g.exp(node.Children[1])
+		g.push(rax)
+		if node.Children[2] != nil {
+			g.exp(node.Children[2])
+			g.push(rax)
+			limit = 8
+		}
+		g.label(top)
+		g.load(rax, r15, g.slot(node.Name))
+		g.load(rcx, rsp, limit)
+		g.alu(aluCmp, rax, rcx)
+		g.jcc(exit, end)
+		g.stmtSeq(node.Children[3])
+		if node.Children[2] != nil {
+			g.load(rcx, rsp, 0)
+		} else {
+			g.movRI(rcx, 1)
+		}
+		g.load(rax, r15, g.slot(node.Name))
+		g.alu(update, rax, rcx)
+		g.store(r15, g.slot(node.Name), rax)
+		g.jmp(top)
+		g.label(end)
+		g.addI(rsp, limit+8)
+
+	case tiny.AssignK:
+		g.exp(node.Children[0])
+		g.store(r15, g.slot(node.Name), rax)
+
+	case tiny.ReadK:
+		g.call("read_int")
+		g.store(r15, g.slot(node.Name), rax)
+
+	case tiny.WriteK:
+		g.exp(node.Children[0])
+		g.movRI(rdi, 1)
+		g.call("write_int")
+	}
+}
+
+func (g *generator) exp(node *tiny.TreeNode) {
+	if node == nil || node.NodeKind != tiny.ExpK {
+		g.fail(node)
+		return
+	}
+
+	switch node.ExpKind {
+	case tiny.ConstK:
+		g.movRI(rax, int64(node.Value))
+
+	case tiny.IdK:
+		g.load(rax, r15, g.slot(node.Name))
+
+	case tiny.UnaryK:
+		g.exp(node.Children[0])
+		switch node.Op {
+		case "not":
+			g.alu(aluTest, rax, rax)
+			g.setcc(condE)
+		case "-":
+			g.neg(rax)
+		case "+":
+		default:
+			if g.err == nil {
+				g.err = fmt.Errorf("line %d: unknown operator %s", node.LineNum, node.Op)
+			}
+		}
+
+	case tiny.OpK:
+		if node.Op == "and" || node.Op == "or" {
+			g.genLogical(node)
+			return
+		}
+		g.exp(node.Children[0])
+		g.push(rax)
+		g.exp(node.Children[1])
+		g.movRR(rcx, rax)
+		g.pop(rax)
+
+		switch node.Op {
+		case "+":
+			g.alu(aluAdd, rax, rcx)
+		case "-":
+			g.alu(aluSub, rax, rcx)
+		case "*":
+			g.imul(rax, rcx)
+		case "/":
+			g.genDiv(node)
+		case "<":
+			g.alu(aluCmp, rax, rcx)
+			g.setcc(condL)
+		case ">":
+			g.alu(aluCmp, rax, rcx)
+			g.setcc(condG)
+		case "<=":
+			g.alu(aluCmp, rax, rcx)
+			g.setcc(condLE)
+		case ">=":
+			g.alu(aluCmp, rax, rcx)
+			g.setcc(condGE)
+		case "=":
+			g.alu(aluCmp, rax, rcx)
+			g.setcc(condE)
+		case "<>":
+			g.alu(aluCmp, rax, rcx)
+			g.setcc(condNE)
+		default:
+			if g.err == nil {
+				g.err = fmt.Errorf("line %d: unknown operator %s", node.LineNum, node.Op)
+			}
+		}
+	}
+}
+
+// genLogical sets rax to 1 if the and or or at node holds, else 0. The
+// right operand is skipped when the left one decides the result.
+func (g *generator) genLogical(node *tiny.TreeNode) {
+	short, done := g.newLabel(), g.newLabel()
+	g.exp(node.Children[0])
+	g.alu(aluTest, rax, rax)
+	if node.Op == "and" {
+		g.jcc(condE, short)
+	} else {
+		g.jcc(condNE, short)
+	}
+	g.exp(node.Children[1])
+	g.alu(aluTest, rax, rax)
+	g.setcc(condNE)
+	g.jmp(done)
+	g.label(short)
+	if node.Op == "and" {
+		g.movRI(rax, 0)
+	} else {
+		g.movRI(rax, 1)
+	}
+	g.label(done)
+}
+
+// genDiv divides rax by rcx, reporting division by zero with the source
+// line. Dividing by -1 is a negation, which unlike idiv cannot trap.
+func (g *generator) genDiv(node *tiny.TreeNode) {
+	ok, byMinusOne, done := g.newLabel(), g.newLabel(), g.newLabel()
+	g.alu(aluTest, rcx, rcx)
+	g.jcc(condNE, ok)
+	g.movRI(rax, int64(node.LineNum))
+	g.jmp("div_by_zero")
+	g.label(ok)
+	g.cmpI(rcx, -1)
+	g.jcc(condE, byMinusOne)
+	g.cqo()
+	g.idiv(rcx)
+	g.jmp(done)
+	g.label(byMinusOne)
+	g.neg(rax)
+	g.label(done)
+}
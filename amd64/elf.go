@@ -0,0 +1,87 @@
+package amd64
+
+import (
+	"bytes"
+	"debug/elf"
+	"encoding/binary"
+	"io"
+
+	"tinycompiler/tiny"
+)
+
+// Addresses of the program's segments
+const (
+	textAddr = 0x400000
+	pageSize = 0x1000
+)
+
+// headerSize is the size of the ELF header and the two program headers
+// that precede the code in the file
+const headerSize = 64 + 2*56
+
+// Build compiles the program rooted at tree to a static Linux amd64 ELF
+// executable and writes it to w. The file has a read-only executable text
+// segment holding the code and a zero-filled data segment for variables.
+func Build(w io.Writer, tree *tiny.TreeNode) error {
+	// The data segment starts on the first page after the text, whose size
+	// depends on the code; the code in turn embeds the data address. Code
+	// size does not depend on the address as long as it fits in 32 bits,
+	// so compile once to measure and once more with the final address.
+	code, _, err := compile(tree, 0)
+	if err != nil {
+		return err
+	}
+	textSize := int64(headerSize + len(code))
+	dataAddr := (textAddr + textSize + pageSize - 1) &^ (pageSize - 1)
+	code, dataSize, err := compile(tree, dataAddr)
+	if err != nil {
+		return err
+	}
+
+	var buf bytes.Buffer
+	header := elf.Header64{
+		Type:      uint16(elf.ET_EXEC),
+		Machine:   uint16(elf.EM_X86_64),
+		Version:   uint32(elf.EV_CURRENT),
+		Entry:     textAddr + headerSize,
+		Phoff:     64,
+		Ehsize:    64,
+		Phentsize: 56,
+		Phnum:     2,
+	}
+	copy(header.Ident[:], elf.ELFMAG)
+	header.Ident[elf.EI_CLASS] = byte(elf.ELFCLASS64)
+	header.Ident[elf.EI_DATA] = byte(elf.ELFDATA2LSB)
+	header.Ident[elf.EI_VERSION] = byte(elf.EV_CURRENT)
+	header.Ident[elf.EI_OSABI] = byte(elf.ELFOSABI_NONE)
+
+	text := elf.Prog64{
+		Type:   uint32(elf.PT_LOAD),
+		Flags:  uint32(elf.PF_R | elf.PF_X),
+		Off:    0,
+		Vaddr:  textAddr,
+		Paddr:  textAddr,
+		Filesz: uint64(textSize),
+		Memsz:  uint64(textSize),
+		Align:  pageSize,
+	}
+	data := elf.Prog64{
+		Type:   uint32(elf.PT_LOAD),
+		Flags:  uint32(elf.PF_R | elf.PF_W),
+		Off:    0,
+		Vaddr:  uint64(dataAddr),
+		Paddr:  uint64(dataAddr),
+		Filesz: 0,
+		Memsz:  uint64(dataSize),
+		Align:  pageSize,
+	}
+
+	for _, v := range []any{header, text, data} {
+		if err := binary.Write(&buf, binary.LittleEndian, v); err != nil {
+			return err
+		}
+	}
+	buf.Write(code)
+	_, err = w.Write(buf.Bytes())
+	return err
+}
@@ -0,0 +1,194 @@
+package amd64
+
+// Linux system call numbers
+const (
+	sysRead  = 0
+	sysWrite = 1
+	sysExit  = 60
+)
+
+// Layout of the data segment, addressed through r15. The variables come
+// first, at 8 bytes each; the runtime's buffers follow them.
+const (
+	outBufSize = 32   // Enough for a 64-bit integer, its sign and a newline
+	inBufSize  = 4096 // Input is read in blocks of this size
+)
+
+// dataLayout gives the offsets of the runtime's data after n variables
+type dataLayout struct {
+	outBuf int32 // Buffer in which writeInt formats numbers
+	inPos  int32 // Index of the next unread byte in inBuf
+	inLen  int32 // Number of valid bytes in inBuf
+	inBuf  int32 // Input buffer
+	size   int32 // Total size of the data segment
+}
+
+func newDataLayout(nvars int) dataLayout {
+	var l dataLayout
+	l.outBuf = int32(8 * nvars)
+	l.inPos = l.outBuf + outBufSize
+	l.inLen = l.inPos + 8
+	l.inBuf = l.inLen + 8
+	l.size = l.inBuf + inBufSize
+	return l
+}
+
+// Runtime messages, placed in the text segment
+var runtimeMessages = []struct {
+	label string
+	text  string
+}{
+	{"msg_divzero", "runtime error: division by zero at line "},
+	{"msg_badinput", "runtime error: read expected an integer\n"},
+}
+
+// emitRuntime emits the read and write routines and the error handlers
+// used by generated code. The routines clobber every register except r15
+// and the stack, which generated code does not rely on across calls.
+func emitRuntime(a *assembler, l dataLayout) {
+	// writeInt prints rax in decimal followed by a newline on file
+	// descriptor rdi. Digits are produced backwards from the end of outBuf.
+	a.label("write_int")
+	a.movRR(r8, rdi)
+	a.lea(rsi, r15, l.outBuf+outBufSize-1)
+	a.movRI(rcx, '\n')
+	a.storeByte(rsi, 0, rcx)
+	a.movRI(r9, 0) // Negative flag
+	a.alu(aluTest, rax, rax)
+	a.jcc(condGE, "write_int_digits")
+	a.neg(rax) // The most negative value stays negative but divides unsigned
+	a.movRI(r9, 1)
+	a.label("write_int_digits")
+	a.movRI(r10, 10)
+	a.label("write_int_loop")
+	a.movRI(rdx, 0)
+	a.div(r10)
+	a.addI(rdx, '0')
+	a.subI(rsi, 1)
+	a.storeByte(rsi, 0, rdx)
+	a.alu(aluTest, rax, rax)
+	a.jcc(condNE, "write_int_loop")
+	a.alu(aluTest, r9, r9)
+	a.jcc(condE, "write_int_emit")
+	a.subI(rsi, 1)
+	a.movRI(rcx, '-')
+	a.storeByte(rsi, 0, rcx)
+	a.label("write_int_emit")
+	a.lea(rdx, r15, l.outBuf+outBufSize)
+	a.alu(aluSub, rdx, rsi)
+	a.movRR(rdi, r8)
+	a.movRI(rax, sysWrite)
+	a.syscall()
+	a.ret()
+
+	// getc returns the next input byte in rax, or -1 at end of input
+	a.label("getc")
+	a.load(rax, r15, l.inPos)
+	a.load(rcx, r15, l.inLen)
+	a.alu(aluCmp, rax, rcx)
+	a.jcc(condL, "getc_have")
+	a.movRI(rdi, 0)
+	a.lea(rsi, r15, l.inBuf)
+	a.movRI(rdx, inBufSize)
+	a.movRI(rax, sysRead)
+	a.syscall()
+	a.alu(aluTest, rax, rax)
+	a.jcc(condLE, "getc_eof")
+	a.store(r15, l.inLen, rax)
+	a.movRI(rax, 0)
+	a.label("getc_have")
+	a.lea(rdx, r15, l.inBuf)
+	a.alu(aluAdd, rdx, rax)
+	a.addI(rax, 1)
+	a.store(r15, l.inPos, rax)
+	a.loadByte(rax, rdx, 0)
+	a.ret()
+	a.label("getc_eof")
+	a.movRI(rax, -1)
+	a.ret()
+
+	// readInt reads a decimal integer, with optional sign and leading
+	// white space, into rax. Anything else is a runtime error.
+	a.label("read_int")
+	a.call("getc")
+	a.cmpI(rax, ' ')
+	a.jcc(condE, "read_int")
+	a.cmpI(rax, '\t')
+	a.jcc(condL, "read_int_sign")
+	a.cmpI(rax, '\r')
+	a.jcc(condLE, "read_int")
+	a.label("read_int_sign")
+	a.movRI(r9, 0) // Negative flag
+	a.cmpI(rax, '+')
+	a.jcc(condE, "read_int_skip_sign")
+	a.cmpI(rax, '-')
+	a.jcc(condNE, "read_int_first")
+	a.movRI(r9, 1)
+	a.label("read_int_skip_sign")
+	a.call("getc")
+	a.label("read_int_first")
+	a.subI(rax, '0')
+	a.cmpI(rax, 9)
+	a.jcc(condA, "bad_input")
+	a.movRR(r10, rax)
+	a.label("read_int_loop")
+	a.call("getc")
+	a.movRR(rcx, rax)
+	a.subI(rcx, '0')
+	a.cmpI(rcx, 9)
+	a.jcc(condA, "read_int_done")
+	a.movRI(rdx, 10)
+	a.imul(r10, rdx)
+	a.alu(aluAdd, r10, rcx)
+	a.jmp("read_int_loop")
+	a.label("read_int_done")
+	// Push back the byte after the number unless the input ended
+	a.cmpI(rax, -1)
+	a.jcc(condE, "read_int_sign_fix")
+	a.load(rax, r15, l.inPos)
+	a.subI(rax, 1)
+	a.store(r15, l.inPos, rax)
+	a.label("read_int_sign_fix")
+	a.movRR(rax, r10)
+	a.alu(aluTest, r9, r9)
+	a.jcc(condE, "read_int_ret")
+	a.neg(rax)
+	a.label("read_int_ret")
+	a.ret()
+
+	// Error handlers: print a message on stderr and exit with status 1
+	a.label("bad_input")
+	emitPrint(a, "msg_badinput")
+	a.jmp("exit_failure")
+
+	// div_by_zero expects the source line in rax
+	a.label("div_by_zero")
+	a.movRR(r12, rax)
+	emitPrint(a, "msg_divzero")
+	a.movRR(rax, r12)
+	a.movRI(rdi, 2)
+	a.call("write_int")
+
+	a.label("exit_failure")
+	a.movRI(rdi, 1)
+	a.movRI(rax, sysExit)
+	a.syscall()
+
+	for _, msg := range runtimeMessages {
+		a.label(msg.label)
+		a.emit([]byte(msg.text)...)
+	}
+}
+
+// emitPrint writes a runtime message to stderr
+func emitPrint(a *assembler, label string) {
+	for _, msg := range runtimeMessages {
+		if msg.label == label {
+			a.leaLabel(rsi, label)
+			a.movRI(rdx, int64(len(msg.text)))
+		}
+	}
+	a.movRI(rdi, 2)
+	a.movRI(rax, sysWrite)
+	a.syscall()
+}
@@ -0,0 +1,100 @@
+package bytecode
+
+import (
+	"bytes"
+	"io"
+	"strings"
+	"testing"
+
+	"tinycompiler/interp"
+	"tinycompiler/tiny"
+	"tinycompiler/tiny/tinytest"
+)
+
+// Loop-heavy programs used to compare the VM with direct tree evaluation
+var benchPrograms = []struct {
+	name string
+	src  string
+}{
+	{"SumOfSquares", `
+		i := 0; s := 0;
+		repeat
+			s := s + i * i;
+			i := i + 1
+		until i = 100000;
+		write s`},
+	{"NestedLoops", `
+		i := 0; s := 0;
+		repeat
+			j := 0;
+			repeat
+				s := s + i * j / (j + 1);
+				j := j + 1
+			until j = 300;
+			i := i + 1
+		until i = 300;
+		write s`},
+	{"Collatz", `
+		n := 1; steps := 0;
+		repeat
+			x := n;
+			repeat
+				if x - x / 2 * 2 = 0 then
+					x := x / 2
+				else
+					x := 3 * x + 1
+				end;
+				steps := steps + 1
+			until x = 1;
+			n := n + 1
+		until n = 3000;
+		write steps`},
+}
+
+// checkSameOutput fails the benchmark if the two engines disagree
+func checkSameOutput(b *testing.B, tree *tiny.TreeNode, prog *Program) {
+	b.Helper()
+	var want, got bytes.Buffer
+	if err := interp.New(strings.NewReader(""), &want).Run(tree); err != nil {
+		b.Fatalf("interp: %v", err)
+	}
+	if err := NewVM(strings.NewReader(""), &got).Run(prog); err != nil {
+		b.Fatalf("vm: %v", err)
+	}
+	if want.String() != got.String() {
+		b.Fatalf("interpreter wrote %q, VM wrote %q", want.String(), got.String())
+	}
+}
+
+func BenchmarkTreeInterp(b *testing.B) {
+	for _, bp := range benchPrograms {
+		b.Run(bp.name, func(b *testing.B) {
+			tree := tinytest.Parse(b, bp.src)
+			b.ResetTimer()
+			for i := 0; i < b.N; i++ {
+				if err := interp.New(strings.NewReader(""), io.Discard).Run(tree); err != nil {
+					b.Fatal(err)
+				}
+			}
+		})
+	}
+}
+
+func BenchmarkVM(b *testing.B) {
+	for _, bp := range benchPrograms {
+		b.Run(bp.name, func(b *testing.B) {
+			tree := tinytest.Parse(b, bp.src)
+			prog, err := Compile(tree)
+			if err != nil {
+				b.Fatal(err)
+			}
+			checkSameOutput(b, tree, prog)
+			b.ResetTimer()
+			for i := 0; i < b.N; i++ {
+				if err := NewVM(strings.NewReader(""), io.Discard).Run(prog); err != nil {
+					b.Fatal(err)
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,95 @@
+// Package bytecode compiles TINY syntax trees to a compact stack bytecode
+// and runs it in a dispatch-loop virtual machine.
+package bytecode
+
+import (
+	"fmt"
+	"io"
+
+	"tinycompiler/tiny"
+)
+
+// Opcode is a bytecode instruction. Instructions that take an operand are
+// followed by two bytes holding it in little-endian order.
+type Opcode byte
+
+const (
+	OpHalt        Opcode = iota // Stop execution
+	OpPush                      // Push Consts[arg]
+	OpLoad                      // Push variable arg
+	OpStore                     // Pop into variable arg
+	OpAdd                       // Pop b, a; push a + b
+	OpSub                       // Pop b, a; push a - b
+	OpMul                       // Pop b, a; push a * b
+	OpDiv                       // Pop b, a; push a / b
+	OpLt                        // Pop b, a; push 1 if a < b else 0
+	OpEq                        // Pop b, a; push 1 if a == b else 0
+	OpGt                        // Pop b, a; push 1 if a > b else 0
+	OpLe                        // Pop b, a; push 1 if a <= b else 0
+	OpGe                        // Pop b, a; push 1 if a >= b else 0
+	OpNe                        // Pop b, a; push 1 if a != b else 0
+	OpNeg                       // Pop a; push -a
+	OpJump                      // Continue at arg
+	OpJumpIfFalse               // Pop; continue at arg if it is 0
+	OpRead                      // Read an integer into variable arg
+	OpWrite                     // Pop and print
+)
+
+var opcodeNames = [...]string{
+	"HALT", "PUSH", "LOAD", "STORE",
+	"ADD", "SUB", "MUL", "DIV", "LT", "EQ", "GT", "LE", "GE", "NE", "NEG",
+	"JUMP", "JUMPF", "READ", "WRITE",
+}
+
+func (op Opcode) String() string {
+	if int(op) < len(opcodeNames) {
+		return opcodeNames[op]
+	}
+	return fmt.Sprintf("Opcode(%d)", op)
+}
+
+// HasArg reports whether the opcode is followed by an operand
+func (op Opcode) HasArg() bool {
+	switch op {
+	case OpPush, OpLoad, OpStore, OpJump, OpJumpIfFalse, OpRead:
+		return true
+	}
+	return false
+}
+
+// maxArg is the largest operand that fits in an instruction
+const maxArg = 1<<16 - 1
+
+// Program is a compiled TINY program
+type Program struct {
+	Code     []byte
+	Consts   []int
+	Vars     []string // Variable names, indexed by slot
+	MaxStack int      // Deepest the operand stack gets
+
+	// Source spans of the instructions that can fail at run time
+	spans map[int]tiny.Span
+}
+
+// Disassemble writes a readable listing of the program
+func (p *Program) Disassemble(w io.Writer) {
+	for pc := 0; pc < len(p.Code); {
+		op := Opcode(p.Code[pc])
+		if !op.HasArg() {
+			fmt.Fprintf(w, "%5d  %s\n", pc, op)
+			pc++
+			continue
+		}
+
+		arg := int(p.Code[pc+1]) | int(p.Code[pc+2])<<8
+		switch op {
+		case OpPush:
+			fmt.Fprintf(w, "%5d  %-6s %d\n", pc, op, p.Consts[arg])
+		case OpLoad, OpStore, OpRead:
+			fmt.Fprintf(w, "%5d  %-6s %s\n", pc, op, p.Vars[arg])
+		default:
+			fmt.Fprintf(w, "%5d  %-6s %d\n", pc, op, arg)
+		}
+		pc += 3
+	}
+}
@@ -0,0 +1,301 @@
+package bytecode
+
+import (
+	"errors"
+	"fmt"
+
+	"tinycompiler/tiny"
+)
+
+// compiler holds the state of a compilation
+type compiler struct {
+	prog   *Program
+	slots  map[string]int
+	consts map[int]int
+	depth  int // Current operand stack depth
+	err    error
+}
+
+// Compile translates the program rooted at tree to bytecode. Variables get
+// the slots of their symbol table locations.
+func Compile(tree *tiny.TreeNode) (*Program, error) {
+	table, _ := tiny.BuildSymtab(tree)
+
+	c := &compiler{
+		prog: &Program{
+			Vars:  make([]string, table.Len()),
+			spans: make(map[int]tiny.Span),
+		},
+		slots:  make(map[string]int),
+		consts: make(map[int]int),
+	}
+	for _, sym := range table.Symbols() {
+		c.prog.Vars[sym.Location] = sym.Name
+		c.slots[sym.Name] = sym.Location
+	}
+	if len(c.prog.Vars) > maxArg+1 {
+		return nil, fmt.Errorf("too many variables: %d", len(c.prog.Vars))
+	}
+
+	c.stmtSeq(tree)
+	c.emit(OpHalt)
+	if c.err != nil {
+		return nil, c.err
+	}
+	return c.prog, nil
+}
+
+func (c *compiler) stmtSeq(node *tiny.TreeNode) {
+	for ; node != nil; node = node.Sibling {
+		c.stmt(node)
+	}
+}
+
+func (c *compiler) stmt(node *tiny.TreeNode) {
+	if node.NodeKind != tiny.StmtK {
+		c.fail(node, "cannot compile a syntax error")
+		return
+	}
+
+	switch node.StmtKind {
+	case tiny.IfK:
+		c.exp(node.Children[0])
+		elseJump := c.emitJump(OpJumpIfFalse)
+		c.stmtSeq(node.Children[1])
+		if node.Children[2] == nil {
+			c.patch(elseJump)
+			return
+		}
+		endJump := c.emitJump(OpJump)
+		c.patch(elseJump)
+		c.stmtSeq(node.Children[2])
+		c.patch(endJump)
+
+	case tiny.RepeatK:
+		top := len(c.prog.Code)
+		c.stmtSeq(node.Children[0])
+		c.exp(node.Children[1])
+		c.emitArg(OpJumpIfFalse, top)
+
+	case tiny.WhileK:
+		top := len(c.prog.Code)
+		c.exp(node.Children[0])
+		endJump := c.emitJump(OpJumpIfFalse)
+		c.stmtSeq(node.Children[1])
+		c.emitArg(OpJump, top)
+		c.patch(endJump)
+
+	case tiny.ForK:
+		// The limit and step are evaluated once, into hidden slots
+		slot := c.slots[node.Name]
+		c.exp(node.Children[0])
+		c.emitArg(OpStore, slot)
+		limit := c.hidden(node.Name + ".limit")
+		c.exp(node.Children[1])
+		c.emitArg(OpStore, limit)
+		step := -1
+		if node.Children[2] != nil {
+			step = c.hidden(node.Name + ".step")
+			c.exp(node.Children[2])
+			c.emitArg(OpStore, step)
+		}
+		top := len(c.prog.Code)
+		c.emitArg(OpLoad, slot)
+		c.emitArg(OpLoad, limit)
+		if node.Op == "downto" {
+			c.emit(OpGe)
+		} else {
+			c.emit(OpLe)
+		}
+		endJump := c.emitJump(OpJumpIfFalse)
+		c.stmtSeq(node.Children[3])
+		c.emitArg(OpLoad, slot)
+		if step >= 0 {
+			c.emitArg(OpLoad, step)
+		} else {
+			c.emitArg(OpPush, c.constant(1))
+		}
+		if node.Op == "downto" {
+			c.emit(OpSub)
+		} else {
+			c.emit(OpAdd)
+		}
+		c.emitArg(OpStore, slot)
+		c.emitArg(OpJump, top)
+		c.patch(endJump)
+
+	case tiny.AssignK:
+		c.exp(node.Children[0])
+		c.emitArg(OpStore, c.slots[node.Name])
+
+	case tiny.ReadK:
+		c.prog.spans[len(c.prog.Code)] = node.Span
+		c.emitArg(OpRead, c.slots[node.Name])
+
+	case tiny.WriteK:
+		c.exp(node.Children[0])
+		c.emit(OpWrite)
+	}
+}
+
+func (c *compiler) exp(node *tiny.TreeNode) {
+	if node == nil || node.NodeKind != tiny.ExpK {
+		c.fail(node, "cannot compile a syntax error")
+		return
+	}
+
+	switch node.ExpKind {
+	case tiny.ConstK:
+		c.emitArg(OpPush, c.constant(node.Value))
+	case tiny.IdK:
+		c.emitArg(OpLoad, c.slots[node.Name])
+	case tiny.UnaryK:
+		c.exp(node.Children[0])
+		switch node.Op {
+		case "not":
+			c.emitArg(OpPush, c.constant(0))
+			c.emit(OpEq)
+		case "-":
+			c.emit(OpNeg)
+		case "+":
+		default:
+			c.fail(node, "unknown operator "+node.Op)
+		}
+	case tiny.OpK:
+		if node.Op == "and" || node.Op == "or" {
+			c.logical(node)
+			return
+		}
+		c.exp(node.Children[0])
+		c.exp(node.Children[1])
+		switch node.Op {
+		case "+":
+			c.emit(OpAdd)
+		case "-":
+			c.emit(OpSub)
+		case "*":
+			c.emit(OpMul)
+		case "/":
+			c.prog.spans[len(c.prog.Code)] = node.Span
+			c.emit(OpDiv)
+		case "<":
+			c.emit(OpLt)
+		case ">":
+			c.emit(OpGt)
+		case "<=":
+			c.emit(OpLe)
+		case ">=":
+			c.emit(OpGe)
+		case "=":
+			c.emit(OpEq)
+		case "<>":
+			c.emit(OpNe)
+		default:
+			c.fail(node, "unknown operator "+node.Op)
+		}
+	}
+}
+
+// logical compiles and and or, evaluating the right operand only when the
+// left one does not decide the result, which is left as 1 or 0
+func (c *compiler) logical(node *tiny.TreeNode) {
+	c.exp(node.Children[0])
+	shortJump := c.emitJump(OpJumpIfFalse)
+	if node.Op == "and" {
+		c.truth(node.Children[1])
+		endJump := c.emitJump(OpJump)
+		c.depth-- // Only one of the paths pushes its result
+		c.patch(shortJump)
+		c.emitArg(OpPush, c.constant(0))
+		c.patch(endJump)
+		return
+	}
+	c.emitArg(OpPush, c.constant(1))
+	endJump := c.emitJump(OpJump)
+	c.depth--
+	c.patch(shortJump)
+	c.truth(node.Children[1])
+	c.patch(endJump)
+}
+
+// truth pushes 1 if node is nonzero, else 0
+func (c *compiler) truth(node *tiny.TreeNode) {
+	c.exp(node)
+	c.emitArg(OpPush, c.constant(0))
+	c.emit(OpNe)
+}
+
+// constant returns the pool index of value, adding it if needed
+func (c *compiler) constant(value int) int {
+	if i, ok := c.consts[value]; ok {
+		return i
+	}
+	i := len(c.prog.Consts)
+	c.prog.Consts = append(c.prog.Consts, value)
+	c.consts[value] = i
+	return i
+}
+
+func (c *compiler) emit(op Opcode) {
+	c.prog.Code = append(c.prog.Code, byte(op))
+	c.track(op)
+}
+
+func (c *compiler) emitArg(op Opcode, arg int) {
+	if arg > maxArg && c.err == nil {
+		c.err = fmt.Errorf("program too large: operand %d does not fit", arg)
+	}
+	c.prog.Code = append(c.prog.Code, byte(op), byte(arg), byte(arg>>8))
+	c.track(op)
+}
+
+// emitJump emits a jump whose target is filled in later by patch
+func (c *compiler) emitJump(op Opcode) int {
+	c.emitArg(op, 0)
+	return len(c.prog.Code) - 3
+}
+
+// patch makes the jump at pc continue at the current end of the code
+func (c *compiler) patch(pc int) {
+	target := len(c.prog.Code)
+	if target > maxArg && c.err == nil {
+		c.err = fmt.Errorf("program too large: jump target %d does not fit", target)
+	}
+	c.prog.Code[pc+1] = byte(target)
+	c.prog.Code[pc+2] = byte(target >> 8)
+}
+
+// track follows the stack depth to find how large the stack must be
+func (c *compiler) track(op Opcode) {
+	switch op {
+	case OpPush, OpLoad:
+		c.depth++
+	case OpStore, OpJumpIfFalse, OpWrite,
+		OpAdd, OpSub, OpMul, OpDiv, OpLt, OpEq, OpGt, OpLe, OpGe, OpNe:
+		c.depth--
+	}
+	if c.depth > c.prog.MaxStack {
+		c.prog.MaxStack = c.depth
+	}
+}
+
+// hidden allocates a slot for a value that the program keeps but that no
+// variable names. Its name contains a '.', so it cannot clash with one.
+func (c *compiler) hidden(name string) int {
+	c.prog.Vars = append(c.prog.Vars, name)
+	slot := len(c.prog.Vars) - 1
+	if slot > maxArg && c.err == nil {
+		c.err = fmt.Errorf("too many variables: %d", len(c.prog.Vars))
+	}
+	return slot
+}
+
+func (c *compiler) fail(node *tiny.TreeNode, msg string) {
+	if c.err != nil {
+		return
+	}
+	if node != nil {
+		msg = fmt.Sprintf("line %d: %s", node.LineNum, msg)
+	}
+	c.err = errors.New(msg)
+}
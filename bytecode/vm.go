@@ -0,0 +1,164 @@
+package bytecode
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+
+	"tinycompiler/tiny"
+)
+
+// VM runs bytecode programs. Like the tree interpreter, read takes integers
+// from the input and write prints one integer per line.
+type VM struct {
+	in   *bufio.Reader
+	out  io.Writer
+	vars []int
+}
+
+// NewVM creates a virtual machine that reads from in and writes to out
+func NewVM(in io.Reader, out io.Writer) *VM {
+	return &VM{
+		in:  bufio.NewReader(in),
+		out: out,
+	}
+}
+
+// Vars returns the variables of the last program run, indexed by slot
+func (vm *VM) Vars() []int {
+	return vm.vars
+}
+
+// Run executes p. Runtime errors are returned as tiny.Diagnostic values.
+func (vm *VM) Run(p *Program) error {
+	code := p.Code
+	consts := p.Consts
+	vars := make([]int, len(p.Vars))
+	stack := make([]int, p.MaxStack+1)
+	vm.vars = vars
+
+	pc, sp := 0, 0
+	for {
+		op := Opcode(code[pc])
+		switch op {
+		case OpHalt:
+			return nil
+
+		case OpPush:
+			stack[sp] = consts[int(code[pc+1])|int(code[pc+2])<<8]
+			sp++
+			pc += 3
+
+		case OpLoad:
+			stack[sp] = vars[int(code[pc+1])|int(code[pc+2])<<8]
+			sp++
+			pc += 3
+
+		case OpStore:
+			sp--
+			vars[int(code[pc+1])|int(code[pc+2])<<8] = stack[sp]
+			pc += 3
+
+		case OpAdd:
+			sp--
+			stack[sp-1] += stack[sp]
+			pc++
+
+		case OpSub:
+			sp--
+			stack[sp-1] -= stack[sp]
+			pc++
+
+		case OpMul:
+			sp--
+			stack[sp-1] *= stack[sp]
+			pc++
+
+		case OpDiv:
+			sp--
+			if stack[sp] == 0 {
+				return p.runtimeError(pc, tiny.CodeDivByZero, "division by zero")
+			}
+			stack[sp-1] /= stack[sp]
+			pc++
+
+		case OpLt:
+			sp--
+			stack[sp-1] = boolToInt(stack[sp-1] < stack[sp])
+			pc++
+
+		case OpEq:
+			sp--
+			stack[sp-1] = boolToInt(stack[sp-1] == stack[sp])
+			pc++
+
+		case OpGt:
+			sp--
+			stack[sp-1] = boolToInt(stack[sp-1] > stack[sp])
+			pc++
+
+		case OpLe:
+			sp--
+			stack[sp-1] = boolToInt(stack[sp-1] <= stack[sp])
+			pc++
+
+		case OpGe:
+			sp--
+			stack[sp-1] = boolToInt(stack[sp-1] >= stack[sp])
+			pc++
+
+		case OpNe:
+			sp--
+			stack[sp-1] = boolToInt(stack[sp-1] != stack[sp])
+			pc++
+
+		case OpNeg:
+			stack[sp-1] = -stack[sp-1]
+			pc++
+
+		case OpJump:
+			pc = int(code[pc+1]) | int(code[pc+2])<<8
+
+		case OpJumpIfFalse:
+			sp--
+			if stack[sp] == 0 {
+				pc = int(code[pc+1]) | int(code[pc+2])<<8
+			} else {
+				pc += 3
+			}
+
+		case OpRead:
+			slot := int(code[pc+1]) | int(code[pc+2])<<8
+			if _, err := fmt.Fscan(vm.in, &vars[slot]); err != nil {
+				return p.runtimeError(pc, tiny.CodeBadInput,
+					fmt.Sprintf("read %s: %v", p.Vars[slot], err))
+			}
+			pc += 3
+
+		case OpWrite:
+			sp--
+			fmt.Fprintln(vm.out, stack[sp])
+			pc++
+
+		default:
+			return fmt.Errorf("bad opcode %v at %d", op, pc)
+		}
+	}
+}
+
+func boolToInt(b bool) int {
+	if b {
+		return 1
+	}
+	return 0
+}
+
+// runtimeError creates the diagnostic for a failure of the instruction at pc
+func (p *Program) runtimeError(pc int, code, msg string) tiny.Diagnostic {
+	return tiny.Diagnostic{
+		Severity: tiny.SeverityError,
+		Code:     code,
+		Message:  msg,
+		Span:     p.spans[pc],
+	}
+}
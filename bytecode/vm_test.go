@@ -0,0 +1,94 @@
+package bytecode
+
+import (
+	"bytes"
+	"fmt"
+	"strings"
+	"testing"
+
+	"tinycompiler/tiny"
+	"tinycompiler/tiny/tinytest"
+)
+
+// run compiles src and runs it on the VM with the given input, returning
+// what it wrote
+func run(t *testing.T, src, input string) (string, error) {
+	t.Helper()
+	prog, err := Compile(tinytest.Parse(t, src))
+	if err != nil {
+		t.Fatal(err)
+	}
+	var out bytes.Buffer
+	err = NewVM(strings.NewReader(input), &out).Run(prog)
+	return strings.Join(strings.Fields(out.String()), " "), err
+}
+
+// TestVMErrors checks that runtime errors point at the source of the
+// failing instruction
+func TestVMErrors(t *testing.T) {
+	tests := []struct {
+		name  string
+		src   string
+		input string
+		want  string
+		code  string
+		at    string
+	}{
+		{"division by zero", "write 1;\nx := 4 / (2 - 2);\nwrite 2", "", "1", tiny.CodeDivByZero, "2:6"},
+		{"missing input", "read x; write x; read y", "3", "3", tiny.CodeBadInput, "1:18"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := run(t, tt.src, tt.input)
+			d, ok := err.(tiny.Diagnostic)
+			if !ok {
+				t.Fatalf("error %v is not a diagnostic", err)
+			}
+			if at := fmt.Sprintf("%d:%d", d.Span.Start.Line, d.Span.Start.Column); d.Code != tt.code || at != tt.at {
+				t.Errorf("got %s at %s, want %s at %s", d.Code, at, tt.code, tt.at)
+			}
+			if got != tt.want {
+				t.Errorf("wrote %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+// TestDisassemble checks the listing and the stack depth of a program
+func TestDisassemble(t *testing.T) {
+	prog, err := Compile(tinytest.Parse(t, "read x;\nwrite x * 2 + 1"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	var b strings.Builder
+	prog.Disassemble(&b)
+	want := "    0  READ   x\n" +
+		"    3  LOAD   x\n" +
+		"    6  PUSH   2\n" +
+		"    9  MUL\n" +
+		"   10  PUSH   1\n" +
+		"   13  ADD\n" +
+		"   14  WRITE\n" +
+		"   15  HALT\n"
+	if got := b.String(); got != want {
+		t.Errorf("listing:\n%s\nwant:\n%s", got, want)
+	}
+	if prog.MaxStack != 2 {
+		t.Errorf("MaxStack = %d, want 2", prog.MaxStack)
+	}
+}
+
+// TestVMVars checks the variables left by a run
+func TestVMVars(t *testing.T) {
+	prog, err := Compile(tinytest.Parse(t, "read x; y := x * 2"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	vm := NewVM(strings.NewReader("5"), &bytes.Buffer{})
+	if err := vm.Run(prog); err != nil {
+		t.Fatal(err)
+	}
+	if got := vm.Vars(); fmt.Sprint(prog.Vars, got) != "[x y] [5 10]" {
+		t.Errorf("variables %v hold %v, want [x y] [5 10]", prog.Vars, got)
+	}
+}
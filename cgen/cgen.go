@@ -0,0 +1,357 @@
+// Package cgen translates TINY programs to C99 source code. Every variable
+// becomes an int64_t local to main, and every statement is preceded by a
+// #line directive so that C compiler diagnostics and debuggers refer back
+// to the TINY source. Arithmetic wraps around like in the other backends:
+// it is done on uint64_t, since signed overflow is undefined in C.
+package cgen
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"strings"
+
+	"tinycompiler/tiny"
+)
+
+// Options control code generation
+type Options struct {
+	File string // Source file name used in #line directives
+}
+
+// generator holds the state of a code generation run
+type generator struct {
+	w      io.Writer
+	file   string
+	indent int
+	err    error
+}
+
+// prelude holds the includes and the runtime functions that main calls;
+// they are inline so that compilers do not warn about unused ones.
+// TINY identifiers consist of letters only, so the tiny_ names cannot clash
+// with variables.
+const prelude = `#include <inttypes.h>
+#include <stdio.h>
+#include <stdlib.h>
+
+static inline int64_t tiny_read(int line)
+{
+	int64_t v;
+	if (scanf("%" SCNd64, &v) != 1) {
+		fprintf(stderr, "runtime error: read expected an integer at line %d\n", line);
+		exit(EXIT_FAILURE);
+	}
+	return v;
+}
+
+static inline void tiny_write(int64_t v)
+{
+	printf("%" PRId64 "\n", v);
+}
+
+/* The arithmetic helpers wrap around on overflow. Converting the unsigned
+   result back is implementation-defined rather than undefined, and every
+   C compiler keeps the two's complement bits. */
+static inline int64_t tiny_add(int64_t a, int64_t b)
+{
+	return (int64_t)((uint64_t)a + (uint64_t)b);
+}
+
+static inline int64_t tiny_sub(int64_t a, int64_t b)
+{
+	return (int64_t)((uint64_t)a - (uint64_t)b);
+}
+
+static inline int64_t tiny_mul(int64_t a, int64_t b)
+{
+	return (int64_t)((uint64_t)a * (uint64_t)b);
+}
+
+static inline int64_t tiny_neg(int64_t a)
+{
+	return (int64_t)(0u - (uint64_t)a);
+}
+
+/* tiny_div reports division by zero, and treats division by -1 as a
+   negation so that INT64_MIN / -1 does not trap */
+static inline int64_t tiny_div(int64_t a, int64_t b, int line)
+{
+	if (b == 0) {
+		fprintf(stderr, "runtime error: division by zero at line %d\n", line);
+		exit(EXIT_FAILURE);
+	}
+	if (b == -1)
+		return tiny_neg(a);
+	return a / b;
+}
+
+`
+
+// Generate writes a C99 program equivalent to the program rooted at tree.
+// If table is nil it is built from the tree.
+func Generate(w io.Writer, tree *tiny.TreeNode, table *tiny.SymbolTable, opts Options) error {
+	if table == nil {
+		table, _ = tiny.BuildSymtab(tree)
+	}
+	g := &generator{w: w, file: opts.File}
+
+	if opts.File != "" {
+		g.printf("/* Generated from %s */\n", strings.ReplaceAll(opts.File, "*/", "* /"))
+	}
+	g.printf("%s", prelude)
+	g.printf("int main(void)\n{\n")
+	g.indent++
+	for _, sym := range table.Symbols() {
+		g.line("int64_t %s = 0;", ident(sym.Name))
+	}
+	if table.Len() > 0 {
+		g.printf("\n")
+	}
+	g.stmtSeq(tree)
+	g.line("return 0;")
+	g.indent--
+	g.printf("}\n")
+	return g.err
+}
+
+func (g *generator) printf(format string, args ...any) {
+	if g.err != nil {
+		return
+	}
+	_, g.err = fmt.Fprintf(g.w, format, args...)
+}
+
+// line prints an indented line of code
+func (g *generator) line(format string, args ...any) {
+	g.printf("%s", strings.Repeat("\t", g.indent))
+	g.printf(format, args...)
+	g.printf("\n")
+}
+
+// lineDirective points the C compiler at the source line of node
+func (g *generator) lineDirective(node *tiny.TreeNode) {
+	if g.file == "" {
+		g.printf("#line %d\n", node.LineNum)
+		return
+	}
+	g.printf("#line %d %s\n", node.LineNum, quote(g.file))
+}
+
+func (g *generator) fail(node *tiny.TreeNode, msg string) {
+	if g.err != nil {
+		return
+	}
+	if node != nil {
+		msg = fmt.Sprintf("line %d: %s", node.LineNum, msg)
+	}
+	g.err = errors.New(msg)
+}
+
+// reserved holds C keywords and the object-like macros of the included
+// headers, which cannot be used as variable names
+var reserved = map[string]bool{
+	"auto": true, "break": true, "case": true, "char": true, "const": true,
+	"continue": true, "default": true, "do": true, "double": true, "else": true,
+	"enum": true, "extern": true, "float": true, "for": true, "goto": true,
+	"if": true, "inline": true, "int": true, "long": true, "register": true,
+	"restrict": true, "return": true, "short": true, "signed": true,
+	"sizeof": true, "static": true, "struct": true, "switch": true,
+	"typedef": true, "union": true, "unsigned": true, "void": true,
+	"volatile": true, "while": true,
+	"stdin": true, "stdout": true, "stderr": true, "EOF": true, "NULL": true,
+	"BUFSIZ": true,
+}
+
+// ident returns the C name of a variable. Reserved names get a trailing
+// underscore, which TINY identifiers never contain.
+func ident(name string) string {
+	if reserved[name] {
+		return name + "_"
+	}
+	return name
+}
+
+// quote returns s as a C string literal
+func quote(s string) string {
+	var b strings.Builder
+	b.WriteByte('"')
+	for i := 0; i < len(s); i++ {
+		c := s[i]
+		switch {
+		case c == '"' || c == '\\':
+			b.WriteByte('\\')
+			b.WriteByte(c)
+		case c < ' ' || c > '~':
+			fmt.Fprintf(&b, "\\%03o", c)
+		default:
+			b.WriteByte(c)
+		}
+	}
+	b.WriteByte('"')
+	return b.String()
+}
+
+func (g *generator) stmtSeq(node *tiny.TreeNode) {
+	for ; node != nil; node = node.Sibling {
+		g.stmt(node)
+	}
+}
+
+func (g *generator) stmt(node *tiny.TreeNode) {
+	if node.NodeKind != tiny.StmtK {
+		g.fail(node, "cannot generate code for a syntax error")
+		return
+	}
+
+	g.lineDirective(node)
+	switch node.StmtKind {
+	case tiny.IfK:
+		g.line("if (%s) {", g.exp(node.Children[0], true))
+		g.block(node.Children[1])
+		if node.Children[2] != nil {
+			g.line("} else {")
+			g.block(node.Children[2])
+		}
+		g.line("}")
+
+	case tiny.RepeatK:
+		g.line("do {")
+		g.block(node.Children[0])
+		g.line("} while (!%s);", g.exp(node.Children[1], false))
+
+	case tiny.WhileK:
+		g.line("while (%s) {", g.exp(node.Children[0], true))
+		g.block(node.Children[1])
+		g.line("}")
+
+	case tiny.ForK:
+		// The limit and step are evaluated once, after the start is
+		// assigned. Unless they are constants they are kept in variables
+		// local to the loop.
+		i := ident(node.Name)
+		cmp, update := "<=", "tiny_add"
+		if node.Op == "downto" {
+			cmp, update = ">=", "tiny_sub"
+		}
+		var decls []string
+		limit := g.exp(node.Children[1], true)
+		if !isConst(node.Children[1]) {
+			decls = append(decls, "tiny_limit = "+limit)
+			limit = "tiny_limit"
+		}
+		step := "1"
+		if s := node.Children[2]; s != nil {
+			step = g.exp(s, true)
+			if !isConst(s) {
+				decls = append(decls, "tiny_step = "+step)
+				step = "tiny_step"
+			}
+		}
+		init := fmt.Sprintf("%s = %s", i, g.exp(node.Children[0], true))
+		if decls != nil {
+			g.line("%s;", init)
+			init = "int64_t " + strings.Join(decls, ", ")
+		}
+		g.line("for (%s; %s %s %s; %s = %s(%s, %s)) {", init, i, cmp, limit, i, update, i, step)
+		g.block(node.Children[3])
+		g.line("}")
+
+	case tiny.AssignK:
+		g.line("%s = %s;", ident(node.Name), g.exp(node.Children[0], true))
+
+	case tiny.ReadK:
+		g.line("%s = tiny_read(%d);", ident(node.Name), node.LineNum)
+
+	case tiny.WriteK:
+		g.line("tiny_write(%s);", g.exp(node.Children[0], true))
+	}
+}
+
+// isConst reports whether node is a constant
+func isConst(node *tiny.TreeNode) bool {
+	return node != nil && node.NodeKind == tiny.ExpK && node.ExpKind == tiny.ConstK
+}
+
+// block generates an indented statement sequence
+func (g *generator) block(node *tiny.TreeNode) {
+	g.indent++
+	g.stmtSeq(node)
+	g.indent--
+}
+
+// arith maps the arithmetic operators to the runtime functions that
+// implement them with wraparound
+var arith = map[string]string{
+	"+": "tiny_add",
+	"-": "tiny_sub",
+	"*": "tiny_mul",
+}
+
+// exp returns node as a C expression. Operations are parenthesized unless
+// top is set, meaning the context already delimits the expression.
+func (g *generator) exp(node *tiny.TreeNode, top bool) string {
+	if node == nil || node.NodeKind != tiny.ExpK {
+		g.fail(node, "cannot generate code for a syntax error")
+		return "0"
+	}
+
+	switch node.ExpKind {
+	case tiny.ConstK:
+		// The literal 9223372036854775808 has no signed type, so the most
+		// negative value cannot be written as its negation
+		if node.Value == math.MinInt64 {
+			return "INT64_MIN"
+		}
+		return fmt.Sprint(node.Value)
+
+	case tiny.IdK:
+		return ident(node.Name)
+
+	case tiny.UnaryK:
+		switch node.Op {
+		case "not":
+			return "!" + g.exp(node.Children[0], false)
+		case "-":
+			return fmt.Sprintf("tiny_neg(%s)", g.exp(node.Children[0], true))
+		case "+":
+			// Keep + +x from reading as an increment
+			x := g.exp(node.Children[0], false)
+			if strings.HasPrefix(x, "+") {
+				return "+ " + x
+			}
+			return "+" + x
+		}
+		g.fail(node, "unknown operator "+node.Op)
+
+	case tiny.OpK:
+		if f := arith[node.Op]; f != "" {
+			return fmt.Sprintf("%s(%s, %s)", f, g.exp(node.Children[0], true), g.exp(node.Children[1], true))
+		}
+		l := g.exp(node.Children[0], false)
+		r := g.exp(node.Children[1], false)
+		var s string
+		switch node.Op {
+		case "<", ">", "<=", ">=":
+			s = l + " " + node.Op + " " + r
+		case "=":
+			s = l + " == " + r
+		case "<>":
+			s = l + " != " + r
+		case "and":
+			s = l + " && " + r
+		case "or":
+			s = l + " || " + r
+		case "/":
+			return fmt.Sprintf("tiny_div(%s, %s, %d)", l, r, node.LineNum)
+		default:
+			g.fail(node, "unknown operator "+node.Op)
+		}
+		if top {
+			return s
+		}
+		return "(" + s + ")"
+	}
+	return "0"
+}
@@ -0,0 +1,153 @@
+package cgen
+
+import (
+	"bytes"
+	"math"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"tinycompiler/tiny/tinytest"
+)
+
+// generate translates src to C, failing the test on any error
+func generate(t *testing.T, src string, opts Options) string {
+	t.Helper()
+	var b strings.Builder
+	if err := Generate(&b, tinytest.Parse(t, src), nil, opts); err != nil {
+		t.Fatal(err)
+	}
+	return b.String()
+}
+
+// TestGenerate checks the translation of a whole program
+func TestGenerate(t *testing.T) {
+	src := "read x;\nif x < 10 then\n  write (x + 1) * 2 / x\nelse\n  repeat x := x - 1 until x = 0\nend"
+	got := generate(t, src, Options{File: "prog.tny"})
+	if !strings.HasPrefix(got, "/* Generated from prog.tny */\n#include <inttypes.h>\n") {
+		t.Errorf("missing header:\n%s", got)
+	}
+	want := `int main(void)
+{
+	int64_t x = 0;
+
+#line 1 "prog.tny"
+	x = tiny_read(1);
+#line 2 "prog.tny"
+	if (x < 10) {
+#line 3 "prog.tny"
+		tiny_write(tiny_div(tiny_mul(tiny_add(x, 1), 2), x, 3));
+	} else {
+#line 5 "prog.tny"
+		do {
+#line 5 "prog.tny"
+			x = tiny_sub(x, 1);
+		} while (!(x == 0));
+	}
+	return 0;
+}
+`
+	if i := strings.Index(got, "int main"); i < 0 || got[i:] != want {
+		t.Errorf("got:\n%s\nwant:\n%s", got, want)
+	}
+}
+
+// TestNames checks that variables named like C keywords or macros are
+// renamed and that file names are quoted
+func TestNames(t *testing.T) {
+	got := generate(t, "int := 1; EOF := int; write EOF", Options{File: `a "b"\c.tny`})
+	for _, want := range []string{
+		"int64_t int_ = 0;\n",
+		"int64_t EOF_ = 0;\n",
+		"EOF_ = int_;\n",
+		`#line 1 "a \"b\"\\c.tny"` + "\n",
+	} {
+		if !strings.Contains(got, want) {
+			t.Errorf("output lacks %q:\n%s", want, got)
+		}
+	}
+	if got := generate(t, "write 1", Options{}); !strings.Contains(got, "#line 1\n") {
+		t.Errorf("no #line without a file name:\n%s", got)
+	}
+}
+
+// TestUnary checks that negation wraps around through tiny_neg, that
+// repeated signs stay apart and that the most negative constant, which
+// only folding produces, is spelled INT64_MIN
+func TestUnary(t *testing.T) {
+	tests := []struct {
+		src  string
+		want string
+	}{
+		{"write -x", "tiny_write(tiny_neg(x));"},
+		{"write - -x", "tiny_write(tiny_neg(tiny_neg(x)));"},
+		{"write -(x + 1) * 2", "tiny_write(tiny_mul(tiny_neg(tiny_add(x, 1)), 2));"},
+		{"write +x", "tiny_write(+x);"},
+		{"write + +x", "tiny_write(+ +x);"},
+	}
+	for _, tt := range tests {
+		if got := generate(t, tt.src, Options{}); !strings.Contains(got, "\t"+tt.want+"\n") {
+			t.Errorf("%q: output lacks %q:\n%s", tt.src, tt.want, got[strings.Index(got, "int main"):])
+		}
+	}
+
+	tree := tinytest.Parse(t, "write 1")
+	tree.Children[0].Value = math.MinInt64
+	var b strings.Builder
+	if err := Generate(&b, tree, nil, Options{}); err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(b.String(), "\ttiny_write(INT64_MIN);\n") {
+		t.Errorf("most negative constant not spelled INT64_MIN:\n%s", b.String())
+	}
+}
+
+// TestCompileAndRun compiles the output with the system C compiler, which
+// must not warn about it, and checks how it reports runtime errors. The
+// shared programs of package tinytest check the rest.
+func TestCompileAndRun(t *testing.T) {
+	cc, err := exec.LookPath("cc")
+	if err != nil {
+		t.Skip("no C compiler")
+	}
+	tests := []struct {
+		name   string
+		src    string
+		input  string
+		want   string
+		stderr string // Runtime error message, if the program fails
+	}{
+		{"division by zero", "write 1;\nwrite 1 / 0", "", "1\n", "runtime error: division by zero at line 2\n"},
+		{"bad input", "read x; write x", "abc", "", "runtime error: read expected an integer at line 1\n"},
+	}
+	dir := t.TempDir()
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			c := filepath.Join(dir, strings.ReplaceAll(tt.name, " ", "_")+".c")
+			if err := os.WriteFile(c, []byte(generate(t, tt.src, Options{File: "prog.tny"})), 0o644); err != nil {
+				t.Fatal(err)
+			}
+			exe := strings.TrimSuffix(c, ".c")
+			if out, err := exec.Command(cc, "-std=c99", "-Wall", "-Werror", "-o", exe, c).CombinedOutput(); err != nil {
+				t.Fatalf("%v:\n%s", err, out)
+			}
+
+			cmd := exec.Command(exe)
+			cmd.Stdin = strings.NewReader(tt.input)
+			var stdout, stderr bytes.Buffer
+			cmd.Stdout, cmd.Stderr = &stdout, &stderr
+			err := cmd.Run()
+			if stdout.String() != tt.want {
+				t.Errorf("wrote %q, want %q", stdout.String(), tt.want)
+			}
+			if stderr.String() != tt.stderr {
+				t.Errorf("stderr %q, want %q", stderr.String(), tt.stderr)
+			}
+			if (err != nil) != (tt.stderr != "") {
+				t.Errorf("exit status %v", err)
+			}
+		})
+	}
+}
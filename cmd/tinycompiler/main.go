@@ -0,0 +1,672 @@
+// Command tinycompiler is a headless driver for the TINY compiler. Unlike the
+// GUI in the repository root it needs no display, so it can be used from
+// scripts and Makefiles.
+//
+// Usage:
+//
+//	tinycompiler <command> [flags] file.tny
+//
+// A file name of "-" reads the program from standard input. The exit status
+// is 0 on success, 1 when the program has errors or its output cannot be
+// generated or written, and 2 on usage errors or when the source cannot be
+// read.
+package main
+
+import (
+	"bytes"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+
+	"tinycompiler/amd64"
+	"tinycompiler/bytecode"
+	"tinycompiler/cgen"
+	"tinycompiler/gogen"
+	"tinycompiler/interp"
+	"tinycompiler/ir"
+	"tinycompiler/llvm"
+	"tinycompiler/opt"
+	"tinycompiler/tiny"
+	"tinycompiler/tm"
+	"tinycompiler/wasm"
+)
+
+// Exit statuses
+const (
+	exitOK = iota
+	exitErrors
+	exitUsage
+)
+
+// command is a single tinycompiler subcommand
+type command struct {
+	name    string
+	summary string
+	run     func(args []string) int
+}
+
+var commands []command
+
+// diagFormat names the formatter used for diagnostics, set by -format
+var diagFormat string
+
+func init() {
+	commands = []command{
+		{"scan", "print the token stream", runScan},
+		{"parse", "print the syntax tree", runParse},
+		{"check", "report errors without producing output", runCheck},
+		{"symtab", "print the symbol table", runSymtab},
+		{"ir", "print the three-address code", runIR},
+		{"cfg", "print the control-flow graph, dominators or SSA form", runCFG},
+		{"run", "interpret the program", runRun},
+		{"compile", "generate TM assembly or code for another target", runCompile},
+		{"tm", "run TM assembly in the simulator", runTM},
+		{"build", "build a static Linux amd64 executable", runBuild},
+	}
+}
+
+func usage() {
+	fmt.Fprintln(os.Stderr, "usage: tinycompiler <command> [flags] file.tny")
+	fmt.Fprintln(os.Stderr)
+	fmt.Fprintln(os.Stderr, "Commands:")
+	for _, c := range commands {
+		fmt.Fprintf(os.Stderr, "  %-8s %s\n", c.name, c.summary)
+	}
+	fmt.Fprintln(os.Stderr)
+	fmt.Fprintln(os.Stderr, `Run "tinycompiler <command> -h" for the flags of a command.`)
+}
+
+func main() {
+	if len(os.Args) < 2 {
+		usage()
+		os.Exit(exitUsage)
+	}
+
+	name := os.Args[1]
+	if name == "help" || name == "-h" || name == "-help" || name == "--help" {
+		usage()
+		os.Exit(exitOK)
+	}
+
+	for _, c := range commands {
+		if c.name == name {
+			os.Exit(c.run(os.Args[2:]))
+		}
+	}
+
+	fmt.Fprintf(os.Stderr, "tinycompiler: unknown command %q\n", name)
+	usage()
+	os.Exit(exitUsage)
+}
+
+// newFlagSet creates the flag set of a subcommand taking a single source file
+func newFlagSet(name string) *flag.FlagSet {
+	fs := flag.NewFlagSet(name, flag.ContinueOnError)
+	fs.StringVar(&diagFormat, "format", "text", "diagnostic `format`: text, gcc or json")
+	fs.Usage = func() {
+		fmt.Fprintf(fs.Output(), "usage: tinycompiler %s [flags] file.tny\n", name)
+		fs.PrintDefaults()
+	}
+	return fs
+}
+
+// parseArgs parses the flags of a subcommand and returns its source file
+func parseArgs(fs *flag.FlagSet, args []string) (string, bool) {
+	if err := fs.Parse(args); err != nil {
+		return "", false
+	}
+	if fs.NArg() != 1 {
+		fs.Usage()
+		return "", false
+	}
+	if _, ok := tiny.Formatters[diagFormat]; !ok {
+		fmt.Fprintf(fs.Output(), "tinycompiler: unknown diagnostic format %q\n", diagFormat)
+		return "", false
+	}
+	return fs.Arg(0), true
+}
+
+// readSource reads a program from path, or from standard input if path is "-"
+func readSource(path string) ([]byte, error) {
+	if path == "-" {
+		return io.ReadAll(os.Stdin)
+	}
+	return os.ReadFile(path)
+}
+
+// report prints diagnostics to standard error in the selected format
+func report(path string, diags []tiny.Diagnostic) {
+	if path == "-" {
+		path = "<stdin>"
+	}
+	tiny.SetFile(diags, path)
+	tiny.Formatters[diagFormat](os.Stderr, diags)
+}
+
+// frontEnd scans and parses src and returns the syntax tree together with
+// every diagnostic found on the way
+func frontEnd(src []byte) (*tiny.TreeNode, []tiny.Diagnostic) {
+	s := tiny.NewScanner(bytes.NewReader(src))
+	s.Scan()
+
+	parser := tiny.NewParser(s.Tokens())
+	tree, errors := parser.Parse()
+	diags := append(s.Errors(), errors...)
+	tiny.SortDiagnostics(diags)
+	return tree, diags
+}
+
+// analyze runs the front end and, if the program parsed cleanly, builds
+// its symbol table and type checks it
+func analyze(src []byte) (*tiny.TreeNode, *tiny.SymbolTable, []tiny.Diagnostic) {
+	tree, diags := frontEnd(src)
+	if tiny.HasErrors(diags) {
+		return tree, nil, diags
+	}
+
+	table, semantic := tiny.BuildSymtab(tree)
+	diags = append(diags, semantic...)
+	return tree, table, append(diags, tiny.TypeCheck(tree)...)
+}
+
+// optFlags are the optimization flags of the commands that run or
+// generate code
+type optFlags struct {
+	level  int
+	passes map[string]*bool
+	trace  *bool
+}
+
+func addOptFlags(fs *flag.FlagSet) *optFlags {
+	o := &optFlags{passes: map[string]*bool{}}
+	for n := 0; n <= 2; n++ {
+		fs.BoolFunc(fmt.Sprintf("O%d", n), fmt.Sprintf("optimization level %d", n), func(string) error {
+			o.level = n
+			return nil
+		})
+	}
+	for _, p := range opt.Passes {
+		o.passes[p.Name] = fs.Bool(p.Name, false, "run the "+p.Name+" pass: "+p.Summary)
+	}
+	o.trace = fs.Bool("print-passes", false, "print the syntax tree to standard error after each optimization pass")
+	return o
+}
+
+// optimize runs the passes selected by the flags on tree
+func (o *optFlags) optimize(tree *tiny.TreeNode) *tiny.TreeNode {
+	names := opt.Level(o.level)
+	for name, on := range o.passes {
+		if *on {
+			names = append(names, name)
+		}
+	}
+	m, err := opt.NewPassManager(names)
+	if err != nil {
+		panic(err) // The names all come from opt.Passes
+	}
+	if *o.trace {
+		m.Trace = os.Stderr
+	}
+	return m.Run(tree)
+}
+
+func runScan(args []string) int {
+	fs := newFlagSet("scan")
+	path, ok := parseArgs(fs, args)
+	if !ok {
+		return exitUsage
+	}
+	src, err := readSource(path)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, "tinycompiler:", err)
+		return exitUsage
+	}
+
+	s := tiny.NewScanner(bytes.NewReader(src))
+	ok = s.Scan()
+	fmt.Print(s.PrintTokens())
+	if !ok {
+		report(path, s.Errors())
+		return exitErrors
+	}
+	return exitOK
+}
+
+func runParse(args []string) int {
+	fs := newFlagSet("parse")
+	path, ok := parseArgs(fs, args)
+	if !ok {
+		return exitUsage
+	}
+	src, err := readSource(path)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, "tinycompiler:", err)
+		return exitUsage
+	}
+
+	// Print the tree even when there are errors: it is a partial tree with
+	// Error nodes where parsing failed
+	tree, diags := frontEnd(src)
+	tiny.FprintSyntaxTree(os.Stdout, tree, 0)
+	report(path, diags)
+	if tiny.HasErrors(diags) {
+		return exitErrors
+	}
+	return exitOK
+}
+
+func runCheck(args []string) int {
+	fs := newFlagSet("check")
+	path, ok := parseArgs(fs, args)
+	if !ok {
+		return exitUsage
+	}
+	src, err := readSource(path)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, "tinycompiler:", err)
+		return exitUsage
+	}
+
+	_, _, diags := analyze(src)
+	report(path, diags)
+	if tiny.HasErrors(diags) {
+		return exitErrors
+	}
+	return exitOK
+}
+
+func runSymtab(args []string) int {
+	fs := newFlagSet("symtab")
+	path, ok := parseArgs(fs, args)
+	if !ok {
+		return exitUsage
+	}
+	src, err := readSource(path)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, "tinycompiler:", err)
+		return exitUsage
+	}
+
+	_, table, diags := analyze(src)
+	report(path, diags)
+	if tiny.HasErrors(diags) {
+		return exitErrors
+	}
+	fmt.Println("Symbol table:")
+	fmt.Println()
+	table.Print(os.Stdout)
+	return exitOK
+}
+
+func runIR(args []string) int {
+	fs := newFlagSet("ir")
+	path, ok := parseArgs(fs, args)
+	if !ok {
+		return exitUsage
+	}
+	src, err := readSource(path)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, "tinycompiler:", err)
+		return exitUsage
+	}
+
+	tree, _, diags := analyze(src)
+	report(path, diags)
+	if tiny.HasErrors(diags) {
+		return exitErrors
+	}
+	prog, err := ir.Lower(tree)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, "tinycompiler:", err)
+		return exitErrors
+	}
+	prog.Print(os.Stdout)
+	return exitOK
+}
+
+func runCFG(args []string) int {
+	fs := newFlagSet("cfg")
+	stage := fs.String("stage", "cfg", "what to print: cfg (basic blocks), dom (dominators), ssa (SSA form) or out (code after leaving SSA)")
+	dot := fs.Bool("dot", false, "write a Graphviz graph instead of text")
+	path, ok := parseArgs(fs, args)
+	if !ok {
+		return exitUsage
+	}
+	switch *stage {
+	case "cfg", "dom", "ssa", "out":
+	default:
+		fmt.Fprintf(os.Stderr, "tinycompiler: unknown stage %q\n", *stage)
+		return exitUsage
+	}
+	src, err := readSource(path)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, "tinycompiler:", err)
+		return exitUsage
+	}
+
+	tree, _, diags := analyze(src)
+	report(path, diags)
+	if tiny.HasErrors(diags) {
+		return exitErrors
+	}
+	prog, err := ir.Lower(tree)
+	if err == nil {
+		var g *ir.CFG
+		g, err = ir.BuildCFG(prog)
+		if err == nil {
+			err = printStage(g, *stage, *dot)
+		}
+	}
+	if err != nil {
+		fmt.Fprintln(os.Stderr, "tinycompiler:", err)
+		return exitErrors
+	}
+	return exitOK
+}
+
+// printStage writes the control-flow graph g after bringing it to stage
+func printStage(g *ir.CFG, stage string, dot bool) error {
+	switch stage {
+	case "dom":
+		g.ComputeDominators()
+		if dot {
+			return g.DomDot(os.Stdout)
+		}
+		return g.PrintDominators(os.Stdout)
+	case "ssa":
+		g.ToSSA()
+	case "out":
+		g.ToSSA()
+		g.FromSSA()
+		if !dot {
+			return g.Program().Print(os.Stdout)
+		}
+	}
+	if dot {
+		return g.Dot(os.Stdout)
+	}
+	return g.Print(os.Stdout)
+}
+
+// reportRuntime prints an error returned while running a program
+func reportRuntime(path string, err error) {
+	if d, ok := err.(tiny.Diagnostic); ok {
+		report(path, []tiny.Diagnostic{d})
+		return
+	}
+	fmt.Fprintln(os.Stderr, "tinycompiler:", err)
+}
+
+func runRun(args []string) int {
+	fs := newFlagSet("run")
+	vm := fs.Bool("vm", false, "compile to bytecode and run it in the virtual machine")
+	disasm := fs.Bool("disasm", false, "print the bytecode to standard error before running it (with -vm)")
+	optimizer := addOptFlags(fs)
+	path, ok := parseArgs(fs, args)
+	if !ok {
+		return exitUsage
+	}
+	src, err := readSource(path)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, "tinycompiler:", err)
+		return exitUsage
+	}
+
+	tree, _, diags := analyze(src)
+	report(path, diags)
+	if tiny.HasErrors(diags) {
+		return exitErrors
+	}
+	tree = optimizer.optimize(tree)
+
+	if *vm {
+		prog, err := bytecode.Compile(tree)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "%s: %v\n", path, err)
+			return exitErrors
+		}
+		if *disasm {
+			prog.Disassemble(os.Stderr)
+		}
+		err = bytecode.NewVM(os.Stdin, os.Stdout).Run(prog)
+		if err != nil {
+			reportRuntime(path, err)
+			return exitErrors
+		}
+		return exitOK
+	}
+
+	if err := interp.New(os.Stdin, os.Stdout).Run(tree); err != nil {
+		reportRuntime(path, err)
+		return exitErrors
+	}
+	return exitOK
+}
+
+// outputPath returns the file written for source path: the name given by
+// -o, or path with its extension replaced by ext. "-" means standard output.
+func outputPath(path, flagValue, ext string) string {
+	if flagValue != "" {
+		return flagValue
+	}
+	if path == "-" {
+		return "-"
+	}
+	return strings.TrimSuffix(path, filepath.Ext(path)) + ext
+}
+
+// writeOutput creates the output file with permissions perm and passes it
+// to write. If writing fails the file is removed, so that no partial
+// output is left behind.
+func writeOutput(path string, perm os.FileMode, write func(w io.Writer) error) error {
+	if path == "-" {
+		return write(os.Stdout)
+	}
+
+	f, err := os.OpenFile(path, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, perm)
+	if err != nil {
+		return err
+	}
+	err = write(f)
+	if cerr := f.Close(); err == nil {
+		err = cerr
+	}
+	if err != nil {
+		os.Remove(path)
+	}
+	return err
+}
+
+// compileOptions are the compile flags shared by all targets
+type compileOptions struct {
+	file     string // Base name of the source file
+	comments bool   // Annotate the output with source lines, if the target can
+}
+
+// target is an output language of the compile command
+type target struct {
+	ext      string // Extension of the output file
+	generate func(w io.Writer, tree *tiny.TreeNode, table *tiny.SymbolTable, opts compileOptions) error
+}
+
+var targets = map[string]target{
+	"tm": {".tm", func(w io.Writer, tree *tiny.TreeNode, table *tiny.SymbolTable, opts compileOptions) error {
+		return tm.Generate(w, tree, table, tm.Options{File: opts.file, Comments: opts.comments})
+	}},
+	"c": {".c", func(w io.Writer, tree *tiny.TreeNode, table *tiny.SymbolTable, opts compileOptions) error {
+		return cgen.Generate(w, tree, table, cgen.Options{File: opts.file})
+	}},
+	"go": {".go", func(w io.Writer, tree *tiny.TreeNode, table *tiny.SymbolTable, opts compileOptions) error {
+		return gogen.Generate(w, tree, table, gogen.Options{File: opts.file})
+	}},
+	"llvm": {".ll", func(w io.Writer, tree *tiny.TreeNode, table *tiny.SymbolTable, opts compileOptions) error {
+		return llvm.Generate(w, tree, table, llvm.Options{File: opts.file})
+	}},
+	"wasm": {".wasm", func(w io.Writer, tree *tiny.TreeNode, _ *tiny.SymbolTable, _ compileOptions) error {
+		module, err := wasm.Compile(tree)
+		if err != nil {
+			return err
+		}
+		_, err = w.Write(module)
+		return err
+	}},
+}
+
+// targetNames returns the names of the compile targets in order
+func targetNames() string {
+	names := make([]string, 0, len(targets))
+	for name := range targets {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return strings.Join(names, ", ")
+}
+
+func runCompile(args []string) int {
+	fs := newFlagSet("compile")
+	out := fs.String("o", "", "output `file` (default: the source file with the target's extension)")
+	comments := fs.Bool("comments", false, "annotate the code with comments pointing back to source lines")
+	targetName := fs.String("target", "tm", "output `language`: "+targetNames()+" (llvm needs LLVM 15 or later)")
+	optimizer := addOptFlags(fs)
+	path, ok := parseArgs(fs, args)
+	if !ok {
+		return exitUsage
+	}
+	t, ok := targets[*targetName]
+	if !ok {
+		fmt.Fprintf(os.Stderr, "tinycompiler: unknown target %q\n", *targetName)
+		return exitUsage
+	}
+	src, err := readSource(path)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, "tinycompiler:", err)
+		return exitUsage
+	}
+
+	tree, table, diags := analyze(src)
+	report(path, diags)
+	if tiny.HasErrors(diags) {
+		return exitErrors
+	}
+	tree = optimizer.optimize(tree)
+
+	opts := compileOptions{file: filepath.Base(path), comments: *comments}
+	err = writeOutput(outputPath(path, *out, t.ext), 0o666, func(w io.Writer) error {
+		return t.generate(w, tree, table, opts)
+	})
+	if err != nil {
+		fmt.Fprintln(os.Stderr, "tinycompiler:", err)
+		return exitErrors
+	}
+	return exitOK
+}
+
+func runTM(args []string) int {
+	// The simulator reports no diagnostics, so it has no -format flag
+	fs := flag.NewFlagSet("tm", flag.ContinueOnError)
+	fs.Usage = func() {
+		fmt.Fprintln(fs.Output(), "usage: tinycompiler tm [flags] file.tm")
+		fs.PrintDefaults()
+	}
+	trace := fs.Bool("trace", false, "print each instruction to standard error as it executes")
+	step := fs.Bool("step", false, "start in the interactive debugger")
+	regs := fs.Bool("regs", false, "dump the registers to standard error when the program stops")
+	mem := fs.Int("mem", 0, "dump the first `n` data memory locations to standard error when the program stops")
+	var breakpoints []int
+	fs.Func("break", "stop in the debugger before the instructions at the comma separated `addresses`", func(s string) error {
+		for _, f := range strings.Split(s, ",") {
+			addr, err := strconv.Atoi(strings.TrimSpace(f))
+			if err != nil {
+				return err
+			}
+			breakpoints = append(breakpoints, addr)
+		}
+		return nil
+	})
+	if err := fs.Parse(args); err != nil {
+		return exitUsage
+	}
+	if fs.NArg() != 1 {
+		fs.Usage()
+		return exitUsage
+	}
+	path := fs.Arg(0)
+	src, err := readSource(path)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, "tinycompiler:", err)
+		return exitUsage
+	}
+
+	m := tm.NewMachine(os.Stdin, os.Stdout)
+	if err := m.Load(bytes.NewReader(src)); err != nil {
+		fmt.Fprintf(os.Stderr, "%s: %v\n", path, err)
+		return exitErrors
+	}
+	m.Trace = *trace
+	m.TraceOut = os.Stderr
+	for _, addr := range breakpoints {
+		m.SetBreakpoint(addr, true)
+	}
+
+	result := tm.OK
+	if *step {
+		err = m.Debug(os.Stdout)
+	} else if result = m.Run(); result == tm.Break {
+		fmt.Printf("Breakpoint at %d\n", m.Reg[tm.PCReg])
+		err = m.Debug(os.Stdout)
+	}
+	if err != nil {
+		fmt.Fprintln(os.Stderr, "tinycompiler:", err)
+		return exitUsage
+	}
+
+	if *regs {
+		m.DumpRegs(os.Stderr)
+	}
+	m.DumpDMem(os.Stderr, 0, *mem)
+	if result != tm.OK && result != tm.Halted && result != tm.Break {
+		fmt.Fprintf(os.Stderr, "%s: %v at instruction %d\n", path, result, m.Reg[tm.PCReg]-1)
+		return exitErrors
+	}
+	return exitOK
+}
+
+func runBuild(args []string) int {
+	fs := newFlagSet("build")
+	out := fs.String("o", "", "output `file` (default: the source file without its extension)")
+	optimizer := addOptFlags(fs)
+	path, ok := parseArgs(fs, args)
+	if !ok {
+		return exitUsage
+	}
+	src, err := readSource(path)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, "tinycompiler:", err)
+		return exitUsage
+	}
+
+	tree, _, diags := analyze(src)
+	report(path, diags)
+	if tiny.HasErrors(diags) {
+		return exitErrors
+	}
+	tree = optimizer.optimize(tree)
+
+	target := outputPath(path, *out, "")
+	if target == "-" {
+		target = "a.out"
+	}
+	err = writeOutput(target, 0o777, func(w io.Writer) error {
+		return amd64.Build(w, tree)
+	})
+	if err != nil {
+		fmt.Fprintln(os.Stderr, "tinycompiler:", err)
+		return exitErrors
+	}
+	return exitOK
+}
@@ -0,0 +1,199 @@
+package main
+
+import (
+	"bytes"
+	"errors"
+	"io"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// runMainEnv makes the test binary run the command instead of the tests
+const runMainEnv = "TINYCOMPILER_RUN_MAIN"
+
+func TestMain(m *testing.M) {
+	if os.Getenv(runMainEnv) != "" {
+		main()
+	}
+	os.Exit(m.Run())
+}
+
+// sources are written to the directory the commands run in
+var sources = map[string]string{
+	"prog.tny":    "read x;\nwrite x * 2\n",
+	"lexical.tny": "x := 1 $ 2;\nwrite x\n",
+	"syntax.tny":  "x := ;\nwrite 1\n",
+	"divide.tny":  "write 1;\nwrite 1 / 0\n",
+	"fold.tny":    "x := 2 + 3;\nwrite x\n",
+}
+
+// workDir returns a temporary directory holding sources
+func workDir(t *testing.T) string {
+	t.Helper()
+	dir := t.TempDir()
+	for name, src := range sources {
+		if err := os.WriteFile(filepath.Join(dir, name), []byte(src), 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	return dir
+}
+
+// tinycompiler runs the command in dir with the given arguments and input
+// and returns what it wrote to standard output and standard error and its
+// exit status
+func tinycompiler(t *testing.T, dir, input string, args ...string) (string, string, int) {
+	t.Helper()
+	exe, err := os.Executable()
+	if err != nil {
+		t.Fatal(err)
+	}
+	cmd := exec.Command(exe, args...)
+	cmd.Dir = dir
+	cmd.Env = append(os.Environ(), runMainEnv+"=1")
+	cmd.Stdin = strings.NewReader(input)
+	var stdout, stderr bytes.Buffer
+	cmd.Stdout, cmd.Stderr = &stdout, &stderr
+	err = cmd.Run()
+	var exit *exec.ExitError
+	switch {
+	case errors.As(err, &exit):
+		return stdout.String(), stderr.String(), exit.ExitCode()
+	case err != nil:
+		t.Fatal(err)
+	}
+	return stdout.String(), stderr.String(), exitOK
+}
+
+// TestCommands checks the output and exit status of each command
+func TestCommands(t *testing.T) {
+	tests := []struct {
+		name   string
+		args   []string
+		input  string
+		status int
+		stdout string // Text standard output must contain
+		stderr string // Text standard error must contain; empty if none
+	}{
+		{"no command", nil, "", exitUsage, "", "usage: tinycompiler <command>"},
+		{"help", []string{"help"}, "", exitOK, "", "Commands:"},
+		{"unknown command", []string{"frob", "prog.tny"}, "", exitUsage, "", `unknown command "frob"`},
+		{"scan", []string{"scan", "prog.tny"}, "", exitOK, "x, IDENTIFIER\n;, SEMICOLON\n", ""},
+		{"scan error", []string{"scan", "lexical.tny"}, "", exitErrors, "$, ERROR\n",
+			"lexical.tny [1:8] error[L003]"},
+		{"parse", []string{"parse", "prog.tny"}, "", exitOK, "Read: x\nWrite\n  Op: *\n", ""},
+		{"parse error keeps tree", []string{"parse", "syntax.tny"}, "", exitErrors, "Assign to: x\n  Error\nWrite\n",
+			"syntax.tny [1:6] error[P001]"},
+		{"check", []string{"check", "prog.tny"}, "", exitOK, "", ""},
+		{"check error", []string{"check", "lexical.tny"}, "", exitErrors, "", "lexical.tny [1:8] error[L003]"},
+		{"gcc format", []string{"check", "-format", "gcc", "syntax.tny"}, "", exitErrors, "",
+			"syntax.tny:1:6: error: "},
+		{"json format", []string{"check", "-format", "json", "syntax.tny"}, "", exitErrors, "",
+			`"code": "P001",`},
+		{"unknown format", []string{"check", "-format", "xml", "prog.tny"}, "", exitUsage, "",
+			`unknown diagnostic format "xml"`},
+		{"missing file", []string{"check", "missing.tny"}, "", exitUsage, "", "missing.tny"},
+		{"two files", []string{"check", "prog.tny", "prog.tny"}, "", exitUsage, "", "usage: tinycompiler check"},
+		{"standard input", []string{"check", "-"}, "x := ;\nwrite 1", exitErrors, "", "<stdin> [1:6] error[P001]"},
+		{"symtab", []string{"symtab", "prog.tny"}, "", exitOK, "Symbol table:", ""},
+		{"ir", []string{"ir", "prog.tny"}, "", exitOK, "t1 = x * 2", ""},
+		{"cfg", []string{"cfg", "-stage", "dom", "prog.tny"}, "", exitOK, "B0 (entry)", ""},
+		{"unknown stage", []string{"cfg", "-stage", "x", "prog.tny"}, "", exitUsage, "", `unknown stage "x"`},
+		{"run", []string{"run", "prog.tny"}, "21", exitOK, "42\n", ""},
+		{"run in the VM", []string{"run", "-vm", "prog.tny"}, "21", exitOK, "42\n", ""},
+		{"runtime error", []string{"run", "divide.tny"}, "", exitErrors, "1\n", "divide.tny [2:7] error[R001]"},
+		{"runtime error in the VM", []string{"run", "-vm", "divide.tny"}, "", exitErrors, "1\n",
+			"divide.tny [2:7] error[R001]"},
+		{"optimizer trace", []string{"run", "-O2", "-print-passes", "fold.tny"}, "", exitOK, "5\n",
+			"After fold (round 1):\nAssign to: x\n  Const: 5\n"},
+		{"unknown target", []string{"compile", "-target", "x", "prog.tny"}, "", exitUsage, "", `unknown target "x"`},
+		{"tm has no format flag", []string{"tm", "-format", "json", "prog.tm"}, "", exitUsage, "",
+			"flag provided but not defined: -format"},
+	}
+	dir := workDir(t)
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			stdout, stderr, status := tinycompiler(t, dir, tt.input, tt.args...)
+			if status != tt.status {
+				t.Errorf("exit status %d, want %d\n%s", status, tt.status, stderr)
+			}
+			if !strings.Contains(stdout, tt.stdout) {
+				t.Errorf("standard output lacks %q:\n%s", tt.stdout, stdout)
+			}
+			if tt.stderr == "" && stderr != "" || !strings.Contains(stderr, tt.stderr) {
+				t.Errorf("standard error %q, want %q", stderr, tt.stderr)
+			}
+		})
+	}
+}
+
+// TestCompile checks where compile and build write their output, that the
+// simulator runs it, and that failures leave no output file behind
+func TestCompile(t *testing.T) {
+	dir := workDir(t)
+	exists := func(name string) bool {
+		_, err := os.Stat(filepath.Join(dir, name))
+		return err == nil
+	}
+
+	if _, stderr, status := tinycompiler(t, dir, "", "compile", "prog.tny"); status != exitOK {
+		t.Fatalf("compile: exit status %d\n%s", status, stderr)
+	}
+	if stdout, stderr, status := tinycompiler(t, dir, "21", "tm", "prog.tm"); status != exitOK || stdout != "42\n" {
+		t.Errorf("tm: exit status %d, wrote %q\n%s", status, stdout, stderr)
+	}
+
+	if _, stderr, status := tinycompiler(t, dir, "", "compile", "-target", "c", "-o", "out.c", "prog.tny"); status != exitOK || !exists("out.c") {
+		t.Errorf("compile -o out.c: exit status %d\n%s", status, stderr)
+	}
+	if exists("prog.c") {
+		t.Error("compile -o also wrote the default output file")
+	}
+	if stdout, _, status := tinycompiler(t, dir, "", "compile", "-o", "-", "prog.tny"); status != exitOK || !strings.Contains(stdout, "HALT") {
+		t.Errorf("compile -o -: exit status %d, wrote %q", status, stdout)
+	}
+
+	if _, _, status := tinycompiler(t, dir, "", "compile", "-o", "lexical.tm", "lexical.tny"); status != exitErrors || exists("lexical.tm") {
+		t.Errorf("compiling a program with errors: exit status %d, output written: %v", status, exists("lexical.tm"))
+	}
+	if _, stderr, status := tinycompiler(t, dir, "", "compile", "-o", filepath.Join("missing", "prog.tm"), "prog.tny"); status != exitErrors {
+		t.Errorf("output in a missing directory: exit status %d\n%s", status, stderr)
+	}
+
+	if _, stderr, status := tinycompiler(t, dir, "", "build", "prog.tny"); status != exitOK {
+		t.Errorf("build: exit status %d\n%s", status, stderr)
+	} else if info, err := os.Stat(filepath.Join(dir, "prog")); err != nil || info.Mode()&0o100 == 0 {
+		t.Errorf("build left no executable: %v", err)
+	}
+}
+
+// TestWriteOutput checks that a failed write removes the output file, even
+// one that existed before
+func TestWriteOutput(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "out.tm")
+	if err := os.WriteFile(path, []byte("old"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	failure := errors.New("generation failed")
+	err := writeOutput(path, 0o666, func(w io.Writer) error {
+		io.WriteString(w, "partial")
+		return failure
+	})
+	if err != failure {
+		t.Errorf("writeOutput returned %v, want %v", err, failure)
+	}
+	if _, err := os.Stat(path); !os.IsNotExist(err) {
+		t.Errorf("output left behind: %v", err)
+	}
+
+	err = writeOutput(path, 0o666, func(w io.Writer) error {
+		_, err := io.WriteString(w, "code")
+		return err
+	})
+	if data, rerr := os.ReadFile(path); err != nil || rerr != nil || string(data) != "code" {
+		t.Errorf("writeOutput wrote %q: %v, %v", data, err, rerr)
+	}
+}
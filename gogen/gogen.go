@@ -0,0 +1,404 @@
+// Package gogen translates TINY programs to Go. The output is a complete
+// main package, formatted with go/format, in which every variable is a
+// package-level int and every statement is preceded by a comment naming its
+// source line.
+package gogen
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"go/format"
+	"go/token"
+	"io"
+	"math/big"
+	"strings"
+
+	"tinycompiler/tiny"
+)
+
+// Options control code generation
+type Options struct {
+	File string // Source file name used in the header and line comments
+}
+
+// generator holds the state of a code generation run
+type generator struct {
+	buf  bytes.Buffer
+	file string
+	err  error
+}
+
+// runtime holds the declarations that the generated main function uses
+const runtime = `
+import (
+	"bufio"
+	"fmt"
+	"os"
+)
+
+var (
+	in  = bufio.NewReader(os.Stdin)
+	out = bufio.NewWriter(os.Stdout)
+)
+
+// fail reports a runtime error and exits
+func fail(format string, args ...any) {
+	out.Flush()
+	fmt.Fprintf(os.Stderr, "runtime error: "+format+"\n", args...)
+	os.Exit(1)
+}
+
+func read(line int) int {
+	var v int
+	if _, err := fmt.Fscan(in, &v); err != nil {
+		fail("read expected an integer at line %d", line)
+	}
+	return v
+}
+
+func write(v int) {
+	fmt.Fprintln(out, v)
+}
+
+func div(a, b, line int) int {
+	if b == 0 {
+		fail("division by zero at line %d", line)
+	}
+	return a / b
+}
+
+// b2i converts the result of a comparison to an integer
+func b2i(b bool) int {
+	if b {
+		return 1
+	}
+	return 0
+}
+`
+
+// Generate writes a Go program equivalent to the program rooted at tree.
+// If table is nil it is built from the tree.
+func Generate(w io.Writer, tree *tiny.TreeNode, table *tiny.SymbolTable, opts Options) error {
+	if table == nil {
+		table, _ = tiny.BuildSymtab(tree)
+	}
+	g := &generator{file: opts.File}
+
+	if opts.File != "" {
+		g.printf("// Code generated by tinycompiler from %s. DO NOT EDIT.\n\n", opts.File)
+	} else {
+		g.printf("// Code generated by tinycompiler. DO NOT EDIT.\n\n")
+	}
+	g.printf("package main\n%s\n", runtime)
+	if table.Len() > 0 {
+		g.printf("var (\n")
+		for _, sym := range table.Symbols() {
+			g.printf("%s int\n", ident(sym.Name))
+		}
+		g.printf(")\n\n")
+	}
+	g.printf("func main() {\n")
+	g.printf("defer out.Flush()\n")
+	g.stmtSeq(tree)
+	g.printf("}\n")
+	if g.err != nil {
+		return g.err
+	}
+
+	src, err := format.Source(g.buf.Bytes())
+	if err != nil {
+		return fmt.Errorf("formatting generated code: %v", err)
+	}
+	_, err = w.Write(src)
+	return err
+}
+
+func (g *generator) printf(format string, args ...any) {
+	fmt.Fprintf(&g.buf, format, args...)
+}
+
+func (g *generator) fail(node *tiny.TreeNode, msg string) {
+	if g.err != nil {
+		return
+	}
+	if node != nil {
+		msg = fmt.Sprintf("line %d: %s", node.LineNum, msg)
+	}
+	g.err = errors.New(msg)
+}
+
+// reserved holds the package-level names of the runtime and the imported
+// packages, which variables must not redeclare
+var reserved = map[string]bool{
+	"bufio": true, "fmt": true, "os": true,
+	"in": true, "out": true, "fail": true, "read": true, "write": true,
+	"div": true, "main": true,
+}
+
+// ident returns the Go name of a variable. Keywords, predeclared
+// identifiers and runtime names get a trailing underscore, which TINY
+// identifiers never contain.
+func ident(name string) string {
+	if token.IsKeyword(name) || isPredeclared(name) || reserved[name] {
+		return name + "_"
+	}
+	return name
+}
+
+// predeclared lists the identifiers of Go's universe block
+var predeclared = strings.Fields(`
+	any bool byte comparable complex64 complex128 error float32 float64
+	int int8 int16 int32 int64 rune string uint uint8 uint16 uint32 uint64
+	uintptr true false iota nil append cap clear close complex copy delete
+	imag len make max min new panic print println real recover`)
+
+func isPredeclared(name string) bool {
+	for _, p := range predeclared {
+		if p == name {
+			return true
+		}
+	}
+	return false
+}
+
+// lineComment names the source line of node
+func (g *generator) lineComment(node *tiny.TreeNode) {
+	if g.file == "" {
+		g.printf("// line %d\n", node.LineNum)
+		return
+	}
+	g.printf("// %s:%d\n", g.file, node.LineNum)
+}
+
+func (g *generator) stmtSeq(node *tiny.TreeNode) {
+	for ; node != nil; node = node.Sibling {
+		g.stmt(node)
+	}
+}
+
+func (g *generator) stmt(node *tiny.TreeNode) {
+	if node.NodeKind != tiny.StmtK {
+		g.fail(node, "cannot generate code for a syntax error")
+		return
+	}
+
+	g.lineComment(node)
+	switch node.StmtKind {
+	case tiny.IfK:
+		g.printf("if %s {\n", g.cond(node.Children[0]))
+		g.stmtSeq(node.Children[1])
+		if node.Children[2] != nil {
+			g.printf("} else {\n")
+			g.stmtSeq(node.Children[2])
+		}
+		g.printf("}\n")
+
+	case tiny.RepeatK:
+		g.printf("for {\n")
+		g.stmtSeq(node.Children[0])
+		g.printf("if %s {\nbreak\n}\n", g.cond(node.Children[1]))
+		g.printf("}\n")
+
+	case tiny.WhileK:
+		g.printf("for %s {\n", g.cond(node.Children[0]))
+		g.stmtSeq(node.Children[1])
+		g.printf("}\n")
+
+	case tiny.ForK:
+		// The limit and step are evaluated once, after the start is
+		// assigned. Unless they are constants they are kept in variables
+		// local to the loop, whose underscore keeps them apart from TINY
+		// identifiers.
+		i := ident(node.Name)
+		cmp, update := "<=", "+"
+		if node.Op == "downto" {
+			cmp, update = ">=", "-"
+		}
+		var names, values []string
+		limit := g.exp(node.Children[1])
+		if !isConst(node.Children[1]) {
+			names, values = append(names, "for_limit"), append(values, limit)
+			limit = "for_limit"
+		}
+		step := i + update + update
+		if s := node.Children[2]; s != nil {
+			v := g.exp(s)
+			if !isConst(s) {
+				names, values = append(names, "for_step"), append(values, v)
+				v = "for_step"
+			}
+			step = fmt.Sprintf("%s %s= %s", i, update, v)
+		}
+		init := fmt.Sprintf("%s = %s", i, g.exp(node.Children[0]))
+		if names != nil {
+			g.printf("%s\n", init)
+			init = strings.Join(names, ", ") + " := " + strings.Join(values, ", ")
+		}
+		g.printf("for %s; %s %s %s; %s {\n", init, i, cmp, limit, step)
+		g.stmtSeq(node.Children[3])
+		g.printf("}\n")
+
+	case tiny.AssignK:
+		g.printf("%s = %s\n", ident(node.Name), g.exp(node.Children[0]))
+
+	case tiny.ReadK:
+		g.printf("%s = read(%d)\n", ident(node.Name), node.LineNum)
+
+	case tiny.WriteK:
+		g.printf("write(%s)\n", g.exp(node.Children[0]))
+	}
+}
+
+// isConst reports whether node is a constant
+func isConst(node *tiny.TreeNode) bool {
+	return node != nil && node.NodeKind == tiny.ExpK && node.ExpKind == tiny.ConstK
+}
+
+// comparisons maps TINY comparison operators to Go ones
+var comparisons = map[string]string{
+	"<":  "<",
+	">":  ">",
+	"<=": "<=",
+	">=": ">=",
+	"=":  "==",
+	"<>": "!=",
+}
+
+// cond returns node as a Go boolean expression. Go's && and || short
+// circuit like TINY's and and or.
+func (g *generator) cond(node *tiny.TreeNode) string {
+	if node != nil && node.NodeKind == tiny.ExpK {
+		switch {
+		case node.ExpKind == tiny.UnaryK && node.Op == "not":
+			return "!(" + g.cond(node.Children[0]) + ")"
+		case node.ExpKind == tiny.OpK && node.Op == "and":
+			return g.condOperand(node.Children[0]) + " && " + g.condOperand(node.Children[1])
+		case node.ExpKind == tiny.OpK && node.Op == "or":
+			return g.cond(node.Children[0]) + " || " + g.cond(node.Children[1])
+		case node.ExpKind == tiny.OpK && comparisons[node.Op] != "":
+			return g.exp(node.Children[0]) + " " + comparisons[node.Op] + " " + g.exp(node.Children[1])
+		}
+	}
+	return g.exp(node) + " != 0"
+}
+
+// condOperand returns node as an operand of &&, in parentheses if it is an
+// or, which binds less tightly
+func (g *generator) condOperand(node *tiny.TreeNode) string {
+	if node != nil && node.NodeKind == tiny.ExpK && node.ExpKind == tiny.OpK && node.Op == "or" {
+		return "(" + g.cond(node) + ")"
+	}
+	return g.cond(node)
+}
+
+// constValue returns the exact value of node if Go would evaluate it as an
+// untyped constant, or nil otherwise
+func constValue(node *tiny.TreeNode) *big.Int {
+	if node == nil || node.NodeKind != tiny.ExpK {
+		return nil
+	}
+	switch node.ExpKind {
+	case tiny.ConstK:
+		return big.NewInt(int64(node.Value))
+	case tiny.UnaryK:
+		v := constValue(node.Children[0])
+		if v == nil {
+			return nil
+		}
+		switch node.Op {
+		case "-":
+			return v.Neg(v)
+		case "+":
+			return v
+		}
+	case tiny.OpK:
+		l, r := constValue(node.Children[0]), constValue(node.Children[1])
+		if l == nil || r == nil {
+			return nil
+		}
+		switch node.Op {
+		case "+":
+			return l.Add(l, r)
+		case "-":
+			return l.Sub(l, r)
+		case "*":
+			return l.Mul(l, r)
+		}
+	}
+	return nil
+}
+
+// precedence gives the Go precedence of the arithmetic operators; division
+// is a call and needs no parentheses
+var precedence = map[string]int{
+	"+": 4,
+	"-": 4,
+	"*": 5,
+}
+
+// unaryPrec is the precedence of Go's unary operators, which bind tighter
+// than any binary one
+const unaryPrec = 6
+
+// exp returns node as a Go int expression
+func (g *generator) exp(node *tiny.TreeNode) string {
+	return g.operand(node, 0, false)
+}
+
+// operand returns node as an operand of an operator with precedence prec,
+// in parentheses if Go would otherwise group it differently. right is set
+// for right operands, which need parentheses at equal precedence.
+func (g *generator) operand(node *tiny.TreeNode, prec int, right bool) string {
+	if node == nil || node.NodeKind != tiny.ExpK {
+		g.fail(node, "cannot generate code for a syntax error")
+		return "0"
+	}
+
+	// Go rejects constant expressions that overflow int, where TINY
+	// arithmetic wraps around, so such expressions are folded here
+	if v := constValue(node); v != nil && !v.IsInt64() {
+		wrapped := new(big.Int).And(v, new(big.Int).SetUint64(1<<64-1))
+		return fmt.Sprint(int64(wrapped.Uint64()))
+	}
+
+	switch node.ExpKind {
+	case tiny.ConstK:
+		return fmt.Sprint(node.Value)
+
+	case tiny.IdK:
+		return ident(node.Name)
+
+	case tiny.UnaryK:
+		switch node.Op {
+		case "not":
+			return fmt.Sprintf("b2i(%s)", g.cond(node))
+		case "-", "+":
+			// Keep - -x from being scanned as the -- operator
+			x := g.operand(node.Children[0], unaryPrec, false)
+			if strings.HasPrefix(x, node.Op) {
+				return node.Op + " " + x
+			}
+			return node.Op + x
+		}
+		g.fail(node, "unknown operator "+node.Op)
+
+	case tiny.OpK:
+		switch node.Op {
+		case "+", "-", "*":
+			p := precedence[node.Op]
+			s := g.operand(node.Children[0], p, false) + " " + node.Op + " " + g.operand(node.Children[1], p, true)
+			if p < prec || (right && p == prec) {
+				return "(" + s + ")"
+			}
+			return s
+		case "/":
+			return fmt.Sprintf("div(%s, %s, %d)", g.exp(node.Children[0]), g.exp(node.Children[1]), node.LineNum)
+		case "<", ">", "<=", ">=", "=", "<>", "and", "or":
+			return fmt.Sprintf("b2i(%s)", g.cond(node))
+		default:
+			g.fail(node, "unknown operator "+node.Op)
+		}
+	}
+	return "0"
+}
@@ -0,0 +1,145 @@
+package gogen
+
+import (
+	"bytes"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"tinycompiler/tiny/tinytest"
+)
+
+// generate translates src to Go, failing the test on any error
+func generate(t *testing.T, src string, opts Options) string {
+	t.Helper()
+	var b strings.Builder
+	if err := Generate(&b, tinytest.Parse(t, src), nil, opts); err != nil {
+		t.Fatal(err)
+	}
+	return b.String()
+}
+
+// TestGenerate checks the translation of a whole program
+func TestGenerate(t *testing.T) {
+	src := "read x;\nif x < 10 then\n  write (x + 1) * 2 / x\nelse\n  repeat x := x - 1 until x = 0\nend"
+	got := generate(t, src, Options{File: "prog.tny"})
+	if !strings.HasPrefix(got, "// Code generated by tinycompiler from prog.tny. DO NOT EDIT.\n\npackage main\n") {
+		t.Errorf("missing header:\n%s", got)
+	}
+	want := `var (
+	x int
+)
+
+func main() {
+	defer out.Flush()
+	// prog.tny:1
+	x = read(1)
+	// prog.tny:2
+	if x < 10 {
+		// prog.tny:3
+		write(div((x+1)*2, x, 3))
+	} else {
+		// prog.tny:5
+		for {
+			// prog.tny:5
+			x = x - 1
+			if x == 0 {
+				break
+			}
+		}
+	}
+}
+`
+	if i := strings.Index(got, "var (\n\tx int"); i < 0 || got[i:] != want {
+		t.Errorf("got:\n%s\nwant:\n%s", got, want)
+	}
+}
+
+// TestExpressions checks operator precedence, renamed variables and
+// constants that overflow
+func TestExpressions(t *testing.T) {
+	tests := []struct {
+		src  string
+		want string
+	}{
+		{"write 1 + 2 * 3", "write(1 + 2*3)"},
+		{"write (1 + 2) * 3", "write((1 + 2) * 3)"},
+		{"write 10 - (4 - 3)", "write(10 - (4 - 3))"},
+		{"write 10 - 4 - 3", "write(10 - 4 - 3)"},
+		{"write x / (y / 2)", "write(div(x, div(y, 2, 1), 1))"},
+		{"if x <> 1 then write x end", "if x != 1 {"},
+		{"if x * 2 >= y + 1 then write x end", "if x*2 >= y+1 {"},
+		{"int := 1; write int", "int_ = 1"},
+		{"div := 2; write 6 / div", "write(div(6, div_, 1))"},
+		{"type := 1", "type_ = 1"},
+		{"write - -x", "write(- -x)"},
+		{"write + +x", "write(+ +x)"},
+		{"write +-x", "write(+-x)"},
+		{"write -(x + 1) * 2", "write(-(x + 1) * 2)"},
+		{"write -x * -y", "write(-x * -y)"},
+		{"write -9223372036854775807 - 2", "write(9223372036854775807)"},
+		{"write - -9223372036854775807 - 1", "write(- -9223372036854775807 - 1)"},
+		{"write 9223372036854775807 + 1", "write(-9223372036854775808)"},
+		{"write 4294967296 * 4294967296", "write(0)"},
+	}
+	for _, tt := range tests {
+		if got := generate(t, tt.src, Options{}); !strings.Contains(got, "\t"+tt.want+"\n") {
+			t.Errorf("%q: output lacks %q:\n%s", tt.src, tt.want, got[strings.Index(got, "func main"):])
+		}
+	}
+}
+
+// TestBuildAndRun builds the output with the go command and checks how it
+// reports runtime errors. The shared programs of package tinytest check
+// the rest.
+func TestBuildAndRun(t *testing.T) {
+	if testing.Short() {
+		t.Skip("builds Go programs")
+	}
+	goTool, err := exec.LookPath("go")
+	if err != nil {
+		t.Skip("no go command")
+	}
+	tests := []struct {
+		name   string
+		src    string
+		input  string
+		want   string
+		stderr string // Runtime error message, if the program fails
+	}{
+		{"division by zero", "write 1;\nwrite 1 / 0", "", "1\n", "runtime error: division by zero at line 2\n"},
+		{"bad input", "read x", "abc", "", "runtime error: read expected an integer at line 1\n"},
+	}
+	dir := t.TempDir()
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			src := filepath.Join(dir, strings.ReplaceAll(tt.name, " ", "_")+".go")
+			if err := os.WriteFile(src, []byte(generate(t, tt.src, Options{File: "prog.tny"})), 0o644); err != nil {
+				t.Fatal(err)
+			}
+			exe := strings.TrimSuffix(src, ".go")
+			build := exec.Command(goTool, "build", "-o", exe, src)
+			build.Dir = dir
+			if out, err := build.CombinedOutput(); err != nil {
+				t.Fatalf("%v:\n%s", err, out)
+			}
+
+			cmd := exec.Command(exe)
+			cmd.Stdin = strings.NewReader(tt.input)
+			var stdout, stderr bytes.Buffer
+			cmd.Stdout, cmd.Stderr = &stdout, &stderr
+			err := cmd.Run()
+			if stdout.String() != tt.want {
+				t.Errorf("wrote %q, want %q", stdout.String(), tt.want)
+			}
+			if stderr.String() != tt.stderr {
+				t.Errorf("stderr %q, want %q", stderr.String(), tt.stderr)
+			}
+			if (err != nil) != (tt.stderr != "") {
+				t.Errorf("exit status %v", err)
+			}
+		})
+	}
+}
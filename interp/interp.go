@@ -0,0 +1,236 @@
+// Package interp runs TINY programs by walking their syntax tree.
+package interp
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+
+	"tinycompiler/tiny"
+)
+
+// Interpreter executes a syntax tree. Variables start at 0, read takes
+// integers from the input and write prints one integer per line.
+type Interpreter struct {
+	in   *bufio.Reader
+	out  io.Writer
+	vars map[string]int
+}
+
+// New creates an interpreter that reads from in and writes to out
+func New(in io.Reader, out io.Writer) *Interpreter {
+	return &Interpreter{
+		in:   bufio.NewReader(in),
+		out:  out,
+		vars: make(map[string]int),
+	}
+}
+
+// Vars returns the variables set by the program so far
+func (it *Interpreter) Vars() map[string]int {
+	return it.vars
+}
+
+// Run executes the program rooted at tree. Runtime errors are returned as
+// tiny.Diagnostic values pointing at the offending node.
+func (it *Interpreter) Run(tree *tiny.TreeNode) error {
+	return it.execSeq(tree)
+}
+
+func (it *Interpreter) execSeq(node *tiny.TreeNode) error {
+	for ; node != nil; node = node.Sibling {
+		if err := it.exec(node); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (it *Interpreter) exec(node *tiny.TreeNode) error {
+	if node.NodeKind != tiny.StmtK {
+		return runtimeError(node, tiny.CodeBadProgram, "program contains syntax errors")
+	}
+
+	switch node.StmtKind {
+	case tiny.IfK:
+		test, err := it.eval(node.Children[0])
+		if err != nil {
+			return err
+		}
+		if test != 0 {
+			return it.execSeq(node.Children[1])
+		}
+		return it.execSeq(node.Children[2])
+
+	case tiny.RepeatK:
+		for {
+			if err := it.execSeq(node.Children[0]); err != nil {
+				return err
+			}
+			test, err := it.eval(node.Children[1])
+			if err != nil {
+				return err
+			}
+			if test != 0 {
+				return nil
+			}
+		}
+
+	case tiny.WhileK:
+		for {
+			test, err := it.eval(node.Children[0])
+			if err != nil {
+				return err
+			}
+			if test == 0 {
+				return nil
+			}
+			if err := it.execSeq(node.Children[1]); err != nil {
+				return err
+			}
+		}
+
+	case tiny.ForK:
+		start, err := it.eval(node.Children[0])
+		if err != nil {
+			return err
+		}
+		it.vars[node.Name] = start
+		limit, err := it.eval(node.Children[1])
+		if err != nil {
+			return err
+		}
+		step := 1
+		if node.Children[2] != nil {
+			if step, err = it.eval(node.Children[2]); err != nil {
+				return err
+			}
+		}
+		if node.Op == "downto" {
+			step = -step
+		}
+		for {
+			if i := it.vars[node.Name]; node.Op == "downto" && i < limit || node.Op != "downto" && i > limit {
+				return nil
+			}
+			if err := it.execSeq(node.Children[3]); err != nil {
+				return err
+			}
+			it.vars[node.Name] += step
+		}
+
+	case tiny.AssignK:
+		value, err := it.eval(node.Children[0])
+		if err != nil {
+			return err
+		}
+		it.vars[node.Name] = value
+
+	case tiny.ReadK:
+		var value int
+		if _, err := fmt.Fscan(it.in, &value); err != nil {
+			return runtimeError(node, tiny.CodeBadInput,
+				fmt.Sprintf("read %s: %v", node.Name, err))
+		}
+		it.vars[node.Name] = value
+
+	case tiny.WriteK:
+		value, err := it.eval(node.Children[0])
+		if err != nil {
+			return err
+		}
+		fmt.Fprintln(it.out, value)
+	}
+	return nil
+}
+
+// eval computes the value of an expression. Comparisons and logical
+// operators give 1 for true and 0 for false, and the right operand of and
+// and or is only evaluated when the left one does not decide the result.
+func (it *Interpreter) eval(node *tiny.TreeNode) (int, error) {
+	if node == nil || node.NodeKind != tiny.ExpK {
+		return 0, runtimeError(node, tiny.CodeBadProgram, "program contains syntax errors")
+	}
+
+	switch node.ExpKind {
+	case tiny.ConstK:
+		return node.Value, nil
+	case tiny.IdK:
+		return it.vars[node.Name], nil
+	case tiny.UnaryK:
+		value, err := it.eval(node.Children[0])
+		if err != nil {
+			return 0, err
+		}
+		switch node.Op {
+		case "not":
+			return boolToInt(value == 0), nil
+		case "-":
+			return -value, nil
+		case "+":
+			return value, nil
+		}
+		return 0, runtimeError(node, tiny.CodeBadProgram, "unknown operator "+node.Op)
+	}
+
+	left, err := it.eval(node.Children[0])
+	if err != nil {
+		return 0, err
+	}
+	if node.Op == "and" && left == 0 || node.Op == "or" && left != 0 {
+		return boolToInt(left != 0), nil
+	}
+	right, err := it.eval(node.Children[1])
+	if err != nil {
+		return 0, err
+	}
+
+	switch node.Op {
+	case "+":
+		return left + right, nil
+	case "-":
+		return left - right, nil
+	case "*":
+		return left * right, nil
+	case "/":
+		if right == 0 {
+			return 0, runtimeError(node, tiny.CodeDivByZero, "division by zero")
+		}
+		return left / right, nil
+	case "<":
+		return boolToInt(left < right), nil
+	case ">":
+		return boolToInt(left > right), nil
+	case "<=":
+		return boolToInt(left <= right), nil
+	case ">=":
+		return boolToInt(left >= right), nil
+	case "=":
+		return boolToInt(left == right), nil
+	case "<>":
+		return boolToInt(left != right), nil
+	case "and", "or":
+		return boolToInt(right != 0), nil
+	}
+	return 0, runtimeError(node, tiny.CodeBadProgram, "unknown operator "+node.Op)
+}
+
+func boolToInt(b bool) int {
+	if b {
+		return 1
+	}
+	return 0
+}
+
+// runtimeError creates the diagnostic for an error while running node
+func runtimeError(node *tiny.TreeNode, code, msg string) tiny.Diagnostic {
+	d := tiny.Diagnostic{
+		Severity: tiny.SeverityError,
+		Code:     code,
+		Message:  msg,
+	}
+	if node != nil {
+		d.Span = node.Span
+	}
+	return d
+}
@@ -0,0 +1,70 @@
+package interp
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"strings"
+	"testing"
+
+	"tinycompiler/tiny"
+	"tinycompiler/tiny/tinytest"
+)
+
+// run interprets src with the given input and returns what it wrote
+func run(t *testing.T, src, input string) (string, error) {
+	t.Helper()
+	var out bytes.Buffer
+	err := New(strings.NewReader(input), &out).Run(tinytest.Parse(t, src))
+	return strings.Join(strings.Fields(out.String()), " "), err
+}
+
+// TestRuntimeErrors checks the diagnostics of programs that fail, and that
+// output before the failure is kept
+func TestRuntimeErrors(t *testing.T) {
+	tests := []struct {
+		name  string
+		src   string
+		input string
+		want  string // Output before the error
+		code  string
+		at    string
+	}{
+		{"division by zero", "write 1;\nx := 4 / (2 - 2);\nwrite 2", "", "1", tiny.CodeDivByZero, "2:6"},
+		{"division by variable", "read y;\nwrite 10 / y", "0", "", tiny.CodeDivByZero, "2:7"},
+		{"missing input", "read x; write x; read y", "3", "3", tiny.CodeBadInput, "1:18"},
+		{"bad input", "read x", "abc", "", tiny.CodeBadInput, "1:1"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := run(t, tt.src, tt.input)
+			d, ok := err.(tiny.Diagnostic)
+			if !ok {
+				t.Fatalf("error %v is not a diagnostic", err)
+			}
+			if at := fmt.Sprintf("%d:%d", d.Span.Start.Line, d.Span.Start.Column); d.Code != tt.code || at != tt.at {
+				t.Errorf("got %s at %s, want %s at %s", d.Code, at, tt.code, tt.at)
+			}
+			if got != tt.want {
+				t.Errorf("wrote %q, want %q", got, tt.want)
+			}
+		})
+	}
+
+	bad := &tiny.TreeNode{NodeKind: tiny.ErrorK}
+	err := New(strings.NewReader(""), io.Discard).Run(bad)
+	if d, ok := err.(tiny.Diagnostic); !ok || d.Code != tiny.CodeBadProgram {
+		t.Errorf("running a syntax error: %v, want %s", err, tiny.CodeBadProgram)
+	}
+}
+
+// TestVars checks the variables left by a run
+func TestVars(t *testing.T) {
+	it := New(strings.NewReader("5"), io.Discard)
+	if err := it.Run(tinytest.Parse(t, "read x; y := x * 2")); err != nil {
+		t.Fatal(err)
+	}
+	if got := it.Vars(); len(got) != 2 || got["x"] != 5 || got["y"] != 10 {
+		t.Errorf("Vars() = %v, want x=5 y=10", got)
+	}
+}
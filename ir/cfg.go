@@ -0,0 +1,192 @@
+package ir
+
+import (
+	"fmt"
+	"strconv"
+)
+
+// Block is a basic block: a sequence of instructions entered only at the
+// top and left only at the bottom
+type Block struct {
+	Index int
+	Phis  []Phi   // Phi functions, in SSA form only
+	Code  []Instr // A leading OpLabel, if any, and a trailing jump, if any
+	Succs []*Block
+	Preds []*Block
+
+	// Dominator information, filled in by ComputeDominators
+	Idom     *Block   // Immediate dominator; nil for the entry
+	Children []*Block // Blocks immediately dominated by this one
+	Frontier []*Block // Dominance frontier
+}
+
+// Phi selects the value of Args[i] when control arrives from Preds[i]
+type Phi struct {
+	Dst  Operand
+	Args []Operand
+}
+
+func (phi Phi) String() string {
+	s := phi.Dst.String() + " = phi("
+	for i, a := range phi.Args {
+		if i > 0 {
+			s += ", "
+		}
+		s += a.String()
+	}
+	return s + ")"
+}
+
+// Name returns the block's name, B followed by its index
+func (b *Block) Name() string {
+	return "B" + strconv.Itoa(b.Index)
+}
+
+// Label returns the label that starts the block, or ""
+func (b *Block) Label() string {
+	if len(b.Code) > 0 && b.Code[0].Op == OpLabel {
+		return b.Code[0].Label
+	}
+	return ""
+}
+
+// terminator returns the jump that ends the block, or nil if control
+// falls through to the next block
+func (b *Block) terminator() *Instr {
+	if n := len(b.Code); n > 0 {
+		switch b.Code[n-1].Op {
+		case OpJump, OpIf, OpIfFalse:
+			return &b.Code[n-1]
+		}
+	}
+	return nil
+}
+
+// CFG is the control-flow graph of a program. Blocks are kept in program
+// order, so a block without a final unconditional jump falls through to the
+// next one. The first block is an empty entry and the last an empty exit,
+// which makes every program block have a predecessor and gives a single
+// place where execution ends.
+type CFG struct {
+	Blocks []*Block
+}
+
+// Entry returns the entry block
+func (g *CFG) Entry() *Block {
+	return g.Blocks[0]
+}
+
+// Exit returns the exit block
+func (g *CFG) Exit() *Block {
+	return g.Blocks[len(g.Blocks)-1]
+}
+
+// BuildCFG splits p into basic blocks and connects them. Blocks that cannot
+// be reached from the entry are left out, and a conditional jump to the
+// next instruction, which has no effect, is dropped.
+func BuildCFG(p *Program) (*CFG, error) {
+	g := &CFG{Blocks: []*Block{{}}}
+	var cur *Block
+	for _, in := range p.Code {
+		if cur == nil || in.Op == OpLabel {
+			cur = &Block{}
+			g.Blocks = append(g.Blocks, cur)
+		}
+		cur.Code = append(cur.Code, in)
+		switch in.Op {
+		case OpJump, OpIf, OpIfFalse:
+			cur = nil
+		}
+	}
+	g.Blocks = append(g.Blocks, &Block{})
+
+	byLabel := map[string]*Block{}
+	for _, b := range g.Blocks {
+		if l := b.Label(); l != "" {
+			byLabel[l] = b
+		}
+	}
+	for i, b := range g.Blocks[:len(g.Blocks)-1] {
+		next := g.Blocks[i+1]
+		t := b.terminator()
+		if t == nil {
+			b.addSucc(next)
+			continue
+		}
+		target := byLabel[t.Label]
+		if target == nil {
+			return nil, fmt.Errorf("undefined label %s", t.Label)
+		}
+		if t.Op != OpJump && target == next {
+			b.Code = b.Code[:len(b.Code)-1]
+			b.addSucc(next)
+			continue
+		}
+		if t.Op != OpJump {
+			b.addSucc(next)
+		}
+		b.addSucc(target)
+	}
+	g.removeUnreachable()
+	return g, nil
+}
+
+// addSucc adds an edge from b to s
+func (b *Block) addSucc(s *Block) {
+	b.Succs = append(b.Succs, s)
+	s.Preds = append(s.Preds, b)
+}
+
+// removeUnreachable drops the blocks that cannot be reached from the entry,
+// except for the exit, and renumbers the rest
+func (g *CFG) removeUnreachable() {
+	reached := map[*Block]bool{}
+	var visit func(b *Block)
+	visit = func(b *Block) {
+		reached[b] = true
+		for _, s := range b.Succs {
+			if !reached[s] {
+				visit(s)
+			}
+		}
+	}
+	visit(g.Entry())
+	reached[g.Exit()] = true
+
+	kept := g.Blocks[:0]
+	for _, b := range g.Blocks {
+		if !reached[b] {
+			continue
+		}
+		preds := b.Preds[:0]
+		for _, p := range b.Preds {
+			if reached[p] {
+				preds = append(preds, p)
+			}
+		}
+		b.Preds = preds
+		b.Index = len(kept)
+		kept = append(kept, b)
+	}
+	g.Blocks = kept
+}
+
+// Program returns the code of the graph as a linear program. The graph
+// must not be in SSA form.
+func (g *CFG) Program() *Program {
+	p := &Program{}
+	for _, b := range g.Blocks {
+		p.Code = append(p.Code, b.Code...)
+	}
+	return p
+}
+
+// predIndex returns the position of p among the predecessors of b
+func (b *Block) predIndex(p *Block) int {
+	for i, q := range b.Preds {
+		if q == p {
+			return i
+		}
+	}
+	return -1
+}
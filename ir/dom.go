@@ -0,0 +1,115 @@
+package ir
+
+// ComputeDominators fills in the immediate dominator, dominator tree
+// children and dominance frontier of every block, using the iterative
+// algorithm of Cooper, Harvey and Kennedy
+func (g *CFG) ComputeDominators() {
+	order := g.reversePostorder()
+	rpo := make(map[*Block]int, len(order))
+	for i, b := range order {
+		rpo[b] = i
+	}
+
+	intersect := func(a, b *Block) *Block {
+		for a != b {
+			for rpo[a] > rpo[b] {
+				a = a.Idom
+			}
+			for rpo[b] > rpo[a] {
+				b = b.Idom
+			}
+		}
+		return a
+	}
+
+	for _, b := range g.Blocks {
+		b.Idom, b.Children, b.Frontier = nil, nil, nil
+	}
+	entry := g.Entry()
+	entry.Idom = entry
+	for changed := true; changed; {
+		changed = false
+		for _, b := range order[1:] {
+			var idom *Block
+			for _, p := range b.Preds {
+				if p.Idom == nil {
+					continue // Not processed yet
+				}
+				if idom == nil {
+					idom = p
+				} else {
+					idom = intersect(p, idom)
+				}
+			}
+			if b.Idom != idom {
+				b.Idom = idom
+				changed = true
+			}
+		}
+	}
+	entry.Idom = nil
+
+	for _, b := range order[1:] {
+		if b.Idom != nil {
+			b.Idom.Children = append(b.Idom.Children, b)
+		}
+	}
+
+	// A join point is in the frontier of every block that dominates one
+	// of its predecessors but not the join point itself
+	for _, b := range order {
+		if len(b.Preds) < 2 {
+			continue
+		}
+		for _, p := range b.Preds {
+			for runner := p; runner != nil && runner != b.Idom; runner = runner.Idom {
+				if !containsBlock(runner.Frontier, b) {
+					runner.Frontier = append(runner.Frontier, b)
+				}
+			}
+		}
+	}
+}
+
+// Dominates reports whether a dominates b. Dominators must have been
+// computed.
+func (a *Block) Dominates(b *Block) bool {
+	for ; b != nil; b = b.Idom {
+		if b == a {
+			return true
+		}
+	}
+	return false
+}
+
+// reversePostorder returns the blocks reachable from the entry in reverse
+// postorder of a depth-first search
+func (g *CFG) reversePostorder() []*Block {
+	visited := map[*Block]bool{}
+	var post []*Block
+	var visit func(b *Block)
+	visit = func(b *Block) {
+		visited[b] = true
+		for _, s := range b.Succs {
+			if !visited[s] {
+				visit(s)
+			}
+		}
+		post = append(post, b)
+	}
+	visit(g.Entry())
+
+	for i, j := 0, len(post)-1; i < j; i, j = i+1, j-1 {
+		post[i], post[j] = post[j], post[i]
+	}
+	return post
+}
+
+func containsBlock(blocks []*Block, b *Block) bool {
+	for _, c := range blocks {
+		if c == b {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,130 @@
+package ir
+
+import (
+	"fmt"
+	"io"
+	"strings"
+)
+
+// blockNames returns the names of blocks separated by spaces
+func blockNames(blocks []*Block) string {
+	names := make([]string, len(blocks))
+	for i, b := range blocks {
+		names[i] = b.Name()
+	}
+	return strings.Join(names, " ")
+}
+
+// title returns the name of b, marking the entry and exit
+func (g *CFG) title(b *Block) string {
+	switch b {
+	case g.Entry():
+		return b.Name() + " (entry)"
+	case g.Exit():
+		return b.Name() + " (exit)"
+	}
+	return b.Name()
+}
+
+// lines returns the label, phis and instructions of b, one per line
+func (b *Block) lines() []string {
+	var lines []string
+	code := b.Code
+	if b.Label() != "" {
+		lines = append(lines, code[0].String())
+		code = code[1:]
+	}
+	for _, phi := range b.Phis {
+		lines = append(lines, phi.String())
+	}
+	for _, in := range code {
+		lines = append(lines, in.String())
+	}
+	return lines
+}
+
+// Print writes the blocks of g with their edges and code
+func (g *CFG) Print(w io.Writer) error {
+	for _, b := range g.Blocks {
+		if _, err := fmt.Fprintf(w, "%s  preds: %s  succs: %s\n", g.title(b), blockNames(b.Preds), blockNames(b.Succs)); err != nil {
+			return err
+		}
+		for _, l := range b.lines() {
+			if _, err := fmt.Fprintf(w, "    %s\n", l); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// PrintDominators writes the immediate dominator, dominator tree children
+// and dominance frontier of every block. Dominators must have been computed.
+func (g *CFG) PrintDominators(w io.Writer) error {
+	for _, b := range g.Blocks {
+		idom := "-"
+		if b.Idom != nil {
+			idom = b.Idom.Name()
+		}
+		_, err := fmt.Fprintf(w, "%s  idom: %s  children: %s  frontier: %s\n",
+			g.title(b), idom, blockNames(b.Children), blockNames(b.Frontier))
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// dotLabel returns the Graphviz label of b: its title and code, left aligned
+func (g *CFG) dotLabel(b *Block) string {
+	var sb strings.Builder
+	sb.WriteString(g.title(b) + `\l`)
+	for _, l := range b.lines() {
+		sb.WriteString("  " + l + `\l`)
+	}
+	return strings.NewReplacer(`"`, `\"`).Replace(sb.String())
+}
+
+// Dot writes g in Graphviz format. Conditional jumps are drawn as solid
+// edges and fallthrough from them as dashed ones.
+func (g *CFG) Dot(w io.Writer) error {
+	var sb strings.Builder
+	sb.WriteString("digraph cfg {\n\tnode [shape=box fontname=monospace];\n")
+	for _, b := range g.Blocks {
+		fmt.Fprintf(&sb, "\t%s [label=\"%s\"];\n", b.Name(), g.dotLabel(b))
+	}
+	for _, b := range g.Blocks {
+		t := b.terminator()
+		for _, s := range b.Succs {
+			style := ""
+			if t != nil && t.Op != OpJump && s.Label() != t.Label {
+				style = " [style=dashed]"
+			}
+			fmt.Fprintf(&sb, "\t%s -> %s%s;\n", b.Name(), s.Name(), style)
+		}
+	}
+	sb.WriteString("}\n")
+	_, err := io.WriteString(w, sb.String())
+	return err
+}
+
+// DomDot writes the dominator tree of g in Graphviz format, with the
+// dominance frontiers as dotted edges. Dominators must have been computed.
+func (g *CFG) DomDot(w io.Writer) error {
+	var sb strings.Builder
+	sb.WriteString("digraph dom {\n\tnode [shape=box fontname=monospace];\n")
+	for _, b := range g.Blocks {
+		fmt.Fprintf(&sb, "\t%s [label=\"%s\"];\n", b.Name(), g.dotLabel(b))
+	}
+	for _, b := range g.Blocks {
+		for _, c := range b.Children {
+			fmt.Fprintf(&sb, "\t%s -> %s;\n", b.Name(), c.Name())
+		}
+		for _, f := range b.Frontier {
+			fmt.Fprintf(&sb, "\t%s -> %s [style=dotted constraint=false];\n", b.Name(), f.Name())
+		}
+	}
+	sb.WriteString("}\n")
+	_, err := io.WriteString(w, sb.String())
+	return err
+}
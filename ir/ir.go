@@ -0,0 +1,166 @@
+// Package ir defines a linear three-address code for TINY programs: a list
+// of quadruples with at most one operator each, explicit labels and jumps.
+// Programs are produced from syntax trees by Lower and have a textual form
+// written by Print and read back by Parse:
+//
+//	L1:
+//	    t1 = x * 2              ; line 4
+//	    x = t1                  ; line 4
+//	    iffalse t1 goto L1      ; line 5
+//	    read y                  ; line 6
+//	    write y
+package ir
+
+import (
+	"fmt"
+	"io"
+	"strconv"
+)
+
+// Op is the operation of an instruction
+type Op int
+
+const (
+	OpLabel   Op = iota // Label:
+	OpJump              // goto Label
+	OpIf                // if Args[0] goto Label
+	OpIfFalse           // iffalse Args[0] goto Label
+	OpCopy              // Dst = Args[0]
+	OpAdd               // Dst = Args[0] + Args[1]
+	OpSub               // Dst = Args[0] - Args[1]
+	OpMul               // Dst = Args[0] * Args[1]
+	OpDiv               // Dst = Args[0] / Args[1]
+	OpLt                // Dst = Args[0] < Args[1], 1 or 0
+	OpEq                // Dst = Args[0] == Args[1], 1 or 0
+	OpGt                // Dst = Args[0] > Args[1], 1 or 0
+	OpLe                // Dst = Args[0] <= Args[1], 1 or 0
+	OpGe                // Dst = Args[0] >= Args[1], 1 or 0
+	OpNe                // Dst = Args[0] != Args[1], 1 or 0
+	OpRead              // read Dst
+	OpWrite             // write Args[0]
+)
+
+// binarySymbols gives the operator symbols of the binary operations
+var binarySymbols = map[Op]string{
+	OpAdd: "+",
+	OpSub: "-",
+	OpMul: "*",
+	OpDiv: "/",
+	OpLt:  "<",
+	OpEq:  "==",
+	OpGt:  ">",
+	OpLe:  "<=",
+	OpGe:  ">=",
+	OpNe:  "!=",
+}
+
+// IsBinary reports whether op computes Dst from two operands
+func (op Op) IsBinary() bool {
+	return binarySymbols[op] != ""
+}
+
+// OperandKind tells what an operand refers to
+type OperandKind int
+
+const (
+	None  OperandKind = iota // No operand
+	Const                    // Integer constant
+	Var                      // Program variable
+	Temp                     // Compiler temporary
+)
+
+// Operand is an argument or destination of an instruction
+type Operand struct {
+	Kind    OperandKind
+	Value   int    // Value of a constant
+	Name    string // Name of a variable or temporary
+	Version int    // SSA version of a variable or temporary, written name.N
+}
+
+// ConstOperand returns a constant operand
+func ConstOperand(v int) Operand {
+	return Operand{Kind: Const, Value: v}
+}
+
+// VarOperand returns an operand naming a program variable
+func VarOperand(name string) Operand {
+	return Operand{Kind: Var, Name: name}
+}
+
+// TempOperand returns the operand of temporary number n. Temporaries are
+// written t1, t2, ...; TINY identifiers contain no digits, so they cannot
+// clash with variables.
+func TempOperand(n int) Operand {
+	return Operand{Kind: Temp, Name: "t" + strconv.Itoa(n)}
+}
+
+func (o Operand) String() string {
+	switch o.Kind {
+	case Const:
+		return strconv.Itoa(o.Value)
+	case Var, Temp:
+		if o.Version > 0 {
+			return o.Name + "." + strconv.Itoa(o.Version)
+		}
+		return o.Name
+	}
+	return "_"
+}
+
+// Instr is a single quadruple
+type Instr struct {
+	Op    Op
+	Dst   Operand
+	Args  [2]Operand
+	Label string // Label defined by OpLabel, or the target of a jump
+	Line  int    // Source line, 0 if unknown
+}
+
+func (in Instr) String() string {
+	switch in.Op {
+	case OpLabel:
+		return in.Label + ":"
+	case OpJump:
+		return "goto " + in.Label
+	case OpIf:
+		return fmt.Sprintf("if %v goto %s", in.Args[0], in.Label)
+	case OpIfFalse:
+		return fmt.Sprintf("iffalse %v goto %s", in.Args[0], in.Label)
+	case OpCopy:
+		return fmt.Sprintf("%v = %v", in.Dst, in.Args[0])
+	case OpRead:
+		return "read " + in.Dst.String()
+	case OpWrite:
+		return "write " + in.Args[0].String()
+	}
+	if sym := binarySymbols[in.Op]; sym != "" {
+		return fmt.Sprintf("%v = %v %s %v", in.Dst, in.Args[0], sym, in.Args[1])
+	}
+	return fmt.Sprintf("<bad op %d>", in.Op)
+}
+
+// Program is a lowered TINY program
+type Program struct {
+	Code []Instr
+}
+
+// Print writes the program in its textual form. Instructions are indented
+// under their labels, and each one whose source line is known is followed
+// by a comment giving it, so that Parse restores every Line exactly.
+func (p *Program) Print(w io.Writer) error {
+	for _, in := range p.Code {
+		var err error
+		switch {
+		case in.Op == OpLabel:
+			_, err = fmt.Fprintln(w, in)
+		case in.Line != 0:
+			_, err = fmt.Fprintf(w, "    %-23s ; line %d\n", in, in.Line)
+		default:
+			_, err = fmt.Fprintf(w, "    %v\n", in)
+		}
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,273 @@
+package ir
+
+import (
+	"errors"
+	"fmt"
+
+	"tinycompiler/tiny"
+)
+
+// lowerer holds the state of a lowering pass
+type lowerer struct {
+	prog   *Program
+	temps  int
+	labels int
+	err    error
+}
+
+// Lower translates the program rooted at tree to three-address code
+func Lower(tree *tiny.TreeNode) (*Program, error) {
+	l := &lowerer{prog: &Program{}}
+	l.stmtSeq(tree)
+	if l.err != nil {
+		return nil, l.err
+	}
+	return l.prog, nil
+}
+
+func (l *lowerer) emit(in Instr) {
+	l.prog.Code = append(l.prog.Code, in)
+}
+
+// newTemp returns a fresh temporary
+func (l *lowerer) newTemp() Operand {
+	l.temps++
+	return TempOperand(l.temps)
+}
+
+// newLabel returns a fresh label name
+func (l *lowerer) newLabel() string {
+	l.labels++
+	return fmt.Sprintf("L%d", l.labels)
+}
+
+func (l *lowerer) fail(node *tiny.TreeNode) {
+	if l.err != nil {
+		return
+	}
+	if node == nil {
+		l.err = errors.New("cannot lower a syntax error")
+		return
+	}
+	l.err = fmt.Errorf("line %d: cannot lower a syntax error", node.LineNum)
+}
+
+func (l *lowerer) stmtSeq(node *tiny.TreeNode) {
+	for ; node != nil; node = node.Sibling {
+		l.stmt(node)
+	}
+}
+
+func (l *lowerer) stmt(node *tiny.TreeNode) {
+	if node.NodeKind != tiny.StmtK {
+		l.fail(node)
+		return
+	}
+
+	line := node.LineNum
+	switch node.StmtKind {
+	case tiny.IfK:
+		test := l.exp(node.Children[0])
+		elseLabel := l.newLabel()
+		l.emit(Instr{Op: OpIfFalse, Args: [2]Operand{test}, Label: elseLabel, Line: line})
+		l.stmtSeq(node.Children[1])
+		if node.Children[2] == nil {
+			l.emit(Instr{Op: OpLabel, Label: elseLabel})
+			return
+		}
+		endLabel := l.newLabel()
+		l.emit(Instr{Op: OpJump, Label: endLabel, Line: line})
+		l.emit(Instr{Op: OpLabel, Label: elseLabel})
+		l.stmtSeq(node.Children[2])
+		l.emit(Instr{Op: OpLabel, Label: endLabel})
+
+	case tiny.RepeatK:
+		top := l.newLabel()
+		l.emit(Instr{Op: OpLabel, Label: top})
+		l.stmtSeq(node.Children[0])
+		test := l.exp(node.Children[1])
+		if node.Children[1] != nil {
+			line = node.Children[1].LineNum
+		}
+		l.emit(Instr{Op: OpIfFalse, Args: [2]Operand{test}, Label: top, Line: line})
+
+	case tiny.WhileK:
+		top, end := l.newLabel(), l.newLabel()
+		l.emit(Instr{Op: OpLabel, Label: top})
+		test := l.exp(node.Children[0])
+		l.emit(Instr{Op: OpIfFalse, Args: [2]Operand{test}, Label: end, Line: line})
+		l.stmtSeq(node.Children[1])
+		l.emit(Instr{Op: OpJump, Label: top, Line: line})
+		l.emit(Instr{Op: OpLabel, Label: end})
+
+	case tiny.ForK:
+		i := VarOperand(node.Name)
+		cmp, update := OpLe, OpAdd
+		if node.Op == "downto" {
+			cmp, update = OpGe, OpSub
+		}
+		l.assign(i, node.Children[0], line)
+		limit := l.once(node.Children[1], line)
+		step := ConstOperand(1)
+		if node.Children[2] != nil {
+			step = l.once(node.Children[2], line)
+		}
+		top, end := l.newLabel(), l.newLabel()
+		l.emit(Instr{Op: OpLabel, Label: top})
+		test := l.newTemp()
+		l.emit(Instr{Op: cmp, Dst: test, Args: [2]Operand{i, limit}, Line: line})
+		l.emit(Instr{Op: OpIfFalse, Args: [2]Operand{test}, Label: end, Line: line})
+		l.stmtSeq(node.Children[3])
+		l.emit(Instr{Op: update, Dst: i, Args: [2]Operand{i, step}, Line: line})
+		l.emit(Instr{Op: OpJump, Label: top, Line: line})
+		l.emit(Instr{Op: OpLabel, Label: end})
+
+	case tiny.AssignK:
+		l.assign(VarOperand(node.Name), node.Children[0], line)
+
+	case tiny.ReadK:
+		l.emit(Instr{Op: OpRead, Dst: VarOperand(node.Name), Line: line})
+
+	case tiny.WriteK:
+		v := l.exp(node.Children[0])
+		l.emit(Instr{Op: OpWrite, Args: [2]Operand{v}, Line: line})
+	}
+}
+
+// once returns an operand holding the value node has now, such as the
+// limit of a for loop, which the loop body must not change. A variable is
+// copied to a temporary.
+func (l *lowerer) once(node *tiny.TreeNode, line int) Operand {
+	v := l.exp(node)
+	if v.Kind != Var {
+		return v
+	}
+	t := l.newTemp()
+	l.emit(Instr{Op: OpCopy, Dst: t, Args: [2]Operand{v}, Line: line})
+	return t
+}
+
+// opcodes maps TINY operators to binary operations
+var opcodes = map[string]Op{
+	"+":  OpAdd,
+	"-":  OpSub,
+	"*":  OpMul,
+	"/":  OpDiv,
+	"<":  OpLt,
+	">":  OpGt,
+	"<=": OpLe,
+	">=": OpGe,
+	"=":  OpEq,
+	"<>": OpNe,
+}
+
+// assign stores the value of node in dst. An operation is computed
+// directly into dst rather than through a temporary, except for and and or:
+// they set their result before evaluating the right operand, which may read
+// dst.
+func (l *lowerer) assign(dst Operand, node *tiny.TreeNode, line int) {
+	if node != nil && node.NodeKind == tiny.ExpK && (node.ExpKind == tiny.UnaryK ||
+		node.ExpKind == tiny.OpK && node.Op != "and" && node.Op != "or") {
+		l.op(dst, node)
+		return
+	}
+	l.emit(Instr{Op: OpCopy, Dst: dst, Args: [2]Operand{l.exp(node)}, Line: line})
+}
+
+// exp returns an operand holding the value of node, emitting the code that
+// computes it
+func (l *lowerer) exp(node *tiny.TreeNode) Operand {
+	if node == nil || node.NodeKind != tiny.ExpK {
+		l.fail(node)
+		return ConstOperand(0)
+	}
+
+	switch node.ExpKind {
+	case tiny.ConstK:
+		return ConstOperand(node.Value)
+	case tiny.IdK:
+		return VarOperand(node.Name)
+	case tiny.OpK, tiny.UnaryK:
+		t := l.newTemp()
+		l.op(t, node)
+		return t
+	}
+	return ConstOperand(0)
+}
+
+// op emits the operation at node with its result in dst
+func (l *lowerer) op(dst Operand, node *tiny.TreeNode) {
+	switch {
+	case node.ExpKind == tiny.UnaryK && node.Op == "not":
+		a := l.exp(node.Children[0])
+		l.emit(Instr{Op: OpEq, Dst: dst, Args: [2]Operand{a, ConstOperand(0)}, Line: node.LineNum})
+		return
+	case node.ExpKind == tiny.UnaryK && node.Op == "-":
+		a := l.exp(node.Children[0])
+		l.emit(Instr{Op: OpSub, Dst: dst, Args: [2]Operand{ConstOperand(0), a}, Line: node.LineNum})
+		return
+	case node.ExpKind == tiny.UnaryK && node.Op == "+":
+		l.emit(Instr{Op: OpCopy, Dst: dst, Args: [2]Operand{l.exp(node.Children[0])}, Line: node.LineNum})
+		return
+	case node.ExpKind == tiny.UnaryK:
+		if l.err == nil {
+			l.err = fmt.Errorf("line %d: unknown operator %s", node.LineNum, node.Op)
+		}
+		return
+	case node.Op == "and" || node.Op == "or":
+		l.logical(dst, node)
+		return
+	}
+
+	a := l.exp(node.Children[0])
+	b := l.exp(node.Children[1])
+	op, ok := opcodes[node.Op]
+	if !ok {
+		if l.err == nil {
+			l.err = fmt.Errorf("line %d: unknown operator %s", node.LineNum, node.Op)
+		}
+		return
+	}
+	l.emit(Instr{Op: op, Dst: dst, Args: [2]Operand{a, b}, Line: node.LineNum})
+}
+
+// logical emits an and or or, which only evaluates its right operand when
+// the left one does not decide the result
+func (l *lowerer) logical(dst Operand, node *tiny.TreeNode) {
+	end := l.newLabel()
+	l.truth(dst, node.Children[0])
+	jump := OpIfFalse
+	if node.Op == "or" {
+		jump = OpIf
+	}
+	l.emit(Instr{Op: jump, Args: [2]Operand{dst}, Label: end, Line: node.LineNum})
+	l.truth(dst, node.Children[1])
+	l.emit(Instr{Op: OpLabel, Label: end})
+}
+
+// isBoolean reports whether the value of node is always 1 or 0
+func isBoolean(node *tiny.TreeNode) bool {
+	if node == nil || node.NodeKind != tiny.ExpK {
+		return false
+	}
+	switch node.Op {
+	case "<", ">", "<=", ">=", "=", "<>", "and", "or":
+		return node.ExpKind == tiny.OpK
+	case "not":
+		return node.ExpKind == tiny.UnaryK
+	}
+	return false
+}
+
+// truth sets dst to 1 if node is nonzero, else 0
+func (l *lowerer) truth(dst Operand, node *tiny.TreeNode) {
+	if isBoolean(node) {
+		l.op(dst, node)
+		return
+	}
+	a := l.exp(node)
+	if node == nil {
+		return
+	}
+	l.emit(Instr{Op: OpNe, Dst: dst, Args: [2]Operand{a, ConstOperand(0)}, Line: node.LineNum})
+}
@@ -0,0 +1,183 @@
+package ir
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+)
+
+// symbolOps maps operator symbols back to binary operations
+var symbolOps = map[string]Op{}
+
+func init() {
+	for op, sym := range binarySymbols {
+		symbolOps[sym] = op
+	}
+}
+
+// Parse reads a program in the textual form written by Print. Anything
+// after a ';' is a comment, except that "; line N" gives the source line
+// of the instruction on the same line. Instructions without one get line 0.
+func Parse(r io.Reader) (*Program, error) {
+	p := &Program{}
+	labels := map[string]bool{}
+	sc := bufio.NewScanner(r)
+	lineNo := 0
+	for sc.Scan() {
+		lineNo++
+		text := sc.Text()
+		srcLine := 0
+		if i := strings.IndexByte(text, ';'); i >= 0 {
+			var n int
+			if _, err := fmt.Sscanf(strings.TrimSpace(text[i+1:]), "line %d", &n); err == nil {
+				srcLine = n
+			}
+			text = text[:i]
+		}
+		fields := strings.Fields(text)
+		if len(fields) == 0 {
+			continue
+		}
+
+		in, err := parseInstr(fields)
+		if err != nil {
+			return nil, fmt.Errorf("line %d: %v", lineNo, err)
+		}
+		if in.Op == OpLabel {
+			if labels[in.Label] {
+				return nil, fmt.Errorf("line %d: label %s defined twice", lineNo, in.Label)
+			}
+			labels[in.Label] = true
+		} else {
+			in.Line = srcLine
+		}
+		p.Code = append(p.Code, in)
+	}
+	if err := sc.Err(); err != nil {
+		return nil, err
+	}
+
+	for _, in := range p.Code {
+		if in.Op != OpLabel && in.Label != "" && !labels[in.Label] {
+			return nil, fmt.Errorf("undefined label %s", in.Label)
+		}
+	}
+	return p, nil
+}
+
+// parseInstr parses the fields of one instruction
+func parseInstr(f []string) (Instr, error) {
+	var in Instr
+	var err error
+	switch {
+	case len(f) == 1 && strings.HasSuffix(f[0], ":"):
+		in.Op, in.Label = OpLabel, strings.TrimSuffix(f[0], ":")
+		if !isName(in.Label) {
+			return in, fmt.Errorf("bad label %q", in.Label)
+		}
+		return in, nil
+
+	case len(f) == 2 && f[0] == "goto":
+		in.Op, in.Label = OpJump, f[1]
+
+	case len(f) == 4 && (f[0] == "if" || f[0] == "iffalse") && f[2] == "goto":
+		in.Op, in.Label = OpIf, f[3]
+		if f[0] == "iffalse" {
+			in.Op = OpIfFalse
+		}
+		in.Args[0], err = parseOperand(f[1])
+
+	case len(f) == 2 && f[0] == "read":
+		in.Op = OpRead
+		in.Dst, err = parseDst(f[1])
+
+	case len(f) == 2 && f[0] == "write":
+		in.Op = OpWrite
+		in.Args[0], err = parseOperand(f[1])
+
+	case len(f) == 3 && f[1] == "=":
+		in.Op = OpCopy
+		if in.Dst, err = parseDst(f[0]); err == nil {
+			in.Args[0], err = parseOperand(f[2])
+		}
+
+	case len(f) == 5 && f[1] == "=":
+		op, ok := symbolOps[f[3]]
+		if !ok {
+			return in, fmt.Errorf("unknown operator %q", f[3])
+		}
+		in.Op = op
+		if in.Dst, err = parseDst(f[0]); err != nil {
+			return in, err
+		}
+		if in.Args[0], err = parseOperand(f[2]); err != nil {
+			return in, err
+		}
+		in.Args[1], err = parseOperand(f[4])
+
+	default:
+		return in, fmt.Errorf("cannot parse %q", strings.Join(f, " "))
+	}
+	if err != nil {
+		return in, err
+	}
+	if in.Label != "" && !isName(in.Label) {
+		return in, fmt.Errorf("bad label %q", in.Label)
+	}
+	return in, nil
+}
+
+// parseOperand parses a constant, or a variable or temporary with an
+// optional version
+func parseOperand(s string) (Operand, error) {
+	if v, err := strconv.Atoi(s); err == nil {
+		return ConstOperand(v), nil
+	}
+	name, version := s, 0
+	if i := strings.LastIndexByte(s, '.'); i >= 0 {
+		v, err := strconv.ParseUint(s[i+1:], 10, 31)
+		if err != nil || v == 0 {
+			return Operand{}, fmt.Errorf("bad version in %q", s)
+		}
+		name, version = s[:i], int(v)
+	}
+	if isTemp(name) {
+		return Operand{Kind: Temp, Name: name, Version: version}, nil
+	}
+	if isName(name) && !strings.ContainsAny(name, "0123456789_") {
+		return Operand{Kind: Var, Name: name, Version: version}, nil
+	}
+	return Operand{}, fmt.Errorf("bad operand %q", s)
+}
+
+// parseDst parses an operand that can be assigned to
+func parseDst(s string) (Operand, error) {
+	o, err := parseOperand(s)
+	if err == nil && o.Kind == Const {
+		err = fmt.Errorf("cannot assign to constant %s", s)
+	}
+	return o, err
+}
+
+// isTemp reports whether s names a temporary: t followed by digits
+func isTemp(s string) bool {
+	if len(s) < 2 || s[0] != 't' {
+		return false
+	}
+	_, err := strconv.ParseUint(s[1:], 10, 0)
+	return err == nil
+}
+
+// isName reports whether s is made of letters, digits and underscores and
+// does not start with a digit
+func isName(s string) bool {
+	for i, c := range s {
+		letter := c >= 'a' && c <= 'z' || c >= 'A' && c <= 'Z' || c == '_'
+		if !letter && (i == 0 || c < '0' || c > '9') {
+			return false
+		}
+	}
+	return s != ""
+}
@@ -0,0 +1,124 @@
+package ir
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+
+	"tinycompiler/tiny/tinytest"
+)
+
+// lower scans, parses, checks and lowers src, failing the test on any error
+func lower(t *testing.T, src string) *Program {
+	t.Helper()
+	p, err := Lower(tinytest.Parse(t, src))
+	if err != nil {
+		t.Fatalf("lower: %v", err)
+	}
+	return p
+}
+
+// printed returns the textual form of p
+func printed(t *testing.T, p *Program) string {
+	t.Helper()
+	var b strings.Builder
+	if err := p.Print(&b); err != nil {
+		t.Fatal(err)
+	}
+	return b.String()
+}
+
+// TestParseRoundTrip checks that Parse reads back exactly what Print
+// writes, source lines included
+func TestParseRoundTrip(t *testing.T) {
+	tests := []struct {
+		name string
+		src  string
+	}{
+		{"straight line", "read x; y := x * 2 + 1;\nwrite y"},
+		{"same line", "read g; read s;\nwrite g / s"},
+		{"if", "read x;\nif x < 0 then\n  x := 0 - x\nelse\n  write 0\nend;\nwrite x"},
+		{"repeat", "read n;\nrepeat\n  n := n - 1\nuntil n = 0"},
+		{"while", "read n;\nwhile n > 0 and not (n = 3) do\n  n := n - 1\nend"},
+		{"for", "for i := 10 downto 1 step 3 do\n  write i\nend"},
+		{"unary", "read x;\nwrite -x; write +x"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			p := lower(t, tt.src)
+			text := printed(t, p)
+			q, err := Parse(strings.NewReader(text))
+			if err != nil {
+				t.Fatalf("parse:\n%s\n%v", text, err)
+			}
+			if !reflect.DeepEqual(q.Code, p.Code) {
+				t.Errorf("parsed code differs:\ngot:  %+v\nwant: %+v", q.Code, p.Code)
+			}
+			if got := printed(t, q); got != text {
+				t.Errorf("printed again:\n%s\nwant:\n%s", got, text)
+			}
+		})
+	}
+}
+
+// TestParseLines checks that an instruction without a line comment gets
+// line 0 instead of the line of the one before it
+func TestParseLines(t *testing.T) {
+	p := &Program{Code: []Instr{
+		{Op: OpRead, Dst: VarOperand("x"), Line: 1},
+		{Op: OpRead, Dst: VarOperand("y"), Line: 1},
+		{Op: OpLabel, Label: "L1"},
+		{Op: OpWrite, Args: [2]Operand{VarOperand("x")}},
+		{Op: OpCopy, Dst: TempOperand(1), Args: [2]Operand{ConstOperand(2)}, Line: 3},
+	}}
+	text := printed(t, p)
+	q, err := Parse(strings.NewReader(text))
+	if err != nil {
+		t.Fatal(err)
+	}
+	var got, want []int
+	for i := range p.Code {
+		got = append(got, q.Code[i].Line)
+		want = append(want, p.Code[i].Line)
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("lines of\n%s\ngot %v, want %v", text, got, want)
+	}
+
+	q, err = Parse(strings.NewReader("; a comment\nread x ; line 7\nwrite x ; not a line\n"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(q.Code) != 2 || q.Code[0].Line != 7 || q.Code[1].Line != 0 {
+		t.Errorf("got %+v, want lines 7 and 0", q.Code)
+	}
+}
+
+// TestParseErrors checks that malformed programs are rejected
+func TestParseErrors(t *testing.T) {
+	tests := []struct {
+		name string
+		src  string
+		want string
+	}{
+		{"undefined label", "goto L1", "undefined label L1"},
+		{"label defined twice", "L1:\nL1:", "line 2: label L1 defined twice"},
+		{"bad label", "1L:", `line 1: bad label "1L"`},
+		{"unknown operator", "x = a % b", `line 1: unknown operator "%"`},
+		{"assign to constant", "read 3", "line 1: cannot assign to constant 3"},
+		{"bad operand", "write x_1", `line 1: bad operand "x_1"`},
+		{"bad version", "write x.0", `line 1: bad version in "x.0"`},
+		{"garbage", "x = = y", `line 1: cannot parse "x = = y"`},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := Parse(strings.NewReader(tt.src))
+			if err == nil {
+				t.Fatalf("Parse(%q) succeeded", tt.src)
+			}
+			if err.Error() != tt.want {
+				t.Errorf("Parse(%q) = %q, want %q", tt.src, err, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,313 @@
+package ir
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// varKey identifies a variable or temporary regardless of its version
+type varKey struct {
+	kind OperandKind
+	name string
+}
+
+func keyOf(o Operand) varKey {
+	return varKey{o.Kind, o.Name}
+}
+
+func (k varKey) operand() Operand {
+	return Operand{Kind: k.kind, Name: k.name}
+}
+
+// isVariable reports whether o is a variable or temporary
+func isVariable(o Operand) bool {
+	return o.Kind == Var || o.Kind == Temp
+}
+
+// ToSSA converts g to static single assignment form. Phi functions are
+// placed at the iterated dominance frontiers of the definitions of every
+// name that is live on entry to some block (semi-pruned SSA), then all
+// definitions and uses are renamed to versions numbered from 1. A use that
+// no definition reaches keeps version 0, standing for the initial value.
+func (g *CFG) ToSSA() {
+	g.ComputeDominators()
+
+	// Find the blocks defining each name, and the names used in a block
+	// before any definition in it
+	var names []varKey
+	defSites := map[varKey][]*Block{}
+	global := map[varKey]bool{}
+	for _, b := range g.Blocks {
+		defined := map[varKey]bool{}
+		for _, in := range b.Code {
+			for _, a := range in.Args {
+				if isVariable(a) && !defined[keyOf(a)] {
+					global[keyOf(a)] = true
+				}
+			}
+			if isVariable(in.Dst) {
+				k := keyOf(in.Dst)
+				if _, seen := defSites[k]; !seen {
+					names = append(names, k)
+				}
+				if !defined[k] {
+					defSites[k] = append(defSites[k], b)
+					defined[k] = true
+				}
+			}
+		}
+	}
+
+	exit := g.Exit()
+	for _, k := range names {
+		if !global[k] {
+			continue
+		}
+		hasPhi := map[*Block]bool{}
+		isDef := map[*Block]bool{}
+		work := append([]*Block(nil), defSites[k]...)
+		for _, b := range work {
+			isDef[b] = true
+		}
+		for len(work) > 0 {
+			b := work[len(work)-1]
+			work = work[:len(work)-1]
+			for _, f := range b.Frontier {
+				if hasPhi[f] || f == exit {
+					continue
+				}
+				hasPhi[f] = true
+				phi := Phi{Dst: k.operand(), Args: make([]Operand, len(f.Preds))}
+				for i := range phi.Args {
+					phi.Args[i] = k.operand()
+				}
+				f.Phis = append(f.Phis, phi)
+				if !isDef[f] {
+					isDef[f] = true
+					work = append(work, f)
+				}
+			}
+		}
+	}
+
+	r := &renamer{counts: map[varKey]int{}, stacks: map[varKey][]int{}}
+	r.rename(g.Entry())
+}
+
+// renamer holds the state of the renaming walk over the dominator tree
+type renamer struct {
+	counts map[varKey]int   // Last version given to each name
+	stacks map[varKey][]int // Versions reaching the current block
+}
+
+func (r *renamer) top(k varKey) int {
+	if s := r.stacks[k]; len(s) > 0 {
+		return s[len(s)-1]
+	}
+	return 0
+}
+
+// define gives o a new version and makes it the reaching one
+func (r *renamer) define(o *Operand, pushed *[]varKey) {
+	k := keyOf(*o)
+	r.counts[k]++
+	o.Version = r.counts[k]
+	r.stacks[k] = append(r.stacks[k], o.Version)
+	*pushed = append(*pushed, k)
+}
+
+func (r *renamer) rename(b *Block) {
+	var pushed []varKey
+	for i := range b.Phis {
+		r.define(&b.Phis[i].Dst, &pushed)
+	}
+	for i := range b.Code {
+		in := &b.Code[i]
+		for j := range in.Args {
+			if isVariable(in.Args[j]) {
+				in.Args[j].Version = r.top(keyOf(in.Args[j]))
+			}
+		}
+		if isVariable(in.Dst) {
+			r.define(&in.Dst, &pushed)
+		}
+	}
+	for _, s := range b.Succs {
+		j := s.predIndex(b)
+		for i := range s.Phis {
+			a := &s.Phis[i].Args[j]
+			a.Version = r.top(keyOf(*a))
+		}
+	}
+	for _, c := range b.Children {
+		r.rename(c)
+	}
+	for _, k := range pushed {
+		r.stacks[k] = r.stacks[k][:len(r.stacks[k])-1]
+	}
+}
+
+// FromSSA removes the phi functions of g, replacing each with copies at the
+// end of its predecessors. Edges from blocks with several successors are
+// split first so that the copies run only on the edge they belong to. The
+// versioned names remain as distinct variables.
+func (g *CFG) FromSSA() {
+	nextTemp := g.maxTemp() + 1
+	newTemp := func() Operand {
+		t := TempOperand(nextTemp)
+		nextTemp++
+		return t
+	}
+
+	for _, b := range append([]*Block(nil), g.Blocks...) {
+		if len(b.Phis) == 0 {
+			continue
+		}
+		for j, p := range append([]*Block(nil), b.Preds...) {
+			var copies []Instr
+			for _, phi := range b.Phis {
+				copies = append(copies, Instr{Op: OpCopy, Dst: phi.Dst, Args: [2]Operand{phi.Args[j]}})
+			}
+			copies = sequentialize(copies, newTemp)
+			if len(p.Succs) > 1 {
+				p = g.splitEdge(p, b)
+			}
+			p.appendCode(copies)
+		}
+		b.Phis = nil
+	}
+	for i, b := range g.Blocks {
+		b.Index = i
+	}
+}
+
+// appendCode adds instructions to the end of b, before its jump if any
+func (b *Block) appendCode(code []Instr) {
+	n := len(b.Code)
+	if b.terminator() == nil {
+		b.Code = append(b.Code, code...)
+		return
+	}
+	t := b.Code[n-1]
+	b.Code = append(append(b.Code[:n-1:n-1], code...), t)
+}
+
+// splitEdge inserts a new block on the edge from p, which ends with a
+// conditional jump, to its successor s, and returns it. The new block
+// always follows p. When s is the jump target, the jump is inverted to
+// lead to the block that used to follow p, and the new block jumps to s.
+func (g *CFG) splitEdge(p, s *Block) *Block {
+	at := p.Index + 1
+	next := g.Blocks[at]
+	split := &Block{Preds: []*Block{p}, Succs: []*Block{s}}
+	if next != s {
+		t := p.terminator()
+		split.Code = []Instr{{Op: OpJump, Label: t.Label, Line: t.Line}}
+		t.Label = g.labelOf(next)
+		if t.Op == OpIf {
+			t.Op = OpIfFalse
+		} else {
+			t.Op = OpIf
+		}
+	}
+
+	for i, q := range p.Succs {
+		if q == s {
+			p.Succs[i] = split
+		}
+	}
+	s.Preds[s.predIndex(p)] = split
+
+	g.Blocks = append(g.Blocks[:at], append([]*Block{split}, g.Blocks[at:]...)...)
+	for i, b := range g.Blocks {
+		b.Index = i
+	}
+	return split
+}
+
+// labelOf returns the label of b, giving it a fresh one if it has none
+func (g *CFG) labelOf(b *Block) string {
+	if l := b.Label(); l != "" {
+		return l
+	}
+	used := map[string]bool{}
+	for _, c := range g.Blocks {
+		used[c.Label()] = true
+	}
+	n := len(g.Blocks)
+	for used[fmt.Sprintf("L%d", n)] {
+		n++
+	}
+	l := fmt.Sprintf("L%d", n)
+	b.Code = append([]Instr{{Op: OpLabel, Label: l}}, b.Code...)
+	return l
+}
+
+// maxTemp returns the highest temporary number used in g
+func (g *CFG) maxTemp() int {
+	highest := 0
+	note := func(o Operand) {
+		if o.Kind == Temp {
+			if n, err := strconv.Atoi(strings.TrimPrefix(o.Name, "t")); err == nil && n > highest {
+				highest = n
+			}
+		}
+	}
+	for _, b := range g.Blocks {
+		for _, phi := range b.Phis {
+			note(phi.Dst)
+		}
+		for _, in := range b.Code {
+			note(in.Dst)
+			note(in.Args[0])
+			note(in.Args[1])
+		}
+	}
+	return highest
+}
+
+// sequentialize orders a set of copies that take effect simultaneously so
+// that no copy overwrites a value another still needs to read, breaking
+// cycles with a temporary
+func sequentialize(copies []Instr, newTemp func() Operand) []Instr {
+	var pending []Instr
+	for _, c := range copies {
+		if c.Dst != c.Args[0] {
+			pending = append(pending, c)
+		}
+	}
+
+	var out []Instr
+	for len(pending) > 0 {
+		ready := -1
+		for i, c := range pending {
+			read := false
+			for _, d := range pending {
+				if d.Args[0] == c.Dst {
+					read = true
+					break
+				}
+			}
+			if !read {
+				ready = i
+				break
+			}
+		}
+		if ready < 0 {
+			// Every destination is still to be read: save one of them
+			saved := pending[0].Dst
+			t := newTemp()
+			out = append(out, Instr{Op: OpCopy, Dst: t, Args: [2]Operand{saved}})
+			for i := range pending {
+				if pending[i].Args[0] == saved {
+					pending[i].Args[0] = t
+				}
+			}
+			continue
+		}
+		out = append(out, pending[ready])
+		pending = append(pending[:ready], pending[ready+1:]...)
+	}
+	return out
+}
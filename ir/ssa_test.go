@@ -0,0 +1,368 @@
+package ir
+
+import (
+	"errors"
+	"slices"
+	"strings"
+	"testing"
+)
+
+// loopProgram has a join after an if and a loop around a block
+const loopProgram = "read x;\nif x < 0 then x := 0 - x end;\nrepeat x := x - 1 until x = 0;\nwrite x"
+
+// execute runs p with the given input and returns what it wrote. Names
+// with different versions are different variables, as after FromSSA.
+func execute(p *Program, input []int) ([]int, error) {
+	labels := map[string]int{}
+	for i, in := range p.Code {
+		if in.Op == OpLabel {
+			labels[in.Label] = i
+		}
+	}
+	vars := map[string]int{}
+	value := func(o Operand) int {
+		if o.Kind == Const {
+			return o.Value
+		}
+		return vars[o.String()]
+	}
+	truth := func(b bool) int {
+		if b {
+			return 1
+		}
+		return 0
+	}
+
+	var out []int
+	for pc, steps := 0, 0; pc < len(p.Code); pc++ {
+		if steps++; steps > 100000 {
+			return out, errors.New("too many steps")
+		}
+		in := p.Code[pc]
+		a, b := value(in.Args[0]), value(in.Args[1])
+		var result int
+		switch in.Op {
+		case OpLabel:
+			continue
+		case OpJump:
+			pc = labels[in.Label]
+			continue
+		case OpIf, OpIfFalse:
+			if (a != 0) == (in.Op == OpIf) {
+				pc = labels[in.Label]
+			}
+			continue
+		case OpRead:
+			if len(input) == 0 {
+				return out, errors.New("out of input")
+			}
+			vars[in.Dst.String()], input = input[0], input[1:]
+			continue
+		case OpWrite:
+			out = append(out, a)
+			continue
+		case OpCopy:
+			result = a
+		case OpAdd:
+			result = a + b
+		case OpSub:
+			result = a - b
+		case OpMul:
+			result = a * b
+		case OpDiv:
+			if b == 0 {
+				return out, errors.New("division by zero")
+			}
+			result = a / b
+		case OpLt:
+			result = truth(a < b)
+		case OpEq:
+			result = truth(a == b)
+		case OpGt:
+			result = truth(a > b)
+		case OpLe:
+			result = truth(a <= b)
+		case OpGe:
+			result = truth(a >= b)
+		case OpNe:
+			result = truth(a != b)
+		}
+		vars[in.Dst.String()] = result
+	}
+	return out, nil
+}
+
+// cfg lowers src and builds its control-flow graph
+func cfg(t *testing.T, src string) *CFG {
+	t.Helper()
+	g, err := BuildCFG(lower(t, src))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return g
+}
+
+// dump returns the printed form of g without trailing blanks, which
+// empty lists of blocks leave
+func dump(t *testing.T, g *CFG, print func(*CFG, *strings.Builder) error) string {
+	t.Helper()
+	var b strings.Builder
+	if err := print(g, &b); err != nil {
+		t.Fatal(err)
+	}
+	lines := strings.Split(b.String(), "\n")
+	for i, l := range lines {
+		lines[i] = strings.TrimRight(l, " ")
+	}
+	return strings.Join(lines, "\n")
+}
+
+func printCFG(g *CFG, b *strings.Builder) error { return g.Print(b) }
+func printDom(g *CFG, b *strings.Builder) error { return g.PrintDominators(b) }
+
+// TestBuildCFG checks the blocks and edges of a graph
+func TestBuildCFG(t *testing.T) {
+	got := dump(t, cfg(t, loopProgram), printCFG)
+	want := `B0 (entry)  preds:   succs: B1
+B1  preds: B0  succs: B2 B3
+    read x
+    t1 = x < 0
+    iffalse t1 goto L1
+B2  preds: B1  succs: B3
+    x = 0 - x
+B3  preds: B1 B2  succs: B4
+    L1:
+B4  preds: B3 B4  succs: B5 B4
+    L2:
+    x = x - 1
+    t2 = x == 0
+    iffalse t2 goto L2
+B5  preds: B4  succs: B6
+    write x
+B6 (exit)  preds: B5  succs:
+`
+	if got != want {
+		t.Errorf("got:\n%s\nwant:\n%s", got, want)
+	}
+}
+
+// TestBuildCFGEdgeCases checks unreachable code, jumps to the next
+// instruction and undefined labels
+func TestBuildCFGEdgeCases(t *testing.T) {
+	parse := func(src string) *Program {
+		p, err := Parse(strings.NewReader(src))
+		if err != nil {
+			t.Fatal(err)
+		}
+		return p
+	}
+
+	g, err := BuildCFG(parse("goto L1\nwrite 1\nL1:\nwrite 2"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := g.Program(); len(got.Code) != 3 || got.Code[2].Args[0].Value != 2 {
+		t.Errorf("unreachable write kept: %v", got.Code)
+	}
+
+	g, err = BuildCFG(parse("read x\nif x goto L1\nL1:\nwrite x"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if n := len(g.Blocks); n != 4 {
+		t.Errorf("%d blocks, want 4: the conditional jump to the next block is dropped\n%s", n, dump(t, g, printCFG))
+	}
+
+	if _, err := BuildCFG(&Program{Code: []Instr{{Op: OpJump, Label: "L9"}}}); err == nil {
+		t.Error("undefined label accepted")
+	}
+}
+
+// TestDominators checks immediate dominators and dominance frontiers
+func TestDominators(t *testing.T) {
+	g := cfg(t, loopProgram)
+	g.ComputeDominators()
+	want := `B0 (entry)  idom: -  children: B1  frontier:
+B1  idom: B0  children: B2 B3  frontier:
+B2  idom: B1  children:   frontier: B3
+B3  idom: B1  children: B4  frontier:
+B4  idom: B3  children: B5  frontier: B4
+B5  idom: B4  children: B6  frontier:
+B6 (exit)  idom: B5  children:   frontier:
+`
+	if got := dump(t, g, printDom); got != want {
+		t.Errorf("got:\n%s\nwant:\n%s", got, want)
+	}
+	b := g.Blocks
+	if !b[1].Dominates(b[5]) || b[2].Dominates(b[3]) || !b[4].Dominates(b[4]) {
+		t.Error("Dominates disagrees with the dominator tree")
+	}
+}
+
+// TestToSSA checks phi placement and renaming
+func TestToSSA(t *testing.T) {
+	g := cfg(t, loopProgram)
+	g.ToSSA()
+	want := `B0 (entry)  preds:   succs: B1
+B1  preds: B0  succs: B2 B3
+    read x.1
+    t1.1 = x.1 < 0
+    iffalse t1.1 goto L1
+B2  preds: B1  succs: B3
+    x.2 = 0 - x.1
+B3  preds: B1 B2  succs: B4
+    L1:
+    x.3 = phi(x.1, x.2)
+B4  preds: B3 B4  succs: B5 B4
+    L2:
+    x.4 = phi(x.3, x.5)
+    x.5 = x.4 - 1
+    t2.1 = x.5 == 0
+    iffalse t2.1 goto L2
+B5  preds: B4  succs: B6
+    write x.5
+B6 (exit)  preds: B5  succs:
+`
+	if got := dump(t, g, printCFG); got != want {
+		t.Errorf("got:\n%s\nwant:\n%s", got, want)
+	}
+
+	// A variable used before any assignment keeps version 0, and a
+	// temporary live in only one block gets no phi
+	g = cfg(t, "repeat n := n + 1 until n = 3")
+	g.ToSSA()
+	if got := dump(t, g, printCFG); !strings.Contains(got, "n.1 = phi(n, n.2)\n") || strings.Contains(got, "t1.2") {
+		t.Errorf("got:\n%s", got)
+	}
+}
+
+// TestSingleAssignment checks that every name is defined once in SSA form
+func TestSingleAssignment(t *testing.T) {
+	for _, src := range ssaPrograms {
+		g := cfg(t, src.src)
+		g.ToSSA()
+		defined := map[string]bool{}
+		define := func(o Operand) {
+			if defined[o.String()] {
+				t.Errorf("%s: %s defined twice", src.name, o)
+			}
+			defined[o.String()] = true
+		}
+		for _, b := range g.Blocks {
+			for _, phi := range b.Phis {
+				define(phi.Dst)
+				if len(phi.Args) != len(b.Preds) {
+					t.Errorf("%s: %v has %d arguments for %d predecessors", src.name, phi, len(phi.Args), len(b.Preds))
+				}
+			}
+			for _, in := range b.Code {
+				if isVariable(in.Dst) {
+					define(in.Dst)
+				}
+			}
+		}
+	}
+}
+
+// ssaPrograms exercise phis at joins, in loops and in nested loops
+var ssaPrograms = []struct {
+	name  string
+	src   string
+	input []int
+}{
+	{"if and loop", loopProgram, []int{-4}},
+	{"swap", "read a; read b; n := 0; repeat t := a; a := b; b := t; n := n + 1 until n = 3; write a; write b", []int{1, 2}},
+	{"rotate", "a := 1; b := 2; c := 3; repeat t := a; a := b; b := c; c := t; n := n + 1 until n = 4; write a; write b; write c", nil},
+	{"nested", "read n; s := 0; repeat i := n; repeat s := s + i; i := i - 1 until i = 0; n := n - 1 until n = 0; write s", []int{4}},
+	{"if in loop", "read n; repeat if n / 2 * 2 = n then n := n / 2 else n := 3 * n + 1 end; write n until n = 1", []int{6}},
+}
+
+// TestFromSSA checks that leaving SSA form keeps the meaning of programs
+func TestFromSSA(t *testing.T) {
+	for _, tt := range ssaPrograms {
+		t.Run(tt.name, func(t *testing.T) {
+			want, err := execute(lower(t, tt.src), tt.input)
+			if err != nil {
+				t.Fatal(err)
+			}
+			g := cfg(t, tt.src)
+			g.ToSSA()
+			g.FromSSA()
+			for _, b := range g.Blocks {
+				if len(b.Phis) != 0 {
+					t.Fatalf("%s still has phis", b.Name())
+				}
+			}
+			p := g.Program()
+			got, err := execute(p, tt.input)
+			if err != nil {
+				t.Fatalf("%v\n%s", err, printed(t, p))
+			}
+			if !slices.Equal(got, want) {
+				t.Errorf("wrote %v, want %v\n%s", got, want, printed(t, p))
+			}
+
+			// The versioned names survive printing and parsing
+			q, err := Parse(strings.NewReader(printed(t, p)))
+			if err != nil {
+				t.Fatal(err)
+			}
+			if again, _ := execute(q, tt.input); !slices.Equal(again, want) {
+				t.Errorf("reparsed program wrote %v, want %v", again, want)
+			}
+		})
+	}
+}
+
+// TestSequentialize checks that parallel copies are ordered so that no
+// source is overwritten before it is read, with cycles broken by a
+// temporary
+func TestSequentialize(t *testing.T) {
+	copies := func(pairs ...string) []Instr {
+		var code []Instr
+		for i := 0; i < len(pairs); i += 2 {
+			code = append(code, Instr{Op: OpCopy, Dst: VarOperand(pairs[i]), Args: [2]Operand{VarOperand(pairs[i+1])}})
+		}
+		return code
+	}
+	tests := []struct {
+		name   string
+		copies []Instr
+	}{
+		{"independent", copies("a", "x", "b", "y")},
+		{"chain", copies("a", "b", "b", "c", "c", "d")},
+		{"swap", copies("a", "b", "b", "a")},
+		{"rotation", copies("a", "b", "b", "c", "c", "a")},
+		{"self copy", copies("a", "a", "b", "a")},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			start := map[string]int{"a": 1, "b": 2, "c": 3, "d": 4, "x": 5, "y": 6}
+			want := map[string]int{}
+			for k, v := range start {
+				want[k] = v
+			}
+			for _, c := range tt.copies {
+				want[c.Dst.Name] = start[c.Args[0].Name]
+			}
+
+			n := 0
+			code := sequentialize(tt.copies, func() Operand { n++; return TempOperand(n) })
+			got := map[string]int{}
+			for k, v := range start {
+				got[k] = v
+			}
+			for _, c := range code {
+				got[c.Dst.Name] = got[c.Args[0].Name]
+			}
+			for k, v := range want {
+				if got[k] != v {
+					t.Errorf("%s = %d, want %d after %v", k, got[k], v, code)
+				}
+			}
+			if len(code) > len(tt.copies)+1 {
+				t.Errorf("%d copies for %d", len(code), len(tt.copies))
+			}
+		})
+	}
+}
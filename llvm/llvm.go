@@ -0,0 +1,414 @@
+// Package llvm translates TINY programs to LLVM IR in its textual (.ll)
+// form. The output is a module with a main function that can be compiled
+// with clang or run with lli; read and write call small runtime functions
+// defined in the same module on top of the C library's scanf and printf.
+//
+// The IR uses opaque pointers (ptr), so it needs LLVM 15 or later; older
+// releases only accept typed pointers such as i64*.
+package llvm
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+
+	"tinycompiler/tiny"
+)
+
+// Options control code generation
+type Options struct {
+	File string // Source file name, recorded as the module's source_filename
+}
+
+// generator holds the state of a code generation run
+type generator struct {
+	w      io.Writer
+	table  *tiny.SymbolTable
+	temps  int    // Number of temporaries used so far
+	labels int    // Number of label groups used so far
+	block  string // Label of the basic block being generated
+	err    error
+}
+
+// Generate writes LLVM IR for the program rooted at tree. If table is nil
+// it is built from the tree.
+func Generate(w io.Writer, tree *tiny.TreeNode, table *tiny.SymbolTable, opts Options) error {
+	if table == nil {
+		table, _ = tiny.BuildSymtab(tree)
+	}
+	g := &generator{w: w, table: table}
+
+	if opts.File != "" {
+		g.printf("; ModuleID = '%s'\n", opts.File)
+		g.printf("source_filename = %s\n\n", quote(opts.File))
+	}
+
+	g.printf("define i32 @main() {\n")
+	g.printf("entry:\n")
+	g.block = "entry"
+	for _, sym := range table.Symbols() {
+		g.printf("  %s = alloca i64\n", addr(sym.Name))
+	}
+	for _, sym := range table.Symbols() {
+		g.printf("  store i64 0, ptr %s\n", addr(sym.Name))
+	}
+	g.stmtSeq(tree)
+	g.printf("  ret i32 0\n")
+	g.printf("}\n")
+
+	g.printf("%s", runtime)
+	return g.err
+}
+
+// runtime holds the functions and declarations that generated code calls
+const runtime = `
+@.fmt.read = private unnamed_addr constant [5 x i8] c"%lld\00"
+@.fmt.write = private unnamed_addr constant [6 x i8] c"%lld\0A\00"
+@.msg.badinput = private unnamed_addr constant [41 x i8] c"runtime error: read expected an integer\0A\00"
+@.msg.divzero = private unnamed_addr constant [46 x i8] c"runtime error: division by zero at line %lld\0A\00"
+
+declare i32 @scanf(ptr, ...)
+declare i32 @printf(ptr, ...)
+declare i32 @dprintf(i32, ptr, ...)
+declare void @exit(i32) noreturn
+
+define private i64 @tiny_read() {
+entry:
+  %v = alloca i64
+  %n = call i32 (ptr, ...) @scanf(ptr @.fmt.read, ptr %v)
+  %ok = icmp eq i32 %n, 1
+  br i1 %ok, label %done, label %bad
+bad:
+  call i32 (i32, ptr, ...) @dprintf(i32 2, ptr @.msg.badinput)
+  call void @exit(i32 1)
+  unreachable
+done:
+  %r = load i64, ptr %v
+  ret i64 %r
+}
+
+define private void @tiny_write(i64 %v) {
+entry:
+  call i32 (ptr, ...) @printf(ptr @.fmt.write, i64 %v)
+  ret void
+}
+
+; tiny_div reports division by zero with the source line, and treats
+; division by -1 as a negation, which unlike sdiv cannot overflow
+define private i64 @tiny_div(i64 %a, i64 %b, i64 %line) {
+entry:
+  %zero = icmp eq i64 %b, 0
+  br i1 %zero, label %divzero, label %nonzero
+divzero:
+  call i32 (i32, ptr, ...) @dprintf(i32 2, ptr @.msg.divzero, i64 %line)
+  call void @exit(i32 1)
+  unreachable
+nonzero:
+  %minusone = icmp eq i64 %b, -1
+  br i1 %minusone, label %negate, label %divide
+negate:
+  %n = sub i64 0, %a
+  ret i64 %n
+divide:
+  %q = sdiv i64 %a, %b
+  ret i64 %q
+}
+`
+
+func (g *generator) printf(format string, args ...any) {
+	if g.err != nil {
+		return
+	}
+	_, g.err = fmt.Fprintf(g.w, format, args...)
+}
+
+func (g *generator) fail(node *tiny.TreeNode, msg string) {
+	if g.err != nil {
+		return
+	}
+	if node != nil {
+		msg = fmt.Sprintf("line %d: %s", node.LineNum, msg)
+	}
+	g.err = errors.New(msg)
+}
+
+// addr returns the name of the stack slot holding a variable
+func addr(name string) string {
+	return "%" + name + ".addr"
+}
+
+// quote returns s as an LLVM string literal
+func quote(s string) string {
+	var b strings.Builder
+	b.WriteByte('"')
+	for i := 0; i < len(s); i++ {
+		c := s[i]
+		if c < ' ' || c > '~' || c == '"' || c == '\\' {
+			fmt.Fprintf(&b, "\\%02X", c)
+		} else {
+			b.WriteByte(c)
+		}
+	}
+	b.WriteByte('"')
+	return b.String()
+}
+
+// newTemp returns a fresh temporary name
+func (g *generator) newTemp() string {
+	g.temps++
+	return fmt.Sprintf("%%t%d", g.temps)
+}
+
+// newLabels returns a fresh number for a group of related labels
+func (g *generator) newLabels() int {
+	g.labels++
+	return g.labels
+}
+
+// label starts the basic block name.n
+func (g *generator) label(name string, n int) {
+	g.block = fmt.Sprintf("%s.%d", name, n)
+	g.printf("%s:\n", g.block)
+}
+
+func (g *generator) stmtSeq(node *tiny.TreeNode) {
+	for ; node != nil; node = node.Sibling {
+		g.stmt(node)
+	}
+}
+
+func (g *generator) stmt(node *tiny.TreeNode) {
+	if node.NodeKind != tiny.StmtK {
+		g.fail(node, "cannot generate code for a syntax error")
+		return
+	}
+
+	switch node.StmtKind {
+	case tiny.IfK:
+		n := g.newLabels()
+		test := g.cond(node.Children[0])
+		elseLabel := fmt.Sprintf("endif.%d", n)
+		if node.Children[2] != nil {
+			elseLabel = fmt.Sprintf("else.%d", n)
+		}
+		g.printf("  br i1 %s, label %%then.%d, label %%%s\n", test, n, elseLabel)
+		g.label("then", n)
+		g.stmtSeq(node.Children[1])
+		g.printf("  br label %%endif.%d\n", n)
+		if node.Children[2] != nil {
+			g.label("else", n)
+			g.stmtSeq(node.Children[2])
+			g.printf("  br label %%endif.%d\n", n)
+		}
+		g.label("endif", n)
+
+	case tiny.RepeatK:
+		n := g.newLabels()
+		g.printf("  br label %%repeat.%d\n", n)
+		g.label("repeat", n)
+		g.stmtSeq(node.Children[0])
+		test := g.cond(node.Children[1])
+		g.printf("  br i1 %s, label %%until.%d, label %%repeat.%d\n", test, n, n)
+		g.label("until", n)
+
+	case tiny.WhileK:
+		n := g.newLabels()
+		g.printf("  br label %%while.%d\n", n)
+		g.label("while", n)
+		test := g.cond(node.Children[0])
+		g.printf("  br i1 %s, label %%do.%d, label %%endwhile.%d\n", test, n, n)
+		g.label("do", n)
+		g.stmtSeq(node.Children[1])
+		g.printf("  br label %%while.%d\n", n)
+		g.label("endwhile", n)
+
+	case tiny.ForK:
+		n := g.newLabels()
+		pred, update := "sle", "add"
+		if node.Op == "downto" {
+			pred, update = "sge", "sub"
+		}
+		start := g.exp(node.Children[0])
+		g.printf("  store i64 %s, ptr %s\n", start, addr(node.Name))
+		// The limit and step are evaluated once; their values dominate
+		// the loop, so they need no memory of their own
+		limit := g.exp(node.Children[1])
+		step := "1"
+		if node.Children[2] != nil {
+			step = g.exp(node.Children[2])
+		}
+		g.printf("  br label %%for.%d\n", n)
+		g.label("for", n)
+		i := g.newTemp()
+		g.printf("  %s = load i64, ptr %s\n", i, addr(node.Name))
+		test := g.newTemp()
+		g.printf("  %s = icmp %s i64 %s, %s\n", test, pred, i, limit)
+		g.printf("  br i1 %s, label %%body.%d, label %%endfor.%d\n", test, n, n)
+		g.label("body", n)
+		g.stmtSeq(node.Children[3])
+		i = g.newTemp()
+		g.printf("  %s = load i64, ptr %s\n", i, addr(node.Name))
+		next := g.newTemp()
+		g.printf("  %s = %s i64 %s, %s\n", next, update, i, step)
+		g.printf("  store i64 %s, ptr %s\n", next, addr(node.Name))
+		g.printf("  br label %%for.%d\n", n)
+		g.label("endfor", n)
+
+	case tiny.AssignK:
+		v := g.exp(node.Children[0])
+		g.printf("  store i64 %s, ptr %s\n", v, addr(node.Name))
+
+	case tiny.ReadK:
+		t := g.newTemp()
+		g.printf("  %s = call i64 @tiny_read()\n", t)
+		g.printf("  store i64 %s, ptr %s\n", t, addr(node.Name))
+
+	case tiny.WriteK:
+		v := g.exp(node.Children[0])
+		g.printf("  call void @tiny_write(i64 %s)\n", v)
+	}
+}
+
+// predicates maps comparison operators to icmp condition codes
+var predicates = map[string]string{
+	"<":  "slt",
+	">":  "sgt",
+	"<=": "sle",
+	">=": "sge",
+	"=":  "eq",
+	"<>": "ne",
+}
+
+// isComparison reports whether node is a comparison
+func isComparison(node *tiny.TreeNode) bool {
+	return node.NodeKind == tiny.ExpK && node.ExpKind == tiny.OpK && predicates[node.Op] != ""
+}
+
+// isBoolean reports whether node is a comparison or logical operator,
+// whose truth value cond computes directly
+func isBoolean(node *tiny.TreeNode) bool {
+	switch {
+	case node.NodeKind != tiny.ExpK:
+		return false
+	case node.ExpKind == tiny.UnaryK:
+		return node.Op == "not"
+	case node.ExpKind == tiny.OpK:
+		return node.Op == "and" || node.Op == "or" || isComparison(node)
+	}
+	return false
+}
+
+// cond returns an i1 value holding the truth of node
+func (g *generator) cond(node *tiny.TreeNode) string {
+	if node == nil || !isBoolean(node) {
+		v := g.exp(node)
+		t := g.newTemp()
+		g.printf("  %s = icmp ne i64 %s, 0\n", t, v)
+		return t
+	}
+
+	switch node.Op {
+	case "not":
+		c := g.cond(node.Children[0])
+		t := g.newTemp()
+		g.printf("  %s = xor i1 %s, true\n", t, c)
+		return t
+	case "and", "or":
+		return g.logical(node)
+	}
+	return g.compare(node)
+}
+
+// logical emits an and or or that only evaluates its right operand when
+// the left one does not decide the result, and returns its i1 value
+func (g *generator) logical(node *tiny.TreeNode) string {
+	n := g.newLabels()
+	short, rhs, end := "false", fmt.Sprintf("%s.%d", node.Op, n), fmt.Sprintf("end%s.%d", node.Op, n)
+	l := g.cond(node.Children[0])
+	from := g.block
+	if node.Op == "and" {
+		g.printf("  br i1 %s, label %%%s, label %%%s\n", l, rhs, end)
+	} else {
+		short = "true"
+		g.printf("  br i1 %s, label %%%s, label %%%s\n", l, end, rhs)
+	}
+	g.label(node.Op, n)
+	r := g.cond(node.Children[1])
+	g.printf("  br label %%%s\n", end)
+	t := g.newTemp()
+	to := g.block
+	g.label("end"+node.Op, n)
+	g.printf("  %s = phi i1 [ %s, %%%s ], [ %s, %%%s ]\n", t, short, from, r, to)
+	return t
+}
+
+// compare emits a comparison and returns its i1 result
+func (g *generator) compare(node *tiny.TreeNode) string {
+	l := g.exp(node.Children[0])
+	r := g.exp(node.Children[1])
+	t := g.newTemp()
+	g.printf("  %s = icmp %s i64 %s, %s\n", t, predicates[node.Op], l, r)
+	return t
+}
+
+// arith maps arithmetic operators to LLVM instructions
+var arith = map[string]string{
+	"+": "add",
+	"-": "sub",
+	"*": "mul",
+}
+
+// exp emits the code of an expression and returns its i64 value, either a
+// temporary or a constant
+func (g *generator) exp(node *tiny.TreeNode) string {
+	if node == nil || node.NodeKind != tiny.ExpK {
+		g.fail(node, "cannot generate code for a syntax error")
+		return "0"
+	}
+
+	switch node.ExpKind {
+	case tiny.ConstK:
+		return fmt.Sprint(node.Value)
+
+	case tiny.IdK:
+		t := g.newTemp()
+		g.printf("  %s = load i64, ptr %s\n", t, addr(node.Name))
+		return t
+
+	case tiny.OpK, tiny.UnaryK:
+		if isBoolean(node) {
+			c := g.cond(node)
+			t := g.newTemp()
+			g.printf("  %s = zext i1 %s to i64\n", t, c)
+			return t
+		}
+		if node.ExpKind == tiny.UnaryK {
+			v := g.exp(node.Children[0])
+			switch node.Op {
+			case "-":
+				t := g.newTemp()
+				g.printf("  %s = sub i64 0, %s\n", t, v)
+				return t
+			case "+":
+				return v
+			}
+			g.fail(node, "unknown operator "+node.Op)
+			return "0"
+		}
+
+		l := g.exp(node.Children[0])
+		r := g.exp(node.Children[1])
+		t := g.newTemp()
+		switch {
+		case arith[node.Op] != "":
+			g.printf("  %s = %s i64 %s, %s\n", t, arith[node.Op], l, r)
+		case node.Op == "/":
+			g.printf("  %s = call i64 @tiny_div(i64 %s, i64 %s, i64 %d)\n", t, l, r, node.LineNum)
+		default:
+			g.fail(node, "unknown operator "+node.Op)
+		}
+		return t
+	}
+	return "0"
+}
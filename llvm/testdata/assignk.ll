@@ -0,0 +1,66 @@
+; ModuleID = 'assignk.tny'
+source_filename = "assignk.tny"
+
+define i32 @main() {
+entry:
+  %x.addr = alloca i64
+  %y.addr = alloca i64
+  store i64 0, ptr %x.addr
+  store i64 0, ptr %y.addr
+  store i64 7, ptr %x.addr
+  %t1 = load i64, ptr %x.addr
+  store i64 %t1, ptr %y.addr
+  ret i32 0
+}
+
+@.fmt.read = private unnamed_addr constant [5 x i8] c"%lld\00"
+@.fmt.write = private unnamed_addr constant [6 x i8] c"%lld\0A\00"
+@.msg.badinput = private unnamed_addr constant [41 x i8] c"runtime error: read expected an integer\0A\00"
+@.msg.divzero = private unnamed_addr constant [46 x i8] c"runtime error: division by zero at line %lld\0A\00"
+
+declare i32 @scanf(ptr, ...)
+declare i32 @printf(ptr, ...)
+declare i32 @dprintf(i32, ptr, ...)
+declare void @exit(i32) noreturn
+
+define private i64 @tiny_read() {
+entry:
+  %v = alloca i64
+  %n = call i32 (ptr, ...) @scanf(ptr @.fmt.read, ptr %v)
+  %ok = icmp eq i32 %n, 1
+  br i1 %ok, label %done, label %bad
+bad:
+  call i32 (i32, ptr, ...) @dprintf(i32 2, ptr @.msg.badinput)
+  call void @exit(i32 1)
+  unreachable
+done:
+  %r = load i64, ptr %v
+  ret i64 %r
+}
+
+define private void @tiny_write(i64 %v) {
+entry:
+  call i32 (ptr, ...) @printf(ptr @.fmt.write, i64 %v)
+  ret void
+}
+
+; tiny_div reports division by zero with the source line, and treats
+; division by -1 as a negation, which unlike sdiv cannot overflow
+define private i64 @tiny_div(i64 %a, i64 %b, i64 %line) {
+entry:
+  %zero = icmp eq i64 %b, 0
+  br i1 %zero, label %divzero, label %nonzero
+divzero:
+  call i32 (i32, ptr, ...) @dprintf(i32 2, ptr @.msg.divzero, i64 %line)
+  call void @exit(i32 1)
+  unreachable
+nonzero:
+  %minusone = icmp eq i64 %b, -1
+  br i1 %minusone, label %negate, label %divide
+negate:
+  %n = sub i64 0, %a
+  ret i64 %n
+divide:
+  %q = sdiv i64 %a, %b
+  ret i64 %q
+}
@@ -0,0 +1,96 @@
+; ModuleID = 'fork.tny'
+source_filename = "fork.tny"
+
+define i32 @main() {
+entry:
+  %s.addr = alloca i64
+  %i.addr = alloca i64
+  store i64 0, ptr %s.addr
+  store i64 0, ptr %i.addr
+  store i64 0, ptr %s.addr
+  store i64 1, ptr %i.addr
+  br label %for.1
+for.1:
+  %t1 = load i64, ptr %i.addr
+  %t2 = icmp sle i64 %t1, 10
+  br i1 %t2, label %body.1, label %endfor.1
+body.1:
+  %t3 = load i64, ptr %s.addr
+  %t4 = load i64, ptr %i.addr
+  %t5 = add i64 %t3, %t4
+  store i64 %t5, ptr %s.addr
+  %t6 = load i64, ptr %i.addr
+  %t7 = add i64 %t6, 2
+  store i64 %t7, ptr %i.addr
+  br label %for.1
+endfor.1:
+  store i64 3, ptr %i.addr
+  br label %for.2
+for.2:
+  %t8 = load i64, ptr %i.addr
+  %t9 = icmp sge i64 %t8, 1
+  br i1 %t9, label %body.2, label %endfor.2
+body.2:
+  %t10 = load i64, ptr %s.addr
+  %t11 = load i64, ptr %i.addr
+  %t12 = sub i64 %t10, %t11
+  store i64 %t12, ptr %s.addr
+  %t13 = load i64, ptr %i.addr
+  %t14 = sub i64 %t13, 1
+  store i64 %t14, ptr %i.addr
+  br label %for.2
+endfor.2:
+  ret i32 0
+}
+
+@.fmt.read = private unnamed_addr constant [5 x i8] c"%lld\00"
+@.fmt.write = private unnamed_addr constant [6 x i8] c"%lld\0A\00"
+@.msg.badinput = private unnamed_addr constant [41 x i8] c"runtime error: read expected an integer\0A\00"
+@.msg.divzero = private unnamed_addr constant [46 x i8] c"runtime error: division by zero at line %lld\0A\00"
+
+declare i32 @scanf(ptr, ...)
+declare i32 @printf(ptr, ...)
+declare i32 @dprintf(i32, ptr, ...)
+declare void @exit(i32) noreturn
+
+define private i64 @tiny_read() {
+entry:
+  %v = alloca i64
+  %n = call i32 (ptr, ...) @scanf(ptr @.fmt.read, ptr %v)
+  %ok = icmp eq i32 %n, 1
+  br i1 %ok, label %done, label %bad
+bad:
+  call i32 (i32, ptr, ...) @dprintf(i32 2, ptr @.msg.badinput)
+  call void @exit(i32 1)
+  unreachable
+done:
+  %r = load i64, ptr %v
+  ret i64 %r
+}
+
+define private void @tiny_write(i64 %v) {
+entry:
+  call i32 (ptr, ...) @printf(ptr @.fmt.write, i64 %v)
+  ret void
+}
+
+; tiny_div reports division by zero with the source line, and treats
+; division by -1 as a negation, which unlike sdiv cannot overflow
+define private i64 @tiny_div(i64 %a, i64 %b, i64 %line) {
+entry:
+  %zero = icmp eq i64 %b, 0
+  br i1 %zero, label %divzero, label %nonzero
+divzero:
+  call i32 (i32, ptr, ...) @dprintf(i32 2, ptr @.msg.divzero, i64 %line)
+  call void @exit(i32 1)
+  unreachable
+nonzero:
+  %minusone = icmp eq i64 %b, -1
+  br i1 %minusone, label %negate, label %divide
+negate:
+  %n = sub i64 0, %a
+  ret i64 %n
+divide:
+  %q = sdiv i64 %a, %b
+  ret i64 %q
+}
@@ -0,0 +1,86 @@
+; ModuleID = 'logical.tny'
+source_filename = "logical.tny"
+
+define i32 @main() {
+entry:
+  %x.addr = alloca i64
+  store i64 0, ptr %x.addr
+  %t1 = call i64 @tiny_read()
+  store i64 %t1, ptr %x.addr
+  %t2 = load i64, ptr %x.addr
+  %t3 = icmp slt i64 %t2, 0
+  %t4 = xor i1 %t3, true
+  br i1 %t4, label %and.3, label %endand.3
+and.3:
+  %t5 = load i64, ptr %x.addr
+  %t6 = icmp slt i64 %t5, 10
+  br label %endand.3
+endand.3:
+  %t7 = phi i1 [ false, %entry ], [ %t6, %and.3 ]
+  br i1 %t7, label %endor.2, label %or.2
+or.2:
+  %t8 = load i64, ptr %x.addr
+  %t9 = icmp eq i64 %t8, 20
+  br label %endor.2
+endor.2:
+  %t10 = phi i1 [ true, %endand.3 ], [ %t9, %or.2 ]
+  br i1 %t10, label %then.1, label %endif.1
+then.1:
+  %t11 = load i64, ptr %x.addr
+  call void @tiny_write(i64 %t11)
+  br label %endif.1
+endif.1:
+  ret i32 0
+}
+
+@.fmt.read = private unnamed_addr constant [5 x i8] c"%lld\00"
+@.fmt.write = private unnamed_addr constant [6 x i8] c"%lld\0A\00"
+@.msg.badinput = private unnamed_addr constant [41 x i8] c"runtime error: read expected an integer\0A\00"
+@.msg.divzero = private unnamed_addr constant [46 x i8] c"runtime error: division by zero at line %lld\0A\00"
+
+declare i32 @scanf(ptr, ...)
+declare i32 @printf(ptr, ...)
+declare i32 @dprintf(i32, ptr, ...)
+declare void @exit(i32) noreturn
+
+define private i64 @tiny_read() {
+entry:
+  %v = alloca i64
+  %n = call i32 (ptr, ...) @scanf(ptr @.fmt.read, ptr %v)
+  %ok = icmp eq i32 %n, 1
+  br i1 %ok, label %done, label %bad
+bad:
+  call i32 (i32, ptr, ...) @dprintf(i32 2, ptr @.msg.badinput)
+  call void @exit(i32 1)
+  unreachable
+done:
+  %r = load i64, ptr %v
+  ret i64 %r
+}
+
+define private void @tiny_write(i64 %v) {
+entry:
+  call i32 (ptr, ...) @printf(ptr @.fmt.write, i64 %v)
+  ret void
+}
+
+; tiny_div reports division by zero with the source line, and treats
+; division by -1 as a negation, which unlike sdiv cannot overflow
+define private i64 @tiny_div(i64 %a, i64 %b, i64 %line) {
+entry:
+  %zero = icmp eq i64 %b, 0
+  br i1 %zero, label %divzero, label %nonzero
+divzero:
+  call i32 (i32, ptr, ...) @dprintf(i32 2, ptr @.msg.divzero, i64 %line)
+  call void @exit(i32 1)
+  unreachable
+nonzero:
+  %minusone = icmp eq i64 %b, -1
+  br i1 %minusone, label %negate, label %divide
+negate:
+  %n = sub i64 0, %a
+  ret i64 %n
+divide:
+  %q = sdiv i64 %a, %b
+  ret i64 %q
+}
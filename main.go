@@ -1,7 +1,6 @@
 package main
 
 import (
-	"bufio"
 	"container/list"
 	"fmt"
 	"io"
@@ -15,6 +14,8 @@ import (
 	"fyne.io/fyne/v2/layout"
 	"fyne.io/fyne/v2/widget"
 	"fyne.io/x/fyne/widget/diagramwidget"
+
+	"tinycompiler/tiny"
 )
 
 var SCAN_PARSE_FLAG int
@@ -24,27 +25,33 @@ const (
 	PARSE
 )
 
-func ScanFromBox(box *widget.Entry, displayBox *widget.TextGrid) (bool, []string) {
+// formatDiagnostics renders diagnostics as plain text for display
+func formatDiagnostics(diags []tiny.Diagnostic) string {
+	var sb strings.Builder
+	tiny.FormatText(&sb, diags)
+	return sb.String()
+}
+
+func ScanFromBox(box *widget.Entry, displayBox *widget.TextGrid) (bool, []tiny.Diagnostic) {
 	code := box.Text
-	s := newScanner(*bufio.NewReader(strings.NewReader(code)))
+	s := tiny.NewScanner(strings.NewReader(code))
 
 	if !s.Scan() {
 		fmt.Println("Scanning Failed.")
-		displayBox.SetText(fmt.Sprintf("Scanning Failed:\n %v", s.errors))
-		return false, s.errors
+		displayBox.SetText("Scanning Failed:\n" + formatDiagnostics(s.Errors()) + "\n" + s.PrintTokens())
+		return false, s.Errors()
 	}
 	tokens := s.PrintTokens()
 	displayBox.SetText(tokens)
 	// fmt.Print(tokens)
-	return true, []string{}
+	return true, nil
 }
 
 // ScanFromFile scans text from the uploaded file and displays tokens
 func ScanFromFile(inputFile *os.File, displayBox *widget.TextGrid) {
 	defer inputFile.Close()
 
-	reader := bufio.NewReader(inputFile)
-	s := newScanner(*reader)
+	s := tiny.NewScanner(inputFile)
 
 	if !s.Scan() {
 		fmt.Println("Scanning Failed.")
@@ -55,28 +62,27 @@ func ScanFromFile(inputFile *os.File, displayBox *widget.TextGrid) {
 	displayBox.SetText(tokens)
 }
 
-func ParseAndDisplayTree(code string, widget *diagramwidget.DiagramWidget) (bool, []string) {
+func ParseAndDisplayTree(code string, widget *diagramwidget.DiagramWidget) (bool, []tiny.Diagnostic) {
 	widget.DiagramElements = list.New()
 	widget.Refresh()
 	// First scan the code
-	s := newScanner(*bufio.NewReader(strings.NewReader(code)))
-	if !s.Scan() {
-		fmt.Println("Scanning Failed:\n", s.errors)
-		return false, s.errors
-	}
+	s := tiny.NewScanner(strings.NewReader(code))
+	s.Scan()
 
-	// Parse the tokens
-	parser := NewParser(s.tokens)
+	// Parse the tokens, reporting lexical and syntax errors together
+	parser := tiny.NewParser(s.Tokens())
 	tree, errors := parser.Parse()
+	errors = append(s.Errors(), errors...)
+	tiny.SortDiagnostics(errors)
 
-	if len(errors) > 0 {
-		fmt.Println("Parsing errors:", errors)
+	if tiny.HasErrors(errors) {
+		fmt.Print("Parsing errors:\n", formatDiagnostics(errors))
 		return false, errors
 	}
 
 	// Create and display the tree visualizer
 	NewTreeVisualizer(tree, widget)
-	return true, []string{}
+	return true, nil
 }
 
 func main() {
@@ -112,7 +118,7 @@ func main() {
 			scrollContainer.Show()
 			rightTextGrid.Hide()
 		} else {
-			rightTextGrid.SetText(fmt.Sprintf("Parsing Failed:\n %v\n", errors))
+			rightTextGrid.SetText("Parsing Failed:\n" + formatDiagnostics(errors))
 			rightTextGrid.Show()
 			scrollContainer.Hide()
 		}
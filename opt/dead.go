@@ -0,0 +1,262 @@
+package opt
+
+import (
+	"maps"
+
+	"tinycompiler/tiny"
+)
+
+// seqBuilder assembles a statement sequence from pieces
+type seqBuilder struct {
+	head, tail *tiny.TreeNode
+}
+
+// add appends the sequence starting at node
+func (b *seqBuilder) add(node *tiny.TreeNode) {
+	if node == nil {
+		return
+	}
+	if b.head == nil {
+		b.head = node
+	} else {
+		b.tail.Sibling = node
+	}
+	for b.tail = node; b.tail.Sibling != nil; b.tail = b.tail.Sibling {
+	}
+}
+
+// eachStmt calls f on every statement of a sequence, detached from its
+// siblings, and returns the sequence made of the results
+func eachStmt(node *tiny.TreeNode, f func(stmt *tiny.TreeNode) *tiny.TreeNode) *tiny.TreeNode {
+	var b seqBuilder
+	for node != nil {
+		next := node.Sibling
+		node.Sibling = nil
+		b.add(f(node))
+		node = next
+	}
+	return b.head
+}
+
+// RemoveUnreachable replaces an if statement whose test is constant by the
+// branch it always takes, and a repeat whose test is constantly true by its
+// body, which then runs exactly once. A while loop whose test is constantly
+// false is removed.
+func RemoveUnreachable(tree *tiny.TreeNode) (*tiny.TreeNode, bool) {
+	changed := false
+	var seq func(node *tiny.TreeNode) *tiny.TreeNode
+	seq = func(node *tiny.TreeNode) *tiny.TreeNode {
+		return eachStmt(node, func(stmt *tiny.TreeNode) *tiny.TreeNode {
+			if stmt.NodeKind != tiny.StmtK {
+				return stmt
+			}
+			switch stmt.StmtKind {
+			case tiny.IfK:
+				stmt.Children[1] = seq(stmt.Children[1])
+				stmt.Children[2] = seq(stmt.Children[2])
+				if test := stmt.Children[0]; isConst(test) {
+					changed = true
+					if test.Value != 0 {
+						return stmt.Children[1]
+					}
+					return stmt.Children[2]
+				}
+			case tiny.RepeatK:
+				stmt.Children[0] = seq(stmt.Children[0])
+				if test := stmt.Children[1]; isConst(test) && test.Value != 0 {
+					changed = true
+					return stmt.Children[0]
+				}
+			case tiny.ForK:
+				stmt.Children[3] = seq(stmt.Children[3])
+			case tiny.WhileK:
+				stmt.Children[1] = seq(stmt.Children[1])
+				if test := stmt.Children[0]; isConst(test) && test.Value == 0 {
+					changed = true
+					return nil
+				}
+			}
+			return stmt
+		})
+	}
+	tree = seq(tree)
+	return tree, changed
+}
+
+// liveSet holds the variables whose current value may still be read
+type liveSet map[string]bool
+
+// addUses adds the variables read by an expression to live
+func (live liveSet) addUses(node *tiny.TreeNode) {
+	if node == nil || node.NodeKind != tiny.ExpK {
+		return
+	}
+	switch node.ExpKind {
+	case tiny.IdK:
+		live[node.Name] = true
+	case tiny.OpK, tiny.UnaryK:
+		live.addUses(node.Children[0])
+		live.addUses(node.Children[1])
+	}
+}
+
+func union(a, b liveSet) liveSet {
+	u := maps.Clone(a)
+	maps.Copy(u, b)
+	return u
+}
+
+// deadStores removes assignments to variables that are not live
+type deadStores struct {
+	changed bool
+}
+
+// EliminateDeadStores removes assignments whose value is overwritten or
+// never read on every path that follows, unless evaluating the assigned
+// expression could fail at run time
+func EliminateDeadStores(tree *tiny.TreeNode) (*tiny.TreeNode, bool) {
+	d := &deadStores{}
+	tree, _ = d.seq(tree, liveSet{}, true)
+	return tree, d.changed
+}
+
+// seq works backwards through a statement sequence given the variables
+// live after it, returning the rewritten sequence and the variables live
+// before it. Statements are only removed if remove is set.
+func (d *deadStores) seq(node *tiny.TreeNode, live liveSet, remove bool) (*tiny.TreeNode, liveSet) {
+	head := node
+	var stmts []*tiny.TreeNode
+	for ; node != nil; node = node.Sibling {
+		stmts = append(stmts, node)
+	}
+
+	var kept []*tiny.TreeNode
+	for i := len(stmts) - 1; i >= 0; i-- {
+		var keep bool
+		keep, live = d.stmt(stmts[i], live, remove)
+		if keep {
+			kept = append(kept, stmts[i])
+		}
+	}
+	if !remove {
+		return head, live
+	}
+
+	var b seqBuilder
+	for i := len(kept) - 1; i >= 0; i-- {
+		kept[i].Sibling = nil
+		b.add(kept[i])
+	}
+	return b.head, live
+}
+
+// stmt returns whether to keep a statement and the variables live before it
+func (d *deadStores) stmt(node *tiny.TreeNode, live liveSet, remove bool) (bool, liveSet) {
+	if node.NodeKind != tiny.StmtK {
+		return true, live
+	}
+
+	switch node.StmtKind {
+	case tiny.IfK:
+		thenSeq, thenLive := d.seq(node.Children[1], live, remove)
+		elseSeq, elseLive := d.seq(node.Children[2], live, remove)
+		if remove {
+			node.Children[1], node.Children[2] = thenSeq, elseSeq
+		}
+		in := union(thenLive, elseLive)
+		in.addUses(node.Children[0])
+		return true, in
+
+	case tiny.RepeatK:
+		// After the test control either leaves the loop or starts the body
+		// again, so iterate until the variables live at the top settle
+		top := liveSet{}
+		for {
+			end := union(live, top)
+			end.addUses(node.Children[1])
+			_, in := d.seq(node.Children[0], end, false)
+			if maps.Equal(in, top) {
+				break
+			}
+			top = in
+		}
+		end := union(live, top)
+		end.addUses(node.Children[1])
+		body, in := d.seq(node.Children[0], end, remove)
+		if remove {
+			node.Children[0] = body
+		}
+		return true, in
+
+	case tiny.WhileK:
+		// The test runs on entry and after every iteration, and then either
+		// leaves the loop or runs the body, so iterate until the variables
+		// live before it settle
+		head := liveSet{}
+		for {
+			_, in := d.seq(node.Children[1], head, false)
+			next := union(live, in)
+			next.addUses(node.Children[0])
+			if maps.Equal(next, head) {
+				break
+			}
+			head = next
+		}
+		body, _ := d.seq(node.Children[1], head, remove)
+		if remove {
+			node.Children[1] = body
+		}
+		return true, head
+
+	case tiny.ForK:
+		// Like while, where the test and the update after the body read
+		// the loop variable. The limit and step are read once, after the
+		// start is assigned to the loop variable.
+		afterBody := func(head liveSet) liveSet {
+			end := maps.Clone(head)
+			end[node.Name] = true
+			return end
+		}
+		head := liveSet{}
+		for {
+			_, in := d.seq(node.Children[3], afterBody(head), false)
+			next := union(live, in)
+			next[node.Name] = true
+			if maps.Equal(next, head) {
+				break
+			}
+			head = next
+		}
+		body, _ := d.seq(node.Children[3], afterBody(head), remove)
+		if remove {
+			node.Children[3] = body
+		}
+		in := maps.Clone(head)
+		in.addUses(node.Children[1])
+		in.addUses(node.Children[2])
+		delete(in, node.Name)
+		in.addUses(node.Children[0])
+		return true, in
+
+	case tiny.AssignK:
+		if remove && !live[node.Name] && isPure(node.Children[0]) {
+			d.changed = true
+			return false, live
+		}
+		in := maps.Clone(live)
+		delete(in, node.Name)
+		in.addUses(node.Children[0])
+		return true, in
+
+	case tiny.ReadK:
+		in := maps.Clone(live)
+		delete(in, node.Name)
+		return true, in
+
+	case tiny.WriteK:
+		in := maps.Clone(live)
+		in.addUses(node.Children[0])
+		return true, in
+	}
+	return true, live
+}
@@ -0,0 +1,272 @@
+package opt
+
+import "tinycompiler/tiny"
+
+// rewriter applies a function to every expression of a tree, bottom up,
+// and records whether it replaced any
+type rewriter struct {
+	f       func(node *tiny.TreeNode) *tiny.TreeNode
+	changed bool
+}
+
+func (r *rewriter) seq(node *tiny.TreeNode) {
+	for ; node != nil; node = node.Sibling {
+		for i, child := range node.Children {
+			if child == nil {
+				continue
+			}
+			switch child.NodeKind {
+			case tiny.StmtK:
+				r.seq(child)
+			case tiny.ExpK:
+				node.Children[i] = r.exp(child)
+			}
+		}
+	}
+}
+
+func (r *rewriter) exp(node *tiny.TreeNode) *tiny.TreeNode {
+	for i, child := range node.Children {
+		if child != nil && child.NodeKind == tiny.ExpK {
+			node.Children[i] = r.exp(child)
+		}
+	}
+	if n := r.f(node); n != node {
+		r.changed = true
+		return n
+	}
+	return node
+}
+
+// rewriteExps replaces every expression in tree by f applied to it
+func rewriteExps(tree *tiny.TreeNode, f func(node *tiny.TreeNode) *tiny.TreeNode) (*tiny.TreeNode, bool) {
+	r := &rewriter{f: f}
+	r.seq(tree)
+	return tree, r.changed
+}
+
+// isConst reports whether node is a constant
+func isConst(node *tiny.TreeNode) bool {
+	return node != nil && node.NodeKind == tiny.ExpK && node.ExpKind == tiny.ConstK
+}
+
+// isConstValue reports whether node is the constant v
+func isConstValue(node *tiny.TreeNode, v int) bool {
+	return isConst(node) && node.Value == v
+}
+
+// constant returns a constant node with value v that takes the place of
+// node in the tree
+func constant(node *tiny.TreeNode, v int) *tiny.TreeNode {
+	return &tiny.TreeNode{
+		NodeKind: tiny.ExpK,
+		ExpKind:  tiny.ConstK,
+		Value:    v,
+		LineNum:  node.LineNum,
+		Span:     node.Span,
+		Type:     node.Type,
+	}
+}
+
+// evalOp applies a TINY operator to constant operands. It fails for
+// division by zero, which must be left to fail at run time.
+func evalOp(op string, a, b int) (int, bool) {
+	switch op {
+	case "+":
+		return a + b, true
+	case "-":
+		return a - b, true
+	case "*":
+		return a * b, true
+	case "/":
+		if b == 0 {
+			return 0, false
+		}
+		if b == -1 {
+			return -a, true // Like every backend, wrap instead of trapping
+		}
+		return a / b, true
+	case "<":
+		return boolValue(a < b), true
+	case ">":
+		return boolValue(a > b), true
+	case "<=":
+		return boolValue(a <= b), true
+	case ">=":
+		return boolValue(a >= b), true
+	case "=":
+		return boolValue(a == b), true
+	case "<>":
+		return boolValue(a != b), true
+	case "and":
+		return boolValue(a != 0 && b != 0), true
+	case "or":
+		return boolValue(a != 0 || b != 0), true
+	}
+	return 0, false
+}
+
+func boolValue(b bool) int {
+	if b {
+		return 1
+	}
+	return 0
+}
+
+// isBool reports whether node is a boolean expression, whose value is
+// always 1 or 0. Types are only known once the tree has been type checked.
+func isBool(node *tiny.TreeNode) bool {
+	return node != nil && node.NodeKind == tiny.ExpK && node.Type == tiny.Boolean
+}
+
+// Fold replaces operators applied to constants with their result, so that
+// 2*3 becomes the constant 6 and 0 < 1 the true value 1. An and whose left
+// operand is false and an or whose left operand is true are also constant,
+// since their right operand is never evaluated.
+func Fold(tree *tiny.TreeNode) (*tiny.TreeNode, bool) {
+	return rewriteExps(tree, func(node *tiny.TreeNode) *tiny.TreeNode {
+		if node.ExpKind == tiny.UnaryK {
+			c := node.Children[0]
+			if !isConst(c) {
+				return node
+			}
+			switch node.Op {
+			case "not":
+				return constant(node, boolValue(c.Value == 0))
+			case "-":
+				return constant(node, -c.Value)
+			case "+":
+				return constant(node, c.Value)
+			}
+			return node
+		}
+		if node.ExpKind != tiny.OpK {
+			return node
+		}
+		if l := node.Children[0]; isConst(l) && (node.Op == "and" && l.Value == 0 || node.Op == "or" && l.Value != 0) {
+			return constant(node, boolValue(l.Value != 0))
+		}
+		if !isConst(node.Children[0]) || !isConst(node.Children[1]) {
+			return node
+		}
+		v, ok := evalOp(node.Op, node.Children[0].Value, node.Children[1].Value)
+		if !ok {
+			return node
+		}
+		return constant(node, v)
+	})
+}
+
+// isPure reports whether evaluating node cannot fail, that is whether it
+// contains no division. Only pure expressions may be dropped.
+func isPure(node *tiny.TreeNode) bool {
+	if node == nil || node.NodeKind != tiny.ExpK {
+		return false
+	}
+	switch node.ExpKind {
+	case tiny.UnaryK:
+		return isPure(node.Children[0])
+	case tiny.OpK:
+		return node.Op != "/" && isPure(node.Children[0]) && isPure(node.Children[1])
+	}
+	return true
+}
+
+// sameExp reports whether a and b are the same pure expression, and so
+// always have the same value
+func sameExp(a, b *tiny.TreeNode) bool {
+	if !isPure(a) || !isPure(b) || a.ExpKind != b.ExpKind {
+		return false
+	}
+	switch a.ExpKind {
+	case tiny.ConstK:
+		return a.Value == b.Value
+	case tiny.IdK:
+		return a.Name == b.Name
+	case tiny.UnaryK:
+		return a.Op == b.Op && sameExp(a.Children[0], b.Children[0])
+	}
+	return a.Op == b.Op && sameExp(a.Children[0], b.Children[0]) && sameExp(a.Children[1], b.Children[1])
+}
+
+// Simplify applies algebraic identities: adding or subtracting 0 and
+// multiplying or dividing by 1 do nothing, multiplying by 0 gives 0, and
+// an expression compared with or subtracted from itself has a known result.
+// +x and - -x are x. For a boolean x, true and x, false or x and not not x
+// are all x, while x and false is false and x or true is true.
+func Simplify(tree *tiny.TreeNode) (*tiny.TreeNode, bool) {
+	return rewriteExps(tree, func(node *tiny.TreeNode) *tiny.TreeNode {
+		if node.ExpKind == tiny.UnaryK {
+			c := node.Children[0]
+			if c == nil {
+				return node
+			}
+			if node.Op == "+" {
+				return c
+			}
+			// A repeated - or not cancels out
+			if c.ExpKind == tiny.UnaryK && c.Op == node.Op && (node.Op == "-" || isBool(c.Children[0])) {
+				return c.Children[0]
+			}
+			return node
+		}
+		if node.ExpKind != tiny.OpK {
+			return node
+		}
+		l, r := node.Children[0], node.Children[1]
+		switch node.Op {
+		case "+":
+			if isConstValue(l, 0) {
+				return r
+			}
+			if isConstValue(r, 0) {
+				return l
+			}
+		case "-":
+			if isConstValue(r, 0) {
+				return l
+			}
+			if sameExp(l, r) {
+				return constant(node, 0)
+			}
+		case "*":
+			if isConstValue(l, 1) {
+				return r
+			}
+			if isConstValue(r, 1) {
+				return l
+			}
+			if (isConstValue(l, 0) && isPure(r)) || (isConstValue(r, 0) && isPure(l)) {
+				return constant(node, 0)
+			}
+		case "/":
+			if isConstValue(r, 1) {
+				return l
+			}
+		case "<", ">", "<>":
+			if sameExp(l, r) {
+				return constant(node, 0)
+			}
+		case "=", "<=", ">=":
+			if sameExp(l, r) {
+				return constant(node, 1)
+			}
+		case "and", "or":
+			// A left operand that decides the result is left to Fold
+			if isConstValue(l, boolValue(node.Op == "and")) && isBool(r) {
+				return r
+			}
+			if !isConst(r) {
+				break
+			}
+			if (r.Value != 0) == (node.Op == "or") {
+				if isPure(l) {
+					return constant(node, boolValue(r.Value != 0))
+				}
+			} else if isBool(l) {
+				return l
+			}
+		}
+		return node
+	})
+}
@@ -0,0 +1,109 @@
+// Package opt rewrites TINY syntax trees into cheaper equivalent ones. The
+// passes work on the tree that every backend consumes, so they benefit all
+// of them; a PassManager runs a selection of passes and can print the tree
+// after each one.
+package opt
+
+import (
+	"fmt"
+	"io"
+
+	"tinycompiler/tiny"
+)
+
+// Pass is a single optimization. Run returns the rewritten tree, which may
+// have a different root, and whether anything changed.
+type Pass struct {
+	Name    string
+	Summary string
+	Run     func(tree *tiny.TreeNode) (*tiny.TreeNode, bool)
+}
+
+// Passes lists every pass in the order the pass manager runs them
+var Passes = []Pass{
+	{"fold", "fold operators applied to constants", Fold},
+	{"simplify", "apply algebraic identities such as x*1 = x", Simplify},
+	{"constprop", "replace variables holding known constants", PropagateConstants},
+	{"copyprop", "replace variables copied from other variables", PropagateCopies},
+	{"unreachable", "remove branches whose test is constant", RemoveUnreachable},
+	{"dse", "remove assignments whose value is never used", EliminateDeadStores},
+}
+
+// Level returns the names of the passes run at an optimization level:
+// none at 0, the local rewrites at 1 and everything at 2
+func Level(n int) []string {
+	switch {
+	case n <= 0:
+		return nil
+	case n == 1:
+		return []string{"fold", "simplify", "unreachable"}
+	}
+	names := make([]string, len(Passes))
+	for i, p := range Passes {
+		names[i] = p.Name
+	}
+	return names
+}
+
+// maxRounds bounds the number of times the pass manager repeats the passes
+const maxRounds = 10
+
+// PassManager runs a set of passes until they stop finding improvements
+type PassManager struct {
+	passes []Pass
+	Trace  io.Writer // If set, the tree is printed here after each pass that changes it
+}
+
+// NewPassManager returns a pass manager for the named passes. They run in
+// the order of Passes whatever the order of names.
+func NewPassManager(names []string) (*PassManager, error) {
+	wanted := map[string]bool{}
+	for _, name := range names {
+		if Lookup(name) == nil {
+			return nil, fmt.Errorf("unknown optimization pass %q", name)
+		}
+		wanted[name] = true
+	}
+	m := &PassManager{}
+	for _, p := range Passes {
+		if wanted[p.Name] {
+			m.passes = append(m.passes, p)
+		}
+	}
+	return m, nil
+}
+
+// Lookup returns the pass with the given name, or nil
+func Lookup(name string) *Pass {
+	for i := range Passes {
+		if Passes[i].Name == name {
+			return &Passes[i]
+		}
+	}
+	return nil
+}
+
+// Run optimizes tree and returns the result. Each pass can enable others,
+// so the sequence is repeated while it changes the tree.
+func (m *PassManager) Run(tree *tiny.TreeNode) *tiny.TreeNode {
+	for round := 1; round <= maxRounds; round++ {
+		changed := false
+		for _, p := range m.passes {
+			var c bool
+			tree, c = p.Run(tree)
+			if !c {
+				continue
+			}
+			changed = true
+			if m.Trace != nil {
+				fmt.Fprintf(m.Trace, "After %s (round %d):\n", p.Name, round)
+				tiny.FprintSyntaxTree(m.Trace, tree, 0)
+				fmt.Fprintln(m.Trace)
+			}
+		}
+		if !changed {
+			break
+		}
+	}
+	return tree
+}
@@ -0,0 +1,199 @@
+package opt
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+
+	"tinycompiler/interp"
+	"tinycompiler/tiny"
+	"tinycompiler/tiny/tinytest"
+)
+
+// printed returns the syntax tree listing of tree
+func printed(tree *tiny.TreeNode) string {
+	var b strings.Builder
+	tiny.FprintSyntaxTree(&b, tree, 0)
+	return b.String()
+}
+
+// run interprets tree with the given input and returns what it wrote
+func run(tree *tiny.TreeNode, input string) (string, error) {
+	var out bytes.Buffer
+	err := interp.New(strings.NewReader(input), &out).Run(tree)
+	return strings.Join(strings.Fields(out.String()), " "), err
+}
+
+// TestPasses checks each pass on its own. The expected result is given as
+// source whose tree must match the rewritten one; since boolean constants
+// have no source form, tests that produce them go on to remove the branch.
+func TestPasses(t *testing.T) {
+	tests := []struct {
+		passes  string // Run once each, in order
+		src     string
+		want    string
+		changed bool
+	}{
+		{"fold", "write 2 * 3 + 4", "write 10", true},
+		{"fold", "write (10 - 4) / 2; write 7 / 2", "write 3; write 3", true},
+		{"fold", "write x + 2 * 3", "write x + 6", true},
+		{"fold unreachable", "if 1 < 2 then write 1 else write 2 end; if 2 = 3 then write 3 end", "write 1", true},
+		{"fold unreachable", "if 2 > 1 then write 1 end; if 2 <= 1 then write 2 end; if 1 >= 1 then write 3 end; if 1 <> 1 then write 4 end", "write 1; write 3", true},
+		{"fold", "write 1 / 0", "write 1 / 0", false},
+		{"fold", "write x + 1", "write x + 1", false},
+		{"fold", "write 1 - -(2 + 3); write +4 * - -2", "write 6; write 8", true},
+		{"fold", "write x * -(2 - 5)", "write x * 3", true},
+		{"fold", "write -x", "write -x", false},
+
+		{"simplify", "write x + 0; write 0 + x; write x - 0", "write x; write x; write x", true},
+		{"simplify", "write x * 1; write 1 * x; write x / 1", "write x; write x; write x", true},
+		{"simplify", "write x * 0; write 0 * (x + y)", "write 0; write 0", true},
+		{"simplify", "write x - x; write (x + 1) - (x + 1)", "write 0; write 0", true},
+		{"simplify unreachable", "if x = x then write 1 end; if x < x then write 2 end", "write 1", true},
+		{"simplify unreachable", "if x <= x then write 1 end; if x <> x then write 2 end; if x >= x then write 3 end; if x > x then write 4 end", "write 1; write 3", true},
+		{"simplify", "write 0 * (1 / x)", "write 0 * (1 / x)", false},
+		{"simplify", "write x / x - x / x", "write x / x - x / x", false},
+		{"simplify", "write - -x; write +x; write -(-(x + 1))", "write x; write x; write x + 1", true},
+		{"simplify", "write - +x", "write -x", true},
+		{"fold unreachable", "if 1 > 2 and 1 / 0 = 1 then write 1 end; if 0 < 1 or 1 / 0 = 1 then write 2 end", "write 2", true},
+		{"fold simplify", "read x; if 1 = 1 and x < 1 then write 1 end", "read x; if x < 1 then write 1 end", true},
+		{"fold simplify", "read x; if 1 = 2 or x < 1 then write 1 end", "read x; if x < 1 then write 1 end", true},
+		{"simplify", "read x; if not not (x < 1) then write 1 end", "read x; if x < 1 then write 1 end", true},
+		{"fold simplify unreachable", "read x; if x < 1 or 1 = 1 then write 1 end", "read x; write 1", true},
+
+		{"constprop", "x := 3; write x + x", "x := 3; write 3 + 3", true},
+		{"constprop", "x := 3; read x; write x", "x := 3; read x; write x", false},
+		{"constprop", "read y; if y < 0 then x := 1 else x := 1 end; write x", "read y; if y < 0 then x := 1 else x := 1 end; write 1", true},
+		{"constprop", "read y; if y < 0 then x := 1 else x := 2 end; write x", "read y; if y < 0 then x := 1 else x := 2 end; write x", false},
+		{"constprop", "x := 1; n := 3; repeat x := x * 2; n := n - 1 until n = 0; write x + n",
+			"x := 1; n := 3; repeat x := x * 2; n := n - 1 until n = 0; write x + n", false},
+		{"constprop", "k := 2; n := 0; while n < 9 do n := n + k end; write n", "k := 2; n := 0; while n < 9 do n := n + 2 end; write n", true},
+		{"constprop", "k := 2; for i := k to 9 step k do write k * i end", "k := 2; for i := 2 to 9 step 2 do write 2 * i end", true},
+		{"constprop", "i := 1; for i := 1 to 3 do write i end; write i", "i := 1; for i := 1 to 3 do write i end; write i", false},
+		{"constprop", "k := 2; repeat x := x + k until 9 < x; write k", "k := 2; repeat x := x + 2 until 9 < x; write 2", true},
+
+		{"copyprop", "read y; x := y; write x * x", "read y; x := y; write y * y", true},
+		{"copyprop", "read y; x := y; y := 1; write x", "read y; x := y; y := 1; write x", false},
+		{"copyprop", "read y; x := y; x := x; write x", "read y; x := y; x := y; write y", true},
+
+		{"fold unreachable", "repeat write 1 until 0 < 1", "write 1", true},
+		{"fold unreachable", "while 2 < 1 do write 1 end; write 2", "write 2", true},
+		{"unreachable", "read x; while x < 1 do x := x + 1 end", "read x; while x < 1 do x := x + 1 end", false},
+		{"unreachable", "read x; repeat x := x - 1 until x < 1", "read x; repeat x := x - 1 until x < 1", false},
+		{"unreachable", "read x; if x < 1 then write 1 end", "read x; if x < 1 then write 1 end", false},
+
+		{"dse", "x := 1; x := 2; write x", "x := 2; write x", true},
+		{"dse", "x := 1; y := x; write 0", "write 0", true},
+		{"dse", "read y; if y < 0 then x := 1 end; write x", "read y; if y < 0 then x := 1 end; write x", false},
+		{"dse", "x := 1 / 0; write 0", "x := 1 / 0; write 0", false},
+		{"dse", "n := 3; repeat t := n; n := n - 1 until n = 0", "n := 3; repeat n := n - 1 until n = 0", true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.passes+" "+tt.src, func(t *testing.T) {
+			tree, changed := tinytest.Parse(t, tt.src), false
+			for _, name := range strings.Fields(tt.passes) {
+				var c bool
+				tree, c = Lookup(name).Run(tree)
+				changed = changed || c
+			}
+			if got, want := printed(tree), printed(tinytest.Parse(t, tt.want)); got != want {
+				t.Errorf("got:\n%s\nwant:\n%s", got, want)
+			}
+			if changed != tt.changed {
+				t.Errorf("changed = %v, want %v", changed, tt.changed)
+			}
+		})
+	}
+}
+
+// TestLevel checks the passes selected at each optimization level
+func TestLevel(t *testing.T) {
+	tests := []struct {
+		level int
+		want  string
+	}{
+		{-1, ""},
+		{0, ""},
+		{1, "fold simplify unreachable"},
+		{2, "fold simplify constprop copyprop unreachable dse"},
+		{3, "fold simplify constprop copyprop unreachable dse"},
+	}
+	for _, tt := range tests {
+		if got := strings.Join(Level(tt.level), " "); got != tt.want {
+			t.Errorf("Level(%d) = %q, want %q", tt.level, got, tt.want)
+		}
+	}
+}
+
+// TestPassManager checks that unknown passes are rejected, that the passes
+// run in a fixed order until nothing changes and the trace they leave
+func TestPassManager(t *testing.T) {
+	if _, err := NewPassManager([]string{"fold", "inline"}); err == nil || err.Error() != `unknown optimization pass "inline"` {
+		t.Errorf("unknown pass: got %v", err)
+	}
+	if Lookup("inline") != nil {
+		t.Error("Lookup found an unknown pass")
+	}
+
+	m, err := NewPassManager([]string{"unreachable", "constprop", "fold"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	var trace strings.Builder
+	m.Trace = &trace
+	got := m.Run(tinytest.Parse(t, "x := 2; if x * 3 = 6 then write x end"))
+	if got, want := printed(got), printed(tinytest.Parse(t, "x := 2; write 2")); got != want {
+		t.Errorf("got:\n%s\nwant:\n%s", got, want)
+	}
+	var headers []string
+	for _, line := range strings.Split(trace.String(), "\n") {
+		if strings.HasPrefix(line, "After ") {
+			headers = append(headers, line)
+		}
+	}
+	want := []string{
+		"After constprop (round 1):",
+		"After fold (round 2):",
+		"After unreachable (round 2):",
+	}
+	if strings.Join(headers, "\n") != strings.Join(want, "\n") {
+		t.Errorf("trace headers %q, want %q\n%s", headers, want, trace.String())
+	}
+}
+
+// equivalencePrograms fail at run time, and must fail at the same place
+// with and without optimization. The shared programs of package tinytest
+// check what programs write.
+var equivalencePrograms = []struct {
+	name  string
+	src   string
+	input string
+}{
+	{"division by zero", "write 1;\nx := 0;\nwrite 1 / x", ""},
+	{"dead division by zero", "x := 0;\ny := 5 / x;\nwrite 2", ""},
+	{"division kept before a true or", "read x;\nif 1 / x = 1 or 1 = 1 then write 1 end", "0"},
+	{"division in a constant condition", "x := 0;\nwhile 1 / x = 0 and 2 < 1 do write 1 end", ""},
+	{"out of input", "read x; write x; read y", "1"},
+}
+
+// TestEquivalence checks that -O2 keeps the runtime errors of programs
+func TestEquivalence(t *testing.T) {
+	for _, tt := range equivalencePrograms {
+		t.Run(tt.name, func(t *testing.T) {
+			want, wantErr := run(tinytest.Parse(t, tt.src), tt.input)
+
+			m, err := NewPassManager(Level(2))
+			if err != nil {
+				t.Fatal(err)
+			}
+			tree := m.Run(tinytest.Parse(t, tt.src))
+			got, gotErr := run(tree, tt.input)
+			if got != want {
+				t.Errorf("wrote %q, want %q\n%s", got, want, printed(tree))
+			}
+			if (gotErr == nil) != (wantErr == nil) || gotErr != nil && gotErr.Error() != wantErr.Error() {
+				t.Errorf("error %v, want %v\n%s", gotErr, wantErr, printed(tree))
+			}
+		})
+	}
+}
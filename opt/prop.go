@@ -0,0 +1,188 @@
+package opt
+
+import (
+	"maps"
+
+	"tinycompiler/tiny"
+)
+
+// facts maps variables to the constant or variable they are known to equal
+type facts map[string]*tiny.TreeNode
+
+// kill forgets what is known about name, including the facts that name
+// equals another variable
+func (f facts) kill(name string) {
+	delete(f, name)
+	for v, value := range f {
+		if value.ExpKind == tiny.IdK && value.Name == name {
+			delete(f, v)
+		}
+	}
+}
+
+// meet keeps the facts that hold on both of two joining paths
+func meet(a, b facts) facts {
+	m := facts{}
+	for v, x := range a {
+		if y, ok := b[v]; ok && x.ExpKind == y.ExpKind && x.Value == y.Value && x.Name == y.Name {
+			m[v] = x
+		}
+	}
+	return m
+}
+
+// assigned adds the variables that the statement sequence may change to set
+func assigned(node *tiny.TreeNode, set map[string]bool) {
+	for ; node != nil; node = node.Sibling {
+		if node.NodeKind != tiny.StmtK {
+			continue
+		}
+		switch node.StmtKind {
+		case tiny.AssignK, tiny.ReadK:
+			set[node.Name] = true
+		case tiny.IfK:
+			assigned(node.Children[1], set)
+			assigned(node.Children[2], set)
+		case tiny.RepeatK:
+			assigned(node.Children[0], set)
+		case tiny.WhileK:
+			assigned(node.Children[1], set)
+		case tiny.ForK:
+			set[node.Name] = true
+			assigned(node.Children[3], set)
+		}
+	}
+}
+
+// propagator replaces uses of variables by the values they were assigned,
+// when the assigned values are of the kind accepted
+type propagator struct {
+	accept  func(value *tiny.TreeNode) bool
+	changed bool
+}
+
+// PropagateConstants replaces uses of a variable by the constant it was
+// last assigned, when that assignment reaches the use on every path
+func PropagateConstants(tree *tiny.TreeNode) (*tiny.TreeNode, bool) {
+	return propagate(tree, isConst)
+}
+
+// PropagateCopies replaces uses of a variable x after x := y by y, as long
+// as neither has been assigned since on any path
+func PropagateCopies(tree *tiny.TreeNode) (*tiny.TreeNode, bool) {
+	return propagate(tree, func(value *tiny.TreeNode) bool {
+		return value.NodeKind == tiny.ExpK && value.ExpKind == tiny.IdK
+	})
+}
+
+func propagate(tree *tiny.TreeNode, accept func(value *tiny.TreeNode) bool) (*tiny.TreeNode, bool) {
+	p := &propagator{accept: accept}
+	p.seq(tree, facts{})
+	return tree, p.changed
+}
+
+// seq rewrites a statement sequence given the facts on entry and returns
+// the facts on exit
+func (p *propagator) seq(node *tiny.TreeNode, f facts) facts {
+	for ; node != nil; node = node.Sibling {
+		f = p.stmt(node, f)
+	}
+	return f
+}
+
+func (p *propagator) stmt(node *tiny.TreeNode, f facts) facts {
+	if node.NodeKind != tiny.StmtK {
+		return f
+	}
+
+	switch node.StmtKind {
+	case tiny.IfK:
+		node.Children[0] = p.exp(node.Children[0], f)
+		return meet(p.seq(node.Children[1], maps.Clone(f)), p.seq(node.Children[2], maps.Clone(f)))
+
+	case tiny.RepeatK:
+		// Facts about variables the body changes may not hold on later
+		// iterations; the others hold throughout the loop
+		changes := map[string]bool{}
+		assigned(node.Children[0], changes)
+		for name := range changes {
+			f.kill(name)
+		}
+		f = p.seq(node.Children[0], f)
+		node.Children[1] = p.exp(node.Children[1], f)
+
+	case tiny.WhileK:
+		// The test is reached on entry and after every iteration, where
+		// only the facts about variables the body leaves alone hold
+		changes := map[string]bool{}
+		assigned(node.Children[1], changes)
+		for name := range changes {
+			f.kill(name)
+		}
+		node.Children[0] = p.exp(node.Children[0], f)
+		p.seq(node.Children[1], maps.Clone(f))
+
+	case tiny.ForK:
+		// The limit and step are evaluated once, right after the loop
+		// variable is set to the start. Then the loop runs like a while
+		// loop that also changes the loop variable on every iteration.
+		node.Children[0] = p.exp(node.Children[0], f)
+		p.assign(node.Name, node.Children[0], f)
+		node.Children[1] = p.exp(node.Children[1], f)
+		node.Children[2] = p.exp(node.Children[2], f)
+		changes := map[string]bool{node.Name: true}
+		assigned(node.Children[3], changes)
+		for name := range changes {
+			f.kill(name)
+		}
+		p.seq(node.Children[3], maps.Clone(f))
+
+	case tiny.AssignK:
+		node.Children[0] = p.exp(node.Children[0], f)
+		p.assign(node.Name, node.Children[0], f)
+
+	case tiny.ReadK:
+		f.kill(node.Name)
+
+	case tiny.WriteK:
+		node.Children[0] = p.exp(node.Children[0], f)
+	}
+	return f
+}
+
+// assign updates the facts for name := value
+func (p *propagator) assign(name string, value *tiny.TreeNode, f facts) {
+	f.kill(name)
+	if value != nil && p.accept(value) && !(value.ExpKind == tiny.IdK && value.Name == name) {
+		f[name] = value
+	}
+}
+
+// exp replaces the variables of an expression for which facts are known
+func (p *propagator) exp(node *tiny.TreeNode, f facts) *tiny.TreeNode {
+	if node == nil || node.NodeKind != tiny.ExpK {
+		return node
+	}
+
+	switch node.ExpKind {
+	case tiny.IdK:
+		value, ok := f[node.Name]
+		if !ok {
+			return node
+		}
+		p.changed = true
+		return &tiny.TreeNode{
+			NodeKind: tiny.ExpK,
+			ExpKind:  value.ExpKind,
+			Value:    value.Value,
+			Name:     value.Name,
+			LineNum:  node.LineNum,
+			Span:     node.Span,
+			Type:     node.Type,
+		}
+	case tiny.OpK, tiny.UnaryK:
+		node.Children[0] = p.exp(node.Children[0], f)
+		node.Children[1] = p.exp(node.Children[1], f)
+	}
+	return node
+}
@@ -0,0 +1,158 @@
+package tiny
+
+import "fmt"
+
+// BuildSymtab walks the syntax tree in preorder and builds its symbol table.
+// Variables are defined by assignment, read or for; a variable that is
+// used but never defined gets a warning, since its value is always 0.
+func BuildSymtab(tree *TreeNode) (*SymbolTable, []Diagnostic) {
+	table := NewSymbolTable()
+	firstUse := make(map[string]*TreeNode)
+
+	var traverse func(node *TreeNode)
+	traverse = func(node *TreeNode) {
+		for ; node != nil; node = node.Sibling {
+			if name, def, ok := variableRef(node); ok {
+				table.Insert(name, node.LineNum, def)
+				if !def && firstUse[name] == nil {
+					firstUse[name] = node
+				}
+			}
+			for i := range node.Children {
+				traverse(node.Children[i])
+			}
+		}
+	}
+	traverse(tree)
+
+	var diags []Diagnostic
+	for _, sym := range table.Symbols() {
+		if sym.DefLine == 0 {
+			diags = append(diags, Diagnostic{
+				Severity: SeverityWarning,
+				Code:     CodeUndefinedVariable,
+				Message:  fmt.Sprintf("variable %s is used but never assigned", sym.Name),
+				Span:     firstUse[sym.Name].Span,
+			})
+		}
+	}
+	return table, diags
+}
+
+// variableRef reports whether node references a variable, and whether the
+// reference defines it
+func variableRef(node *TreeNode) (name string, def bool, ok bool) {
+	switch {
+	case node.NodeKind == StmtK && (node.StmtKind == AssignK || node.StmtKind == ReadK || node.StmtKind == ForK):
+		return node.Name, true, node.Name != ""
+	case node.NodeKind == ExpK && node.ExpKind == IdK:
+		return node.Name, false, true
+	}
+	return "", false, false
+}
+
+// TypeCheck gives every expression node a type in a postorder walk and
+// reports tests that are not boolean and integer operands, assignments,
+// writes and for bounds that are not integers
+func TypeCheck(tree *TreeNode) []Diagnostic {
+	var diags []Diagnostic
+	typeError := func(node *TreeNode, code, msg string) {
+		diags = append(diags, Diagnostic{
+			Severity: SeverityError,
+			Code:     code,
+			Message:  msg,
+			Span:     node.Span,
+		})
+	}
+
+	var traverse func(node *TreeNode)
+	traverse = func(node *TreeNode) {
+		for ; node != nil; node = node.Sibling {
+			for i := range node.Children {
+				traverse(node.Children[i])
+			}
+			checkNode(node, typeError)
+		}
+	}
+	traverse(tree)
+	return diags
+}
+
+// isComparison reports whether op is a comparison operator, which yields
+// a boolean
+func isComparison(op string) bool {
+	switch op {
+	case "<", ">", "<=", ">=", "=", "<>":
+		return true
+	}
+	return false
+}
+
+// isLogical reports whether op is a logical operator, which takes and
+// yields booleans
+func isLogical(op string) bool {
+	return op == "and" || op == "or" || op == "not"
+}
+
+// checkNode type checks a single node whose children are already checked
+func checkNode(node *TreeNode, typeError func(node *TreeNode, code, msg string)) {
+	switch node.NodeKind {
+	case ExpK:
+		switch node.ExpKind {
+		case OpK, UnaryK:
+			want := Integer
+			if isLogical(node.Op) {
+				want = Boolean
+			}
+			for _, child := range node.Children[:2] {
+				if child != nil && child.NodeKind == ExpK && child.Type != want {
+					typeError(child, CodeOperandType,
+						fmt.Sprintf("operator %s applied to %s operand", node.Op, child.Type))
+				}
+			}
+			if isComparison(node.Op) || isLogical(node.Op) {
+				node.Type = Boolean
+			} else {
+				node.Type = Integer
+			}
+		case ConstK, IdK:
+			node.Type = Integer
+		}
+
+	case StmtK:
+		switch node.StmtKind {
+		case IfK:
+			if isTyped(node.Children[0], Integer) {
+				typeError(node.Children[0], CodeIfTest, "if test is not boolean")
+			}
+		case RepeatK:
+			if isTyped(node.Children[1], Integer) {
+				typeError(node.Children[1], CodeRepeatTest, "repeat test is not boolean")
+			}
+		case WhileK:
+			if isTyped(node.Children[0], Integer) {
+				typeError(node.Children[0], CodeWhileTest, "while test is not boolean")
+			}
+		case ForK:
+			for i, part := range []string{"start", "limit", "step"} {
+				if isTyped(node.Children[i], Boolean) {
+					typeError(node.Children[i], CodeForType, "boolean value as for "+part)
+				}
+			}
+		case AssignK:
+			if isTyped(node.Children[0], Boolean) {
+				typeError(node.Children[0], CodeAssignType, "assignment of boolean value to "+node.Name)
+			}
+		case WriteK:
+			if isTyped(node.Children[0], Boolean) {
+				typeError(node.Children[0], CodeWriteType, "write of boolean value")
+			}
+		}
+	}
+}
+
+// isTyped reports whether node is an expression of type t. Error nodes and
+// missing children have no type, so they never cause type errors.
+func isTyped(node *TreeNode, t ExpType) bool {
+	return node != nil && node.NodeKind == ExpK && node.Type == t
+}
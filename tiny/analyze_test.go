@@ -0,0 +1,140 @@
+package tiny
+
+import (
+	"slices"
+	"strings"
+	"testing"
+)
+
+// check scans and parses src, failing the test on any error
+func check(t *testing.T, src string) *TreeNode {
+	t.Helper()
+	tree, diags := frontEnd(src)
+	if HasErrors(diags) {
+		t.Fatalf("unexpected errors: %v", diags)
+	}
+	return tree
+}
+
+// TestSymtabListing checks locations, line lists and the listing format
+func TestSymtabListing(t *testing.T) {
+	src := "read x;\n" +
+		"if 0 < x then\n" +
+		"  fact := 1;\n" +
+		"  repeat\n" +
+		"    fact := fact * x;\n" +
+		"    x := x - 1\n" +
+		"  until x = 0;\n" +
+		"  write fact\n" +
+		"end"
+	table, diags := BuildSymtab(check(t, src))
+	if len(diags) != 0 {
+		t.Errorf("unexpected diagnostics: %v", diags)
+	}
+
+	var b strings.Builder
+	table.Print(&b)
+	want := "Variable Name  Location   Line Numbers\n" +
+		"-------------  --------   ------------\n" +
+		"x              0            1    2    5    6    6    7 \n" +
+		"fact           1            3    5    5    8 \n"
+	if got := b.String(); got != want {
+		t.Errorf("listing:\n%s\nwant:\n%s", got, want)
+	}
+
+	if table.Len() != 2 {
+		t.Errorf("Len() = %d, want 2", table.Len())
+	}
+	if sym := table.Lookup("fact"); sym == nil || sym.DefLine != 3 {
+		t.Errorf("Lookup(fact) = %+v, want DefLine 3", sym)
+	}
+	if sym := table.Lookup("y"); sym != nil {
+		t.Errorf("Lookup(y) = %+v, want nil", sym)
+	}
+}
+
+// TestUndefinedVariables checks the warning for variables that are used
+// but never assigned
+func TestUndefinedVariables(t *testing.T) {
+	tests := []struct {
+		name string
+		src  string
+		want []string
+	}{
+		{"defined by read", "read x; write x", nil},
+		{"defined by assignment", "x := 1; write x", nil},
+		{"used before assignment", "write x; x := 1", nil},
+		{"never assigned", "y := 1;\nwrite x + y;\nwrite x", []string{"2:7 S001"}},
+		{"two variables", "write a;\nwrite b", []string{"1:7 S001", "2:7 S001"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, diags := BuildSymtab(check(t, tt.src))
+			if got := positions(diags); !slices.Equal(got, tt.want) {
+				t.Errorf("got %v, want %v", got, tt.want)
+			}
+			if HasErrors(diags) {
+				t.Errorf("warnings reported as errors: %v", diags)
+			}
+		})
+	}
+}
+
+// TestTypeCheck checks the codes and positions of type errors. The span
+// of a parenthesized expression starts at its "(".
+func TestTypeCheck(t *testing.T) {
+	tests := []struct {
+		name string
+		src  string
+		want []string
+	}{
+		{"well typed", "read x; if x < 1 then x := x * 2 end; repeat x := x - 1 until x = 0; write x", nil},
+		{"boolean operand", "x := (1 < 2) + 1", []string{"1:6 T001"}},
+		{"both operands", "write (1 = 1) * (2 < 3)", []string{"1:7 T001", "1:17 T001"}},
+		{"compared booleans", "if (1 < 2) = (2 < 3) then write 1 end", []string{"1:4 T001", "1:14 T001"}},
+		{"integer and operand", "if 1 and x < 2 then write 1 end", []string{"1:4 T001"}},
+		{"integer or operand", "if x < 2 or x then write 1 end", []string{"1:13 T001"}},
+		{"integer not operand", "if not x then write 1 end", []string{"1:8 T001"}},
+		{"boolean negated", "write -(1 < 2)", []string{"1:8 T001"}},
+		{"logical well typed", "if not (x < 1) and (x = 2 or x > 3) then write x end", nil},
+		{"integer if test", "if 1 then write 1 end", []string{"1:4 T002"}},
+		{"integer repeat test", "repeat write 1 until 1 + 1", []string{"1:22 T003"}},
+		{"integer while test", "while 1 do write 1 end", []string{"1:7 T006"}},
+		{"boolean in while body", "while x < 1 do x := x = 1 end", []string{"1:21 T004"}},
+		{"boolean for limit", "for i := 1 to 2 < 3 do write i end", []string{"1:15 T007"}},
+		{"boolean for start and step", "for i := 0 = 0 to 1 step 1 < 2 do write i end", []string{"1:10 T007", "1:26 T007"}},
+		{"boolean assignment", "x := 1 < 2", []string{"1:6 T004"}},
+		{"boolean write", "write 1 = 2", []string{"1:7 T005"}},
+		{"error reported once", "x := ((1 < 2) + 1) < 3", []string{"1:7 T001", "1:6 T004"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			diags := TypeCheck(check(t, tt.src))
+			if got := positions(diags); !slices.Equal(got, tt.want) {
+				t.Errorf("got %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+// TestTypeCheckAnnotates checks that expressions are given their types
+func TestTypeCheckAnnotates(t *testing.T) {
+	tree := check(t, "if x < 1 then write x + 1 end")
+	if diags := TypeCheck(tree); len(diags) != 0 {
+		t.Fatalf("unexpected errors: %v", diags)
+	}
+	test, sum := tree.Children[0], tree.Children[1].Children[0]
+	for _, tt := range []struct {
+		node *TreeNode
+		want ExpType
+	}{
+		{test, Boolean},
+		{test.Children[0], Integer},
+		{sum, Integer},
+		{sum.Children[1], Integer},
+	} {
+		if tt.node.Type != tt.want {
+			t.Errorf("%s has type %s, want %s", tt.node.Name+tt.node.Op, tt.node.Type, tt.want)
+		}
+	}
+}
@@ -0,0 +1,178 @@
+package tiny
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"sort"
+)
+
+// Severity tells how serious a diagnostic is
+type Severity int
+
+const (
+	SeverityError Severity = iota
+	SeverityWarning
+	SeverityNote
+)
+
+func (s Severity) String() string {
+	return [...]string{
+		"error",
+		"warning",
+		"note",
+	}[s]
+}
+
+// MarshalText lets severities appear by name in JSON output
+func (s Severity) MarshalText() ([]byte, error) {
+	return []byte(s.String()), nil
+}
+
+// Diagnostic codes, grouped by the phase that reports them
+const (
+	// Lexical errors
+	CodeUnmatchedComment = "L001"
+	CodeBadAssign        = "L002"
+	CodeUndefinedChar    = "L003"
+
+	// Syntax errors
+	CodeUnexpectedToken = "P001"
+	CodeExpectedToken   = "P002"
+	CodeExtraTokens     = "P003"
+	CodeInvalidNumber   = "P004"
+
+	// Semantic errors and warnings
+	CodeUndefinedVariable = "S001"
+
+	// Type errors
+	CodeOperandType = "T001"
+	CodeIfTest      = "T002"
+	CodeRepeatTest  = "T003"
+	CodeAssignType  = "T004"
+	CodeWriteType   = "T005"
+	CodeWhileTest   = "T006"
+	CodeForType     = "T007"
+
+	// Runtime errors
+	CodeDivByZero  = "R001"
+	CodeBadInput   = "R002"
+	CodeBadProgram = "R003"
+)
+
+// Position is a location in the source text. Lines and columns start at 1,
+// the byte offset at 0.
+type Position struct {
+	Line   int `json:"line"`
+	Column int `json:"column"`
+	Offset int `json:"offset"`
+}
+
+// Span is a range of source text. End is exclusive: it is the position
+// just after the last character.
+type Span struct {
+	Start Position `json:"start"`
+	End   Position `json:"end"`
+}
+
+// Diagnostic is an error or warning reported by one of the compiler phases
+type Diagnostic struct {
+	Severity Severity `json:"severity"`
+	Code     string   `json:"code"`
+	Message  string   `json:"message"`
+	File     string   `json:"file,omitempty"`
+	Span     Span     `json:"span"`
+}
+
+// String formats the diagnostic as plain text
+func (d Diagnostic) String() string {
+	prefix := ""
+	if d.File != "" {
+		prefix = d.File + " "
+	}
+	return fmt.Sprintf("%s[%d:%d] %s[%s]: %s", prefix,
+		d.Span.Start.Line, d.Span.Start.Column, d.Severity, d.Code, d.Message)
+}
+
+// Error lets a diagnostic be used as an error value
+func (d Diagnostic) Error() string {
+	return d.String()
+}
+
+// HasErrors reports whether any of the diagnostics is an error
+func HasErrors(diags []Diagnostic) bool {
+	for _, d := range diags {
+		if d.Severity == SeverityError {
+			return true
+		}
+	}
+	return false
+}
+
+// SortDiagnostics orders diagnostics by their position in the source, then
+// by code, so that merging the scanner's and the parser's lists and sorting
+// them reports every error in the order it appears, lexical errors first.
+// Diagnostics with the same position and code keep their order.
+func SortDiagnostics(diags []Diagnostic) {
+	sort.SliceStable(diags, func(i, j int) bool {
+		a, b := diags[i].Span.Start, diags[j].Span.Start
+		if a.Line != b.Line {
+			return a.Line < b.Line
+		}
+		if a.Column != b.Column {
+			return a.Column < b.Column
+		}
+		return diags[i].Code < diags[j].Code
+	})
+}
+
+// SetFile records the name of the source file in every diagnostic
+func SetFile(diags []Diagnostic, file string) {
+	for i := range diags {
+		diags[i].File = file
+	}
+}
+
+// FormatText writes one plain text line per diagnostic
+func FormatText(w io.Writer, diags []Diagnostic) error {
+	for _, d := range diags {
+		if _, err := fmt.Fprintln(w, d.String()); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// FormatGCC writes diagnostics in the "file:line:col: error: message" style
+// understood by most editors and CI log parsers
+func FormatGCC(w io.Writer, diags []Diagnostic) error {
+	for _, d := range diags {
+		file := d.File
+		if file == "" {
+			file = "<stdin>"
+		}
+		_, err := fmt.Fprintf(w, "%s:%d:%d: %s: %s [%s]\n", file,
+			d.Span.Start.Line, d.Span.Start.Column, d.Severity, d.Message, d.Code)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// FormatJSON writes the diagnostics as a JSON array
+func FormatJSON(w io.Writer, diags []Diagnostic) error {
+	if diags == nil {
+		diags = []Diagnostic{}
+	}
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+	return enc.Encode(diags)
+}
+
+// Formatters maps format names to diagnostic formatters
+var Formatters = map[string]func(io.Writer, []Diagnostic) error{
+	"text": FormatText,
+	"gcc":  FormatGCC,
+	"json": FormatJSON,
+}
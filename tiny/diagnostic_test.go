@@ -0,0 +1,142 @@
+package tiny
+
+import (
+	"fmt"
+	"strings"
+	"testing"
+)
+
+// diagnostics has an error spanning several lines and one within a line
+var diagnostics = []Diagnostic{
+	{
+		Severity: SeverityError,
+		Code:     CodeUnmatchedComment,
+		Message:  "unterminated comment",
+		Span: Span{
+			Start: Position{Line: 1, Column: 3, Offset: 2},
+			End:   Position{Line: 3, Column: 1, Offset: 20},
+		},
+	},
+	{
+		Severity: SeverityError,
+		Code:     CodeExpectedToken,
+		Message:  `expected ";"`,
+		Span: Span{
+			Start: Position{Line: 4, Column: 5, Offset: 25},
+			End:   Position{Line: 4, Column: 9, Offset: 29},
+		},
+	},
+}
+
+const diagnosticsJSON = `[
+  {
+    "severity": "error",
+    "code": "L001",
+    "message": "unterminated comment",%s
+    "span": {
+      "start": {
+        "line": 1,
+        "column": 3,
+        "offset": 2
+      },
+      "end": {
+        "line": 3,
+        "column": 1,
+        "offset": 20
+      }
+    }
+  },
+  {
+    "severity": "error",
+    "code": "P002",
+    "message": "expected \";\"",%s
+    "span": {
+      "start": {
+        "line": 4,
+        "column": 5,
+        "offset": 25
+      },
+      "end": {
+        "line": 4,
+        "column": 9,
+        "offset": 29
+      }
+    }
+  }
+]
+`
+
+// TestFormatters checks the exact output of every format, with and without
+// a file name
+func TestFormatters(t *testing.T) {
+	fileField := "\n    \"file\": \"prog.tny\","
+	tests := []struct {
+		format string
+		file   string
+		want   string
+	}{
+		{"text", "", "[1:3] error[L001]: unterminated comment\n" +
+			"[4:5] error[P002]: expected \";\"\n"},
+		{"text", "prog.tny", "prog.tny [1:3] error[L001]: unterminated comment\n" +
+			"prog.tny [4:5] error[P002]: expected \";\"\n"},
+		{"gcc", "", "<stdin>:1:3: error: unterminated comment [L001]\n" +
+			"<stdin>:4:5: error: expected \";\" [P002]\n"},
+		{"gcc", "prog.tny", "prog.tny:1:3: error: unterminated comment [L001]\n" +
+			"prog.tny:4:5: error: expected \";\" [P002]\n"},
+		{"json", "", fmt.Sprintf(diagnosticsJSON, "", "")},
+		{"json", "prog.tny", fmt.Sprintf(diagnosticsJSON, fileField, fileField)},
+	}
+	if len(Formatters) != 3 {
+		t.Errorf("%d formatters, want text, gcc and json", len(Formatters))
+	}
+	for _, tt := range tests {
+		t.Run(tt.format+" "+tt.file, func(t *testing.T) {
+			format, ok := Formatters[tt.format]
+			if !ok {
+				t.Fatalf("no %s formatter", tt.format)
+			}
+			diags := append([]Diagnostic(nil), diagnostics...)
+			SetFile(diags, tt.file)
+			var b strings.Builder
+			if err := format(&b, diags); err != nil {
+				t.Fatal(err)
+			}
+			if got := b.String(); got != tt.want {
+				t.Errorf("got:\n%s\nwant:\n%s", got, tt.want)
+			}
+		})
+	}
+
+	var b strings.Builder
+	if err := FormatJSON(&b, nil); err != nil || b.String() != "[]\n" {
+		t.Errorf("no diagnostics as JSON: %q, %v", b.String(), err)
+	}
+	b.Reset()
+	if err := FormatText(&b, nil); err != nil || b.String() != "" {
+		t.Errorf("no diagnostics as text: %q, %v", b.String(), err)
+	}
+}
+
+// TestSortDiagnostics checks the order by position, then by code, and that
+// diagnostics with the same position and code keep their order
+func TestSortDiagnostics(t *testing.T) {
+	at := func(line, column int, code, message string) Diagnostic {
+		return Diagnostic{Code: code, Message: message, Span: Span{Start: Position{Line: line, Column: column}}}
+	}
+	diags := []Diagnostic{
+		at(2, 1, CodeUnexpectedToken, "a"),
+		at(1, 7, CodeUnexpectedToken, "b"),
+		at(1, 7, CodeUndefinedChar, "c"),
+		at(1, 12, CodeExpectedToken, "d"),
+		at(1, 7, CodeUnexpectedToken, "e"),
+		at(1, 2, CodeExtraTokens, "f"),
+	}
+	SortDiagnostics(diags)
+	var got []string
+	for _, d := range diags {
+		got = append(got, d.Message)
+	}
+	if want := "f c b e d a"; strings.Join(got, " ") != want {
+		t.Errorf("order %v, want %s", got, want)
+	}
+}
@@ -0,0 +1,35 @@
+package tiny_test
+
+import (
+	"fmt"
+	"strings"
+
+	"tinycompiler/tiny"
+)
+
+// Example scans and parses a program with the library, as the GUI and the
+// command-line driver do
+func Example() {
+	src := "read x;\nif 0 < x then\n  write x * 2\nend"
+	s := tiny.NewScanner(strings.NewReader(src))
+	if !s.Scan() {
+		fmt.Println(s.Errors())
+		return
+	}
+	tree, errors := tiny.NewParser(s.Tokens()).Parse()
+	if len(errors) > 0 {
+		fmt.Println(errors)
+		return
+	}
+	tiny.PrintSyntaxTree(tree, 0)
+	// Output:
+	// Read: x
+	// If
+	//   Op: <
+	//     Const: 0
+	//     Id: x
+	//   Write
+	//     Op: *
+	//       Id: x
+	//       Const: 2
+}
@@ -0,0 +1,87 @@
+package tiny
+
+import (
+	"fmt"
+	"io"
+	"os"
+)
+
+// Helper function to print the syntax tree
+func PrintSyntaxTree(node *TreeNode, indent int) {
+	FprintSyntaxTree(os.Stdout, node, indent)
+}
+
+// FprintSyntaxTree prints the syntax tree to w
+func FprintSyntaxTree(w io.Writer, node *TreeNode, indent int) {
+	if node == nil {
+		return
+	}
+
+	// Print indentation
+	for i := 0; i < indent; i++ {
+		fmt.Fprint(w, "  ")
+	}
+
+	// Print node information
+	switch node.NodeKind {
+	case StmtK:
+		FprintStmtNode(w, node)
+	case ExpK:
+		FprintExpNode(w, node)
+	case ErrorK:
+		fmt.Fprint(w, "Error")
+	}
+	fmt.Fprintln(w)
+
+	// Print children
+	for i := range node.Children {
+		if node.Children[i] != nil {
+			FprintSyntaxTree(w, node.Children[i], indent+1)
+		}
+	}
+
+	// Print siblings
+	if node.Sibling != nil {
+		FprintSyntaxTree(w, node.Sibling, indent)
+	}
+}
+
+func PrintStmtNode(node *TreeNode) {
+	FprintStmtNode(os.Stdout, node)
+}
+
+func FprintStmtNode(w io.Writer, node *TreeNode) {
+	switch node.StmtKind {
+	case IfK:
+		fmt.Fprint(w, "If")
+	case RepeatK:
+		fmt.Fprint(w, "Repeat")
+	case WhileK:
+		fmt.Fprint(w, "While")
+	case ForK:
+		fmt.Fprintf(w, "For: %s %s", node.Name, node.Op)
+	case AssignK:
+		fmt.Fprintf(w, "Assign to: %s", node.Name)
+	case ReadK:
+		fmt.Fprintf(w, "Read: %s", node.Name)
+	case WriteK:
+		fmt.Fprint(w, "Write")
+	}
+}
+
+func PrintExpNode(node *TreeNode) {
+	FprintExpNode(os.Stdout, node)
+}
+
+func FprintExpNode(w io.Writer, node *TreeNode) {
+	switch node.ExpKind {
+	case OpK:
+		fmt.Fprintf(w, "Op: %s", node.Op)
+	case ConstK:
+		fmt.Fprintf(w, "Const: %d", node.Value)
+	case IdK:
+		fmt.Fprintf(w, "Id: %s", node.Name)
+	case UnaryK:
+		fmt.Fprintf(w, "Unary: %s", node.Op)
+	}
+}
@@ -0,0 +1,638 @@
+package tiny
+
+import (
+	"fmt"
+	"strconv"
+)
+
+// TreeNode represents a node in the abstract syntax tree
+type TreeNode struct {
+	NodeKind NodeKind
+	StmtKind StmtKind
+	ExpKind  ExpKind
+	Children [4]*TreeNode // Max 4 children needed for for statements
+	Sibling  *TreeNode    // For statement sequences
+	Value    int          // For number constants
+	Name     string       // For identifiers
+	Op       string       // For operators, and "to" or "downto" in for statements
+	LineNum  int
+	Span     Span    // Source text the node was parsed from
+	Type     ExpType // Set on expressions by TypeCheck
+}
+
+// Enum declaration for NodeKind, StmtKind, ExpKind, ExpType
+type (
+	NodeKind int
+	StmtKind int
+	ExpKind  int
+	ExpType  int
+)
+
+// Enum NodeKind
+const (
+	StmtK NodeKind = iota
+	ExpK
+	ErrorK // Placeholder for a statement or expression that failed to parse
+)
+
+// Enum StmtKind
+const (
+	IfK StmtKind = iota
+	RepeatK
+	AssignK
+	ReadK
+	WriteK
+	WhileK
+	ForK
+)
+
+// Enum ExpKind
+const (
+	OpK ExpKind = iota
+	ConstK
+	IdK
+	UnaryK // Prefix operator applied to Children[0]
+)
+
+// Enum ExpType
+const (
+	Void ExpType = iota
+	Integer
+	Boolean
+)
+
+func (t ExpType) String() string {
+	return [...]string{
+		"void",
+		"integer",
+		"boolean",
+	}[t]
+}
+
+// Parser maintains the parsing state
+type Parser struct {
+	tokens    []Token
+	current   int
+	errors    []Diagnostic
+	panicMode bool // Set after a syntax error until the parser resynchronizes
+	errorAt   int  // Index of the token of the last syntax error, or -1
+}
+
+// NewParser creates a new parser instance. ERROR tokens left by the
+// scanner stay in the stream, so that the tokens around a bad character
+// are not spliced together; the parser treats them as syntax errors that
+// have already been reported.
+func NewParser(tokens []Token) *Parser {
+	return &Parser{
+		tokens:  tokens,
+		current: 0,
+		errors:  make([]Diagnostic, 0),
+		errorAt: -1,
+	}
+}
+
+// Parse initiates the parsing process
+// program = stmt-sequence
+func (p *Parser) Parse() (*TreeNode, []Diagnostic) {
+	tree := p.parseStmtSequence()
+	// A leftover token that already caused an error, like the 'end' of
+	// "x := 1; end", is not reported again
+	if p.current < len(p.tokens) && p.current != p.errorAt {
+		p.addError(CodeExtraTokens, "Extra tokens after program end")
+	}
+	return tree, p.errors
+}
+
+// parseStmtSequence implements stmt-sequence = statement {";" statement}
+func (p *Parser) parseStmtSequence() *TreeNode {
+	// Parse the first statement
+	firstStmt := p.parseStatement()
+	p.synchronize()
+
+	currentStmt := firstStmt
+
+	// Parse any additional statements after semicolons
+	for {
+		switch {
+		case p.currentToken().Type == SEMICOLON:
+			p.match(SEMICOLON)
+		case p.isStatementStart(p.currentToken().Type):
+			// A missing ';' between two statements: report it and carry on
+			// as if it were there
+			p.match(SEMICOLON)
+			p.panicMode = false
+		case !p.isSyncToken(p.currentToken().Type):
+			p.match(SEMICOLON)
+			p.synchronize()
+			continue
+		default:
+			return firstStmt
+		}
+
+		nextStmt := p.parseStatement()
+		p.synchronize()
+		currentStmt.Sibling = nextStmt
+		currentStmt = nextStmt
+	}
+}
+
+// parseStatement implements statement = if-stmt | repeat-stmt | while-stmt | for-stmt | assign-stmt | read-stmt | write-stmt
+func (p *Parser) parseStatement() *TreeNode {
+	switch p.currentToken().Type {
+	case IF:
+		return p.parseIfStmt()
+	case REPEAT:
+		return p.parseRepeatStmt()
+	case WHILE:
+		return p.parseWhileStmt()
+	case FOR:
+		return p.parseForStmt()
+	case IDENTIFIER:
+		return p.parseAssignStmt()
+	case READ:
+		return p.parseReadStmt()
+	case WRITE:
+		return p.parseWriteStmt()
+	default:
+		p.addError(CodeUnexpectedToken, fmt.Sprintf("Unexpected token: %v",
+			describeToken(p.currentToken())))
+		return p.errorNode()
+	}
+}
+
+// parseIfStmt implements if-stmt = "if" exp "then" stmt-sequence ["else" stmt-sequence] "end"
+func (p *Parser) parseIfStmt() *TreeNode {
+	node := &TreeNode{
+		NodeKind: StmtK,
+		StmtKind: IfK,
+		LineNum:  p.currentToken().LineNum,
+		Span:     Span{Start: p.currentToken().Span.Start},
+	}
+
+	p.match(IF)
+	node.Children[0] = p.parseExp()
+	p.match(THEN)
+	node.Children[1] = p.parseStmtSequence()
+
+	// Handle optional else clause
+	if p.currentToken().Type == ELSE {
+		p.match(ELSE)
+		node.Children[2] = p.parseStmtSequence()
+	}
+
+	p.match(END)
+	p.finishNode(node)
+	return node
+}
+
+// parseRepeatStmt implements repeat-stmt = "repeat" stmt-sequence "until" exp
+func (p *Parser) parseRepeatStmt() *TreeNode {
+	node := &TreeNode{
+		NodeKind: StmtK,
+		StmtKind: RepeatK,
+		LineNum:  p.currentToken().LineNum,
+		Span:     Span{Start: p.currentToken().Span.Start},
+	}
+
+	p.match(REPEAT)
+	node.Children[0] = p.parseStmtSequence()
+	p.match(UNTIL)
+	node.Children[1] = p.parseExp()
+	p.finishNode(node)
+	return node
+}
+
+// parseWhileStmt implements while-stmt = "while" exp "do" stmt-sequence "end"
+func (p *Parser) parseWhileStmt() *TreeNode {
+	node := &TreeNode{
+		NodeKind: StmtK,
+		StmtKind: WhileK,
+		LineNum:  p.currentToken().LineNum,
+		Span:     Span{Start: p.currentToken().Span.Start},
+	}
+
+	p.match(WHILE)
+	node.Children[0] = p.parseExp()
+	p.match(DO)
+	node.Children[1] = p.parseStmtSequence()
+	p.match(END)
+	p.finishNode(node)
+	return node
+}
+
+// parseForStmt implements for-stmt = "for" identifier ":=" exp ("to" | "downto") exp ["step" exp] "do" stmt-sequence "end".
+// The children are the start, limit, step and body, with a nil step
+// meaning 1. The loop sets i := start and then evaluates the limit and
+// step once, so changing the variables they use in the body does not
+// change how often it runs. It then runs like while i <= limit do body;
+// i := i + step end, or with >= and - for downto.
+func (p *Parser) parseForStmt() *TreeNode {
+	node := &TreeNode{
+		NodeKind: StmtK,
+		StmtKind: ForK,
+		LineNum:  p.currentToken().LineNum,
+		Span:     Span{Start: p.currentToken().Span.Start},
+	}
+
+	p.match(FOR)
+	node.Name = p.currentToken().Value
+	p.match(IDENTIFIER)
+	p.match(ASSIGN)
+	node.Children[0] = p.parseExp()
+	if p.currentToken().Type == DOWNTO {
+		node.Op = "downto"
+		p.match(DOWNTO)
+	} else {
+		node.Op = "to"
+		p.match(TO)
+	}
+	node.Children[1] = p.parseExp()
+	if p.currentToken().Type == STEP {
+		p.match(STEP)
+		node.Children[2] = p.parseExp()
+	}
+	p.match(DO)
+	node.Children[3] = p.parseStmtSequence()
+	p.match(END)
+	p.finishNode(node)
+	return node
+}
+
+// parseAssignStmt implements assign-stmt = identifier ":=" exp
+func (p *Parser) parseAssignStmt() *TreeNode {
+	node := &TreeNode{
+		NodeKind: StmtK,
+		StmtKind: AssignK,
+		Name:     p.currentToken().Value,
+		LineNum:  p.currentToken().LineNum,
+		Span:     Span{Start: p.currentToken().Span.Start},
+	}
+
+	p.match(IDENTIFIER)
+	p.match(ASSIGN)
+	node.Children[0] = p.parseExp()
+	p.finishNode(node)
+	return node
+}
+
+// parseReadStmt implements read-stmt = "read" identifier
+func (p *Parser) parseReadStmt() *TreeNode {
+	node := &TreeNode{
+		NodeKind: StmtK,
+		StmtKind: ReadK,
+		LineNum:  p.currentToken().LineNum,
+		Span:     Span{Start: p.currentToken().Span.Start},
+	}
+
+	p.match(READ)
+	node.Name = p.currentToken().Value
+	p.match(IDENTIFIER)
+	p.finishNode(node)
+	return node
+}
+
+// parseWriteStmt implements write-stmt = "write" exp
+func (p *Parser) parseWriteStmt() *TreeNode {
+	node := &TreeNode{
+		NodeKind: StmtK,
+		StmtKind: WriteK,
+		LineNum:  p.currentToken().LineNum,
+		Span:     Span{Start: p.currentToken().Span.Start},
+	}
+
+	p.match(WRITE)
+	node.Children[0] = p.parseExp()
+	p.finishNode(node)
+	return node
+}
+
+// parseExp implements exp = and-exp {"or" and-exp}
+func (p *Parser) parseExp() *TreeNode {
+	node := p.parseAndExp()
+
+	for p.currentToken().Type == OR {
+		newNode := &TreeNode{
+			NodeKind: ExpK,
+			ExpKind:  OpK,
+			Op:       p.currentToken().Value,
+			LineNum:  p.currentToken().LineNum,
+			Span:     Span{Start: node.Span.Start},
+		}
+
+		newNode.Children[0] = node
+		p.advance()
+		newNode.Children[1] = p.parseAndExp()
+		p.finishNode(newNode)
+		node = newNode
+	}
+
+	return node
+}
+
+// parseAndExp implements and-exp = not-exp {"and" not-exp}
+func (p *Parser) parseAndExp() *TreeNode {
+	node := p.parseNotExp()
+
+	for p.currentToken().Type == AND {
+		newNode := &TreeNode{
+			NodeKind: ExpK,
+			ExpKind:  OpK,
+			Op:       p.currentToken().Value,
+			LineNum:  p.currentToken().LineNum,
+			Span:     Span{Start: node.Span.Start},
+		}
+
+		newNode.Children[0] = node
+		p.advance()
+		newNode.Children[1] = p.parseNotExp()
+		p.finishNode(newNode)
+		node = newNode
+	}
+
+	return node
+}
+
+// parseNotExp implements not-exp = "not" not-exp | comparison
+func (p *Parser) parseNotExp() *TreeNode {
+	if p.currentToken().Type != NOT {
+		return p.parseComparison()
+	}
+
+	node := &TreeNode{
+		NodeKind: ExpK,
+		ExpKind:  UnaryK,
+		Op:       p.currentToken().Value,
+		LineNum:  p.currentToken().LineNum,
+		Span:     Span{Start: p.currentToken().Span.Start},
+	}
+
+	p.advance()
+	node.Children[0] = p.parseNotExp()
+	p.finishNode(node)
+	return node
+}
+
+// parseComparison implements comparison = simple-exp [comparison-op simple-exp]
+func (p *Parser) parseComparison() *TreeNode {
+	left := p.parseSimpleExp()
+
+	// Check for optional comparison operator
+	if p.isComparisonOp(p.currentToken().Type) {
+		node := &TreeNode{
+			NodeKind: ExpK,
+			ExpKind:  OpK,
+			Op:       p.currentToken().Value,
+			LineNum:  p.currentToken().LineNum,
+			Span:     Span{Start: left.Span.Start},
+		}
+
+		node.Children[0] = left
+		p.advance()
+		node.Children[1] = p.parseSimpleExp()
+		p.finishNode(node)
+		return node
+	}
+
+	return left
+}
+
+// parseSimpleExp implements simple-exp = term {addop term}
+func (p *Parser) parseSimpleExp() *TreeNode {
+	node := p.parseTerm()
+
+	// Handle repeated addop terms
+	for p.isAddOp(p.currentToken().Type) {
+		newNode := &TreeNode{
+			NodeKind: ExpK,
+			ExpKind:  OpK,
+			Op:       p.currentToken().Value,
+			LineNum:  p.currentToken().LineNum,
+			Span:     Span{Start: node.Span.Start},
+		}
+
+		newNode.Children[0] = node
+		p.advance()
+		newNode.Children[1] = p.parseTerm()
+		p.finishNode(newNode)
+		node = newNode
+	}
+
+	return node
+}
+
+// parseTerm implements term = factor {mulop factor}
+func (p *Parser) parseTerm() *TreeNode {
+	node := p.parseFactor()
+
+	// Handle repeated mulop factors
+	for p.isMulOp(p.currentToken().Type) {
+		newNode := &TreeNode{
+			NodeKind: ExpK,
+			ExpKind:  OpK,
+			Op:       p.currentToken().Value,
+			LineNum:  p.currentToken().LineNum,
+			Span:     Span{Start: node.Span.Start},
+		}
+
+		newNode.Children[0] = node
+		p.advance()
+		newNode.Children[1] = p.parseFactor()
+		p.finishNode(newNode)
+		node = newNode
+	}
+
+	return node
+}
+
+// parseFactor implements
+// factor = addop factor | "(" exp ")" | number | identifier
+func (p *Parser) parseFactor() *TreeNode {
+	var node *TreeNode
+
+	switch p.currentToken().Type {
+	case PLUS, MINUS:
+		// Prefix signs bind tighter than mulops, so -a * b is (-a) * b
+		node = &TreeNode{
+			NodeKind: ExpK,
+			ExpKind:  UnaryK,
+			Op:       p.currentToken().Value,
+			LineNum:  p.currentToken().LineNum,
+			Span:     Span{Start: p.currentToken().Span.Start},
+		}
+		p.advance()
+		node.Children[0] = p.parseFactor()
+		p.finishNode(node)
+
+	case OPENBRACKET:
+		// The span of a parenthesized expression includes the brackets
+		start := p.currentToken().Span.Start
+		p.match(OPENBRACKET)
+		node = p.parseExp()
+		p.match(CLOSEDBRACKET)
+		node.Span.Start = start
+		p.finishNode(node)
+
+	case NUMBER:
+		node = &TreeNode{
+			NodeKind: ExpK,
+			ExpKind:  ConstK,
+			Value:    p.parseNumber(p.currentToken().Value),
+			LineNum:  p.currentToken().LineNum,
+			Span:     p.currentToken().Span,
+		}
+		p.advance()
+
+	case IDENTIFIER:
+		node = &TreeNode{
+			NodeKind: ExpK,
+			ExpKind:  IdK,
+			Name:     p.currentToken().Value,
+			LineNum:  p.currentToken().LineNum,
+			Span:     p.currentToken().Span,
+		}
+		p.advance()
+
+	default:
+		p.addError(CodeUnexpectedToken, fmt.Sprintf("Unexpected token in factor: %v",
+			describeToken(p.currentToken())))
+		node = p.errorNode()
+	}
+
+	return node
+}
+
+// Helper functions
+func (p *Parser) currentToken() Token {
+	if p.current >= len(p.tokens) {
+		// Report the end of input at the last token rather than at line 0
+		end := Position{Line: 1, Column: 1}
+		if n := len(p.tokens); n > 0 {
+			end = p.tokens[n-1].Span.End
+		}
+		return Token{Type: EOF, LineNum: end.Line, CharNum: end.Column, Span: Span{Start: end, End: end}}
+	}
+	return p.tokens[p.current]
+}
+
+// Match token and consume. A successful match does not end panic mode:
+// after an error a token may match by accident, so the parser only trusts
+// the input again at a statement boundary.
+func (p *Parser) match(expected TokenType) bool {
+	if p.currentToken().Type == expected {
+		p.advance()
+		return true
+	}
+	p.addError(CodeExpectedToken, fmt.Sprintf("Expected %v but got %v",
+		expected.String(), p.currentToken().Type.String()))
+	return false
+}
+
+func (p *Parser) advance() {
+	p.current++
+}
+
+// addError records a syntax error at the current token and enters panic
+// mode. Errors found while already panicking are cascades of the first one
+// and are dropped, as are errors at a token the scanner already reported.
+func (p *Parser) addError(code, msg string) {
+	if p.panicMode {
+		return
+	}
+	p.panicMode = true
+	p.errorAt = p.current
+	if p.atLexicalError() {
+		return
+	}
+
+	p.errors = append(p.errors, Diagnostic{
+		Severity: SeverityError,
+		Code:     code,
+		Message:  msg,
+		Span:     p.currentToken().Span,
+	})
+}
+
+// atLexicalError reports whether the current token is one the scanner
+// reported: an ERROR token, or the end of input when an unmatched '{'
+// swallowed the rest of the program
+func (p *Parser) atLexicalError() bool {
+	if p.currentToken().Type == ERROR {
+		return true
+	}
+	n := len(p.tokens)
+	return p.current >= n && n > 0 && p.tokens[n-1].Type == ERROR && p.tokens[n-1].Value == "{"
+}
+
+// synchronize leaves panic mode by skipping tokens up to the next statement
+// boundary: ';', 'end', 'until', 'else' or the end of input
+func (p *Parser) synchronize() {
+	if !p.panicMode {
+		return
+	}
+	for !p.isSyncToken(p.currentToken().Type) {
+		p.advance()
+	}
+	p.panicMode = false
+}
+
+// errorNode creates a placeholder node for a construct that failed to parse
+func (p *Parser) errorNode() *TreeNode {
+	return &TreeNode{
+		NodeKind: ErrorK,
+		LineNum:  p.currentToken().LineNum,
+		Span:     p.currentToken().Span,
+	}
+}
+
+// finishNode ends the span of node at the last token consumed
+func (p *Parser) finishNode(node *TreeNode) {
+	if p.current > 0 && p.current <= len(p.tokens) {
+		end := p.tokens[p.current-1].Span.End
+		if end.Offset > node.Span.Start.Offset {
+			node.Span.End = end
+			return
+		}
+	}
+	node.Span.End = node.Span.Start
+}
+
+// describeToken names a token for error messages
+func describeToken(tok Token) string {
+	if tok.Value == "" {
+		return tok.Type.String()
+	}
+	return tok.Value
+}
+
+func (p *Parser) parseNumber(s string) int {
+	n, err := strconv.Atoi(s)
+	if err != nil {
+		p.addError(CodeInvalidNumber, fmt.Sprintf("Invalid number: %s", s))
+		return 0
+	}
+	return n
+}
+
+func (p *Parser) isSyncToken(t TokenType) bool {
+	return t == SEMICOLON || t == END || t == UNTIL || t == ELSE || t == EOF
+}
+
+func (p *Parser) isStatementStart(t TokenType) bool {
+	return t == IF || t == REPEAT || t == WHILE || t == FOR || t == IDENTIFIER || t == READ || t == WRITE
+}
+
+func (p *Parser) isComparisonOp(t TokenType) bool {
+	switch t {
+	case LESSTHAN, GREATERTHAN, LESSEQUAL, GREATEREQUAL, EQUAL, NOTEQUAL:
+		return true
+	}
+	return false
+}
+
+func (p *Parser) isAddOp(t TokenType) bool {
+	return t == PLUS || t == MINUS
+}
+
+func (p *Parser) isMulOp(t TokenType) bool {
+	return t == MULT || t == DIV
+}
@@ -0,0 +1,128 @@
+package tiny
+
+import (
+	"fmt"
+	"slices"
+	"strings"
+	"testing"
+)
+
+// frontEnd scans and parses src and returns the syntax tree with the
+// lexical and syntax errors in source order
+func frontEnd(src string) (*TreeNode, []Diagnostic) {
+	s := NewScanner(strings.NewReader(src))
+	s.Scan()
+	tree, errors := NewParser(s.Tokens()).Parse()
+	diags := append(s.Errors(), errors...)
+	SortDiagnostics(diags)
+	return tree, diags
+}
+
+// positions describes each diagnostic as "line:column code"
+func positions(diags []Diagnostic) []string {
+	var out []string
+	for _, d := range diags {
+		out = append(out, fmt.Sprintf("%d:%d %s", d.Span.Start.Line, d.Span.Start.Column, d.Code))
+	}
+	return out
+}
+
+// TestLexicalErrorsNotRepeated checks that the parser does not report
+// syntax errors caused by a bad character the scanner already reported
+func TestLexicalErrorsNotRepeated(t *testing.T) {
+	tests := []struct {
+		name string
+		src  string
+		want []string
+	}{
+		{"bad characters", "x := 1 $ 2 @ 3; write x : y",
+			[]string{"1:8 L003", "1:12 L003", "1:25 L002"}},
+		{"unmatched comment", "{", []string{"1:1 L001"}},
+		{"comment hides end", "if x < 1 then write 1 { end",
+			[]string{"1:23 L001"}},
+		{"syntax error after bad character", "x := 1 $;\nwrite ;\nwrite x",
+			[]string{"1:8 L003", "2:7 P001"}},
+		{"sorted by position", "x := ; $",
+			[]string{"1:6 P001", "1:8 L003"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, diags := frontEnd(tt.src)
+			if got := positions(diags); !slices.Equal(got, tt.want) {
+				t.Errorf("got %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+// TestSyntaxErrorRecovery checks that panic mode reports one error per
+// mistake and no cascades
+func TestSyntaxErrorRecovery(t *testing.T) {
+	tests := []struct {
+		name string
+		src  string
+		want []string
+	}{
+		{"valid", "read x; if x < 1 then write 1 else write 2 end", nil},
+		{"token matched while panicking", "if x y then a := 1 end",
+			[]string{"1:6 P002"}},
+		{"stray end", "x := 1; end", []string{"1:9 P001"}},
+		{"extra tokens", "repeat x := 1 until x = 1 until",
+			[]string{"1:27 P003"}},
+		{"missing semicolon", "x := 1\ny := 2", []string{"2:1 P002"}},
+		{"one error per statement", "if (x then write 1 end;\nwrite 2 3;\nrepeat x := 1 until;\nread",
+			[]string{"1:7 P002", "2:9 P002", "3:20 P001", "4:5 P002"}},
+		{"bad factor", "write * 2; write 3", []string{"1:7 P001"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, diags := frontEnd(tt.src)
+			if got := positions(diags); !slices.Equal(got, tt.want) {
+				t.Errorf("got %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+// TestSyntaxErrorTree checks that the parser keeps the tree of a program
+// with syntax errors, with an ErrorK node where each bad statement or
+// expression was and the statements after it parsed as usual
+func TestSyntaxErrorTree(t *testing.T) {
+	tests := []struct {
+		name string
+		src  string
+		want string
+	}{
+		{"bad statement", "then; write 1",
+			"Error\nWrite\n  Const: 1\n"},
+		{"missing expression", "x := ; write 1",
+			"Assign to: x\n  Error\nWrite\n  Const: 1\n"},
+		{"bad operand", "x := (1 + ; write x",
+			"Assign to: x\n  Op: +\n    Const: 1\n    Error\nWrite\n  Id: x\n"},
+		{"inside a loop", "repeat x := until x = 1; write 2",
+			"Repeat\n  Assign to: x\n    Error\n  Op: =\n    Id: x\n    Const: 1\nWrite\n  Const: 2\n"},
+		{"missing semicolon", "x := 1\ny := 2",
+			"Assign to: x\n  Const: 1\nAssign to: y\n  Const: 2\n"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tree, diags := frontEnd(tt.src)
+			if len(diags) != 1 {
+				t.Errorf("diagnostics %v, want one", positions(diags))
+			}
+			var b strings.Builder
+			FprintSyntaxTree(&b, tree, 0)
+			if got := b.String(); got != tt.want {
+				t.Errorf("tree:\n%s\nwant:\n%s", got, tt.want)
+			}
+		})
+	}
+
+	tree, _ := frontEnd("x := ; write 1")
+	if tree == nil || tree.Sibling == nil || tree.Sibling.StmtKind != WriteK {
+		t.Fatalf("statement after the error lost: %+v", tree)
+	}
+	if tree.Children[0] == nil || tree.Children[0].NodeKind != ErrorK {
+		t.Errorf("assigned %+v, want an ErrorK node", tree.Children[0])
+	}
+}
@@ -0,0 +1,373 @@
+// Package tiny implements the front end of the TINY compiler: the scanner,
+// the recursive descent parser and the syntax tree they produce.
+package tiny
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+)
+
+// TokenType represents different types of tokens using an enum
+type TokenType int
+
+// Token type constants defined as enum values
+const (
+	// Special tokens
+	ERROR TokenType = iota // Using 0 as ERROR helps detect uninitialized tokens
+	EOF
+
+	// Reserved words
+	IF
+	THEN
+	ELSE
+	END
+	REPEAT
+	UNTIL
+	WHILE
+	DO
+	FOR
+	TO
+	DOWNTO
+	STEP
+	AND
+	OR
+	NOT
+	READ
+	WRITE
+
+	// Special symbols
+	SEMICOLON     // ;
+	LESSTHAN      // <
+	GREATERTHAN   // >
+	LESSEQUAL     // <=
+	GREATEREQUAL  // >=
+	NOTEQUAL      // <>
+	OPENBRACKET   // (
+	CLOSEDBRACKET // )
+	PLUS          // +
+	MINUS         // -
+	MULT          // *
+	DIV           // /
+	EQUAL         // =
+	ASSIGN        // :=
+
+	// Multi-character tokens
+	NUMBER
+	IDENTIFIER
+)
+
+// Token struct now uses the enum type
+type Token struct {
+	Value   string
+	Type    TokenType
+	LineNum int // Added for better error reporting
+	CharNum int // Column of the first character
+	Span    Span
+}
+
+// Scanner struct remains similar but with better organization
+type Scanner struct {
+	r       *bufio.Reader
+	tokens  []Token
+	errors  []Diagnostic
+	CharNum int
+	LineNum int
+	Offset  int
+	next    Position // Position of the next byte to be read
+}
+
+// Tokens returns the tokens recognized by the last call to Scan
+func (s *Scanner) Tokens() []Token {
+	return s.tokens
+}
+
+// Errors returns the lexical errors recorded by the last call to Scan
+func (s *Scanner) Errors() []Diagnostic {
+	return s.errors
+}
+
+func (s *Scanner) PrintTokens() string {
+	var output string
+	for _, token := range s.tokens {
+		output += fmt.Sprintf("%v, %v\n", token.Value, token.Type.String())
+	}
+	return output
+}
+
+// String method for TokenType provides readable token types for debugging
+func (t TokenType) String() string {
+	return [...]string{
+		"ERROR",
+		"EOF",
+		"IF",
+		"THEN",
+		"ELSE",
+		"END",
+		"REPEAT",
+		"UNTIL",
+		"WHILE",
+		"DO",
+		"FOR",
+		"TO",
+		"DOWNTO",
+		"STEP",
+		"AND",
+		"OR",
+		"NOT",
+		"READ",
+		"WRITE",
+		"SEMICOLON",
+		"LESSTHAN",
+		"GREATERTHAN",
+		"LESSEQUAL",
+		"GREATEREQUAL",
+		"NOTEQUAL",
+		"OPENBRACKET",
+		"CLOSEDBRACKET",
+		"PLUS",
+		"MINUS",
+		"MULT",
+		"DIV",
+		"EQUAL",
+		"ASSIGN",
+		"NUMBER",
+		"IDENTIFIER",
+	}[t]
+}
+
+// Helper functions remain the same
+func isWhitespace(c byte) bool {
+	return c == ' ' || c == '\t' || c == '\r' || c == '\n'
+}
+
+func isSingleOperator(c byte) bool {
+	return c == ';' || c == '(' || c == ')' ||
+		c == '+' || c == '-' || c == '*' || c == '/' || c == '='
+}
+
+func isAlphabet(c byte) bool {
+	return (c >= 'A' && c <= 'Z') || (c >= 'a' && c <= 'z')
+}
+
+func isNumber(c byte) bool {
+	return c >= '0' && c <= '9'
+}
+
+// getTokenType now returns TokenType instead of string
+func getTokenType(c string) TokenType {
+	// Map of reserved words to their token types
+	reservedWords := map[string]TokenType{
+		"if":     IF,
+		"then":   THEN,
+		"else":   ELSE,
+		"end":    END,
+		"repeat": REPEAT,
+		"until":  UNTIL,
+		"while":  WHILE,
+		"do":     DO,
+		"for":    FOR,
+		"to":     TO,
+		"downto": DOWNTO,
+		"step":   STEP,
+		"and":    AND,
+		"or":     OR,
+		"not":    NOT,
+		"read":   READ,
+		"write":  WRITE,
+	}
+
+	// First check if it's a reserved word
+	if tokenType, ok := reservedWords[c]; ok {
+		return tokenType
+	}
+
+	// Then check operators
+	operators := map[string]TokenType{
+		";":  SEMICOLON,
+		"<":  LESSTHAN,
+		">":  GREATERTHAN,
+		"<=": LESSEQUAL,
+		">=": GREATEREQUAL,
+		"<>": NOTEQUAL,
+		"(":  OPENBRACKET,
+		")":  CLOSEDBRACKET,
+		"+":  PLUS,
+		"-":  MINUS,
+		"*":  MULT,
+		"/":  DIV,
+		"=":  EQUAL,
+	}
+
+	if tokenType, ok := operators[c]; ok {
+		return tokenType
+	}
+
+	// Default case
+	return IDENTIFIER
+}
+
+// NewScanner creates a scanner reading TINY source from r
+func NewScanner(r io.Reader) *Scanner {
+	return &Scanner{
+		r:       bufio.NewReader(r),
+		CharNum: 0,
+		LineNum: 1,
+		next:    Position{Line: 1, Column: 1},
+	}
+}
+
+// Read consumes the next byte. Afterwards LineNum, CharNum and Offset give
+// the position of that byte, or the end of input once Read returns io.EOF.
+// Columns count bytes, so a tab advances the column by one like any other
+// character, and the '\r' of a "\r\n" pair stays on the line it ends.
+func (s *Scanner) Read() (byte, error) {
+	char, err := s.r.ReadByte()
+	s.LineNum, s.CharNum, s.Offset = s.next.Line, s.next.Column, s.next.Offset
+	if err != nil {
+		return char, err
+	}
+
+	s.next.Offset++
+	if char == '\n' {
+		s.next.Line++
+		s.next.Column = 1
+	} else {
+		s.next.Column++
+	}
+	return char, err
+}
+
+// pos returns the position of the last byte read
+func (s *Scanner) pos() Position {
+	return Position{Line: s.LineNum, Column: s.CharNum, Offset: s.Offset}
+}
+
+// addToken records a token that starts at start and ends just before the
+// byte that was read last
+func (s *Scanner) addToken(value string, tokenType TokenType, start Position) {
+	s.tokens = append(s.tokens, Token{
+		Value:   value,
+		Type:    tokenType,
+		LineNum: start.Line,
+		CharNum: start.Column,
+		Span:    Span{Start: start, End: s.pos()},
+	})
+}
+
+// Scan tokenizes the whole input. Lexical errors do not stop the scan: each
+// one is recorded as an ERROR token plus a diagnostic, so a single pass
+// reports all of them. Scan returns false if any error was found.
+func (s *Scanner) Scan() bool {
+	char, err := s.Read()
+	if err != nil {
+		if err == io.EOF {
+			return true
+		}
+		panic(err)
+	}
+
+	for {
+		if err != nil {
+			if err == io.EOF {
+				break
+			}
+			panic(err)
+		}
+
+		start := s.pos()
+		switch {
+		case isWhitespace(char):
+			char, err = s.Read()
+			continue
+
+		case char == '{':
+			for char != '}' {
+				char, err = s.Read()
+				if err != nil {
+					if err == io.EOF {
+						s.error(CodeUnmatchedComment, "unmatched '{'", "{", start)
+						return false
+					}
+					panic(err)
+				}
+			}
+			char, err = s.Read()
+
+		case isSingleOperator(char):
+			op := string(char)
+			char, err = s.Read()
+			s.addToken(op, getTokenType(op), start)
+
+		case char == '<' || char == '>':
+			op := string(char)
+			char, err = s.Read()
+			if err != nil && err != io.EOF {
+				panic(err)
+			}
+			if err == nil && (char == '=' || op == "<" && char == '>') {
+				op += string(char)
+				char, err = s.Read()
+			}
+			s.addToken(op, getTokenType(op), start)
+
+		case char == ':':
+			char, err = s.Read()
+			if err != nil && err != io.EOF {
+				panic(err)
+			}
+			if err == nil && char == '=' {
+				char, err = s.Read()
+				s.addToken(":=", ASSIGN, start)
+			} else {
+				// Keep the character after ':' for the next token
+				s.error(CodeBadAssign, "':' not followed by '='", ":", start)
+			}
+
+		case isNumber(char):
+			var number []byte
+			for isNumber(char) {
+				number = append(number, char)
+				char, err = s.Read()
+				if err != nil && err != io.EOF {
+					panic(err)
+				}
+			}
+			s.addToken(string(number), NUMBER, start)
+
+		case isAlphabet(char):
+			var identifier []byte
+			for isAlphabet(char) {
+				identifier = append(identifier, char)
+				char, err = s.Read()
+				if err != nil && err != io.EOF {
+					panic(err)
+				}
+			}
+			word := string(identifier)
+			s.addToken(word, getTokenType(word), start)
+
+		default:
+			bad := string(char)
+			char, err = s.Read()
+			s.error(CodeUndefinedChar, "undefined character entered '"+bad+"'", bad, start)
+		}
+	}
+	return len(s.errors) == 0
+}
+
+// error records an ERROR token for lexeme together with a diagnostic. Both
+// span from start to the last byte read.
+func (s *Scanner) error(code, msg, lexeme string, start Position) {
+	s.addToken(lexeme, ERROR, start)
+	s.addError(code, msg, s.tokens[len(s.tokens)-1].Span)
+}
+
+func (s *Scanner) addError(code, msg string, span Span) {
+	s.errors = append(s.errors, Diagnostic{
+		Severity: SeverityError,
+		Code:     code,
+		Message:  msg,
+		Span:     span,
+	})
+}
@@ -0,0 +1,134 @@
+package tiny
+
+import (
+	"fmt"
+	"slices"
+	"strings"
+	"testing"
+)
+
+// spans describes each token as "value start-end", with positions given as
+// line:column@offset
+func spans(tokens []Token) []string {
+	var out []string
+	for _, tok := range tokens {
+		s, e := tok.Span.Start, tok.Span.End
+		out = append(out, fmt.Sprintf("%s %d:%d@%d-%d:%d@%d",
+			tok.Value, s.Line, s.Column, s.Offset, e.Line, e.Column, e.Offset))
+	}
+	return out
+}
+
+// TestTokenSpans checks the positions the scanner gives tokens. Columns
+// count bytes, so a tab is one column, and a '\r' before '\n' belongs to
+// the line it ends.
+func TestTokenSpans(t *testing.T) {
+	tests := []struct {
+		name string
+		src  string
+		want []string
+	}{
+		{"single line", "x := 10",
+			[]string{"x 1:1@0-1:2@1", ":= 1:3@2-1:5@4", "10 1:6@5-1:8@7"}},
+		{"newlines", "read x;\nwrite x",
+			[]string{"read 1:1@0-1:5@4", "x 1:6@5-1:7@6", "; 1:7@6-1:8@7",
+				"write 2:1@8-2:6@13", "x 2:7@14-2:8@15"}},
+		{"tabs", "\tx\t:=\t1",
+			[]string{"x 1:2@1-1:3@2", ":= 1:4@3-1:6@5", "1 1:7@6-1:8@7"}},
+		{"crlf", "read x;\r\nwrite x\r\n",
+			[]string{"read 1:1@0-1:5@4", "x 1:6@5-1:7@6", "; 1:7@6-1:8@7",
+				"write 2:1@9-2:6@14", "x 2:7@15-2:8@16"}},
+		{"comment", "{ a\ncomment } x",
+			[]string{"x 2:11@14-2:12@15"}},
+		{"no spaces", "a:=b*2",
+			[]string{"a 1:1@0-1:2@1", ":= 1:2@1-1:4@3", "b 1:4@3-1:5@4",
+				"* 1:5@4-1:6@5", "2 1:6@5-1:7@6"}},
+		{"bad character", "x @ y",
+			[]string{"x 1:1@0-1:2@1", "@ 1:3@2-1:4@3", "y 1:5@4-1:6@5"}},
+		{"two-character operators", "a<=b<>c",
+			[]string{"a 1:1@0-1:2@1", "<= 1:2@1-1:4@3", "b 1:4@3-1:5@4", "<> 1:5@4-1:7@6", "c 1:7@6-1:8@7"}},
+		{"greater than", "a>=b>c",
+			[]string{"a 1:1@0-1:2@1", ">= 1:2@1-1:4@3", "b 1:4@3-1:5@4", "> 1:5@4-1:6@5", "c 1:6@5-1:7@6"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s := NewScanner(strings.NewReader(tt.src))
+			s.Scan()
+			if got := spans(s.Tokens()); !slices.Equal(got, tt.want) {
+				t.Errorf("got  %q\nwant %q", got, tt.want)
+			}
+			for _, tok := range s.Tokens() {
+				if tok.LineNum != tok.Span.Start.Line || tok.CharNum != tok.Span.Start.Column {
+					t.Errorf("token %q at %d:%d, span starts at %d:%d", tok.Value,
+						tok.LineNum, tok.CharNum, tok.Span.Start.Line, tok.Span.Start.Column)
+				}
+			}
+		})
+	}
+}
+
+// TestScanErrors checks the codes and spans of lexical errors
+func TestScanErrors(t *testing.T) {
+	tests := []struct {
+		name string
+		src  string
+		want []string
+	}{
+		{"undefined character", "x := 1 # 2", []string{"1:8 L003"}},
+		{"colon without equals", "x : 1", []string{"1:3 L002"}},
+		{"unmatched comment", "x := 1\n{ never closed", []string{"2:1 L001"}},
+		{"every error", "$\n:\n{", []string{"1:1 L003", "2:1 L002", "3:1 L001"}},
+		{"no errors", "x := 1", nil},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s := NewScanner(strings.NewReader(tt.src))
+			if ok := s.Scan(); ok != (tt.want == nil) {
+				t.Errorf("Scan() = %v", ok)
+			}
+			if got := positions(s.Errors()); !slices.Equal(got, tt.want) {
+				t.Errorf("got %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+// TestNodeSpans checks that syntax tree nodes cover the source text they
+// were parsed from
+func TestNodeSpans(t *testing.T) {
+	src := "read x;\nif x < 10 then\n  x := (x + 1) * 2\nend;\nwhile x > 0 do\n  x := x - 1\nend"
+	tree, diags := frontEnd(src)
+	if len(diags) != 0 {
+		t.Fatalf("unexpected errors: %v", diags)
+	}
+
+	text := func(node *TreeNode) string {
+		return src[node.Span.Start.Offset:node.Span.End.Offset]
+	}
+	ifStmt := tree.Sibling
+	assign := ifStmt.Children[1]
+	whileStmt := ifStmt.Sibling
+	tests := []struct {
+		node *TreeNode
+		want string
+	}{
+		{tree, "read x"},
+		{ifStmt, "if x < 10 then\n  x := (x + 1) * 2\nend"},
+		{ifStmt.Children[0], "x < 10"},
+		{ifStmt.Children[0].Children[1], "10"},
+		{assign, "x := (x + 1) * 2"},
+		{assign.Children[0], "(x + 1) * 2"},
+		{assign.Children[0].Children[1], "2"},
+		{whileStmt, "while x > 0 do\n  x := x - 1\nend"},
+		{whileStmt.Children[0], "x > 0"},
+		{whileStmt.Children[1], "x := x - 1"},
+	}
+	for _, tt := range tests {
+		if got := text(tt.node); got != tt.want {
+			t.Errorf("node spans %q, want %q", got, tt.want)
+		}
+	}
+	if assign.LineNum != 3 || assign.Span.Start.Column != 3 {
+		t.Errorf("assignment at %d:%d, want 3:3", assign.LineNum, assign.Span.Start.Column)
+	}
+}
@@ -0,0 +1,77 @@
+package tiny
+
+import (
+	"fmt"
+	"io"
+)
+
+// Symbol is a variable entry in the symbol table
+type Symbol struct {
+	Name     string
+	Location int   // Memory location assigned to the variable
+	DefLine  int   // Line of the first assignment or read, 0 if never defined
+	Lines    []int // Every line that references the variable
+}
+
+// SymbolTable maps variable names to their symbols. Locations are handed
+// out in order of first appearance, starting at 0.
+type SymbolTable struct {
+	symbols map[string]*Symbol
+	order   []*Symbol
+}
+
+// NewSymbolTable creates an empty symbol table
+func NewSymbolTable() *SymbolTable {
+	return &SymbolTable{
+		symbols: make(map[string]*Symbol),
+	}
+}
+
+// Insert records a reference to name on line. The first reference gives the
+// variable its memory location; def marks references that define it.
+func (t *SymbolTable) Insert(name string, line int, def bool) *Symbol {
+	sym, ok := t.symbols[name]
+	if !ok {
+		sym = &Symbol{
+			Name:     name,
+			Location: len(t.order),
+		}
+		t.symbols[name] = sym
+		t.order = append(t.order, sym)
+	}
+
+	sym.Lines = append(sym.Lines, line)
+	if def && sym.DefLine == 0 {
+		sym.DefLine = line
+	}
+	return sym
+}
+
+// Lookup returns the symbol for name, or nil if it is not in the table
+func (t *SymbolTable) Lookup(name string) *Symbol {
+	return t.symbols[name]
+}
+
+// Symbols returns every symbol ordered by memory location
+func (t *SymbolTable) Symbols() []*Symbol {
+	return t.order
+}
+
+// Len returns the number of variables in the table
+func (t *SymbolTable) Len() int {
+	return len(t.order)
+}
+
+// Print writes the table in the traditional TINY listing format
+func (t *SymbolTable) Print(w io.Writer) {
+	fmt.Fprintln(w, "Variable Name  Location   Line Numbers")
+	fmt.Fprintln(w, "-------------  --------   ------------")
+	for _, sym := range t.order {
+		fmt.Fprintf(w, "%-14s ", sym.Name)
+		fmt.Fprintf(w, "%-8d  ", sym.Location)
+		for _, line := range sym.Lines {
+			fmt.Fprintf(w, "%4d ", line)
+		}
+		fmt.Fprintln(w)
+	}
+}
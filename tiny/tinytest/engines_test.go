@@ -0,0 +1,257 @@
+package tinytest_test
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"regexp"
+	"runtime"
+	"strconv"
+	"strings"
+	"testing"
+
+	"tinycompiler/amd64"
+	"tinycompiler/bytecode"
+	"tinycompiler/cgen"
+	"tinycompiler/gogen"
+	"tinycompiler/interp"
+	"tinycompiler/llvm"
+	"tinycompiler/opt"
+	"tinycompiler/tiny"
+	"tinycompiler/tiny/tinytest"
+	"tinycompiler/tm"
+	"tinycompiler/wasm"
+)
+
+// engine runs a checked syntax tree with the given input and returns what
+// it wrote. An error means the program stopped early.
+type engine struct {
+	name string
+	skip func(t *testing.T) // Skips the test if the engine cannot run here
+	run  func(t *testing.T, tree *tiny.TreeNode, input string) (string, error)
+}
+
+var engines = []engine{
+	{"interp", nil, runInterp},
+	{"optimized", nil, func(t *testing.T, tree *tiny.TreeNode, input string) (string, error) {
+		m, err := opt.NewPassManager(opt.Level(2))
+		if err != nil {
+			t.Fatal(err)
+		}
+		return runInterp(t, m.Run(tree), input)
+	}},
+	{"tm", nil, runTM},
+	{"vm", nil, runVM},
+	{"amd64", skipUnlessAMD64, runAMD64},
+	{"wasm", needs("node"), runWasm},
+	{"llvm", needs("lli"), runLLVM},
+	{"c", needs("cc"), runC},
+	{"go", skipGo, runGo},
+}
+
+// TestEngines runs every shared program on every engine
+func TestEngines(t *testing.T) {
+	for _, e := range engines {
+		t.Run(e.name, func(t *testing.T) {
+			if e.skip != nil {
+				e.skip(t)
+			}
+			for _, p := range tinytest.Programs {
+				t.Run(p.Name, func(t *testing.T) {
+					t.Parallel()
+					out, err := e.run(t, tinytest.Parse(t, p.Src), p.Input)
+					if got := strings.Join(strings.Fields(out), " "); got != p.Want {
+						t.Errorf("wrote %q, want %q", got, p.Want)
+					}
+					switch {
+					case p.DivByZero && (err == nil || !strings.Contains(err.Error(), "division by zero")):
+						t.Errorf("stopped with %v, want a division by zero", err)
+					case !p.DivByZero && err != nil:
+						t.Errorf("stopped with %v", err)
+					}
+				})
+			}
+		})
+	}
+}
+
+func runInterp(t *testing.T, tree *tiny.TreeNode, input string) (string, error) {
+	var out bytes.Buffer
+	err := interp.New(strings.NewReader(input), &out).Run(tree)
+	return out.String(), err
+}
+
+func runTM(t *testing.T, tree *tiny.TreeNode, input string) (string, error) {
+	var code bytes.Buffer
+	if err := tm.Generate(&code, tree, nil, tm.Options{}); err != nil {
+		t.Fatal(err)
+	}
+	var out bytes.Buffer
+	m := tm.NewMachine(strings.NewReader(input), &out)
+	if err := m.Load(&code); err != nil {
+		t.Fatal(err)
+	}
+	switch result := m.Run(); result {
+	case tm.Halted:
+		return out.String(), nil
+	case tm.ZeroDivide:
+		return out.String(), errors.New("division by zero")
+	default:
+		return out.String(), errors.New(result.String())
+	}
+}
+
+func runVM(t *testing.T, tree *tiny.TreeNode, input string) (string, error) {
+	prog, err := bytecode.Compile(tree)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var out bytes.Buffer
+	err = bytecode.NewVM(strings.NewReader(input), &out).Run(prog)
+	return out.String(), err
+}
+
+func skipUnlessAMD64(t *testing.T) {
+	if runtime.GOOS != "linux" || runtime.GOARCH != "amd64" {
+		t.Skip("executables only run on linux/amd64")
+	}
+}
+
+func runAMD64(t *testing.T, tree *tiny.TreeNode, input string) (string, error) {
+	var b bytes.Buffer
+	if err := amd64.Build(&b, tree); err != nil {
+		t.Fatal(err)
+	}
+	exe := writeFile(t, "prog", b.Bytes(), 0o755)
+	return execute(exec.Command(exe), input)
+}
+
+// wasmRunner instantiates the module named by its argument with the
+// imports the generated code expects
+const wasmRunner = `const fs = require('fs');
+const input = fs.readFileSync(0, 'utf8').split(/\s+/).filter(s => s !== '').map(BigInt);
+let next = 0;
+const env = {
+	read: () => {
+		if (next === input.length) {
+			process.stderr.write('runtime error: out of input\n');
+			process.exit(1);
+		}
+		return input[next++];
+	},
+	write: v => { process.stdout.write(v + '\n'); },
+	divzero: line => {
+		process.stderr.write('runtime error: division by zero at line ' + line + '\n');
+		process.exit(1);
+	},
+};
+WebAssembly.instantiate(fs.readFileSync(process.argv[2]), {env}).then(r => r.instance.exports.main());
+`
+
+func runWasm(t *testing.T, tree *tiny.TreeNode, input string) (string, error) {
+	module, err := wasm.Compile(tree)
+	if err != nil {
+		t.Fatal(err)
+	}
+	js := writeFile(t, "run.js", []byte(wasmRunner), 0o644)
+	return execute(exec.Command("node", js, writeFile(t, "prog.wasm", module, 0o644)), input)
+}
+
+// lliFlags returns the flags lli needs for the opaque pointers of the
+// generated IR, which LLVM 14 only reads when asked to
+func lliFlags(t *testing.T) []string {
+	out, err := exec.Command("lli", "--version").Output()
+	if err != nil {
+		t.Skip("lli does not run:", err)
+	}
+	m := regexp.MustCompile(`LLVM version (\d+)`).FindSubmatch(out)
+	if m == nil {
+		t.Skip("unknown lli version")
+	}
+	switch version, _ := strconv.Atoi(string(m[1])); {
+	case version < 14:
+		t.Skipf("LLVM %d is too old", version)
+	case version == 14:
+		return []string{"-opaque-pointers"}
+	}
+	return nil
+}
+
+func runLLVM(t *testing.T, tree *tiny.TreeNode, input string) (string, error) {
+	var b bytes.Buffer
+	if err := llvm.Generate(&b, tree, nil, llvm.Options{File: "prog.tny"}); err != nil {
+		t.Fatal(err)
+	}
+	args := append(lliFlags(t), writeFile(t, "prog.ll", b.Bytes(), 0o644))
+	return execute(exec.Command("lli", args...), input)
+}
+
+func runC(t *testing.T, tree *tiny.TreeNode, input string) (string, error) {
+	var b bytes.Buffer
+	if err := cgen.Generate(&b, tree, nil, cgen.Options{File: "prog.tny"}); err != nil {
+		t.Fatal(err)
+	}
+	c := writeFile(t, "prog.c", b.Bytes(), 0o644)
+	exe := strings.TrimSuffix(c, ".c")
+	if out, err := exec.Command("cc", "-std=c99", "-o", exe, c).CombinedOutput(); err != nil {
+		t.Fatalf("%v:\n%s", err, out)
+	}
+	return execute(exec.Command(exe), input)
+}
+
+func skipGo(t *testing.T) {
+	if testing.Short() {
+		t.Skip("builds Go programs")
+	}
+	needs("go")(t)
+}
+
+func runGo(t *testing.T, tree *tiny.TreeNode, input string) (string, error) {
+	var b bytes.Buffer
+	if err := gogen.Generate(&b, tree, nil, gogen.Options{File: "prog.tny"}); err != nil {
+		t.Fatal(err)
+	}
+	src := writeFile(t, "prog.go", b.Bytes(), 0o644)
+	exe := strings.TrimSuffix(src, ".go")
+	build := exec.Command("go", "build", "-o", exe, src)
+	build.Dir = filepath.Dir(src)
+	if out, err := build.CombinedOutput(); err != nil {
+		t.Fatalf("%v:\n%s", err, out)
+	}
+	return execute(exec.Command(exe), input)
+}
+
+// needs returns a skip function for engines that run the named tool
+func needs(tool string) func(t *testing.T) {
+	return func(t *testing.T) {
+		if _, err := exec.LookPath(tool); err != nil {
+			t.Skipf("no %s command", tool)
+		}
+	}
+}
+
+// writeFile writes data to a file of the test's temporary directory and
+// returns its path
+func writeFile(t *testing.T, name string, data []byte, perm os.FileMode) string {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), name)
+	if err := os.WriteFile(path, data, perm); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+// execute runs cmd with the given input. If it fails, the error includes
+// what it wrote to standard error.
+func execute(cmd *exec.Cmd, input string) (string, error) {
+	cmd.Stdin = strings.NewReader(input)
+	var stdout, stderr bytes.Buffer
+	cmd.Stdout, cmd.Stderr = &stdout, &stderr
+	if err := cmd.Run(); err != nil {
+		return stdout.String(), fmt.Errorf("%v: %s", err, stderr.String())
+	}
+	return stdout.String(), nil
+}
@@ -0,0 +1,107 @@
+// Package tinytest holds what the tests of the TINY engines and code
+// generators share: a helper that turns source into a checked syntax tree
+// and the programs every engine must run alike.
+package tinytest
+
+import (
+	"strings"
+	"testing"
+
+	"tinycompiler/tiny"
+)
+
+// Parse scans, parses and type checks src, failing tb on any error
+func Parse(tb testing.TB, src string) *tiny.TreeNode {
+	tb.Helper()
+	s := tiny.NewScanner(strings.NewReader(src))
+	if !s.Scan() {
+		tb.Fatalf("scan: %v", s.Errors())
+	}
+	tree, diags := tiny.NewParser(s.Tokens()).Parse()
+	if tiny.HasErrors(diags) {
+		tb.Fatalf("parse: %v", diags)
+	}
+	if diags := tiny.TypeCheck(tree); tiny.HasErrors(diags) {
+		tb.Fatalf("type check: %v", diags)
+	}
+	return tree
+}
+
+// Program is a test program together with its input and the values it
+// writes
+type Program struct {
+	Name      string
+	Src       string
+	Input     string // Integers separated by white space
+	Want      string // Values written, separated by single spaces
+	DivByZero bool   // The program stops with a division by zero after writing Want
+}
+
+// Programs is run by every engine, which must write exactly Want
+var Programs = []Program{
+	{Name: "write", Src: "write 1; write 2 + 3 * 4; write (2 + 3) * 4", Want: "1 14 20"},
+	{Name: "read", Src: "read x; read y; write x - y", Input: "7\n-3", Want: "10"},
+	{Name: "uninitialized is zero", Src: "write x + 1", Want: "1"},
+	{Name: "division truncates", Src: "write 7 / 2; write 0 - 7 / 2; write (0 - 7) / 2", Want: "3 -3 -3"},
+	{Name: "left associative", Src: "write 10 - 4 - 3; write 64 / 4 / 2", Want: "3 8"},
+	{Name: "nested temporaries", Src: "write ((1 + 2) * (3 + 4)) - ((5 - 6) * (7 - 8))", Want: "20"},
+	{Name: "deep expression", Src: "write 1 + (2 + (3 + (4 + (5 + (6 + 7)))))", Want: "28"},
+	{Name: "if", Src: "read x; if x < 0 then write 0 - x else write x end", Input: "-5", Want: "5"},
+	{Name: "if without else", Src: "if 1 = 2 then write 1 end; write 2", Want: "2"},
+	{Name: "repeat runs once", Src: "repeat write x until 0 = 0", Want: "0"},
+	{Name: "factorial", Src: "read x; fact := 1; repeat fact := fact * x; x := x - 1 until x = 0; write fact",
+		Input: "20", Want: "2432902008176640000"},
+	{Name: "collatz", Src: "read n; repeat if n / 2 * 2 = n then n := n / 2 else n := 3 * n + 1 end; write n until n = 1",
+		Input: "6", Want: "3 10 5 16 8 4 2 1"},
+	{Name: "wraps around", Src: "read x; write x * x - 1; write 9223372036854775807 + 1", Input: "4294967296",
+		Want: "-1 -9223372036854775808"},
+	{Name: "most negative", Src: "x := 0 - 9223372036854775807 - 1; write x; write x / (0 - 1)",
+		Want: "-9223372036854775808 -9223372036854775808"},
+	{Name: "most negative compared", Src: "x := 0 - 9223372036854775807 - 1; y := 9223372036854775807;\n" +
+		"if x < 1 then write 1 end; if y < x then write 2 end; if x < y then write 3 end; if x = y then write 4 end",
+		Want: "1 3"},
+	{Name: "division by zero", Src: "write 1;\nx := 0;\nwrite 1 / x;\nwrite 2", Want: "1", DivByZero: true},
+	{Name: "unused division by zero", Src: "x := 0;\ny := 5 / x;\nwrite 2", DivByZero: true},
+	{Name: "identities", Src: "read x; write x + 0; write x * 1 - x; write 0 * x; write x / 1", Input: "-9", Want: "-9 0 0 -9"},
+	{Name: "propagation", Src: "x := 3; y := x; read z; write y * z + x", Input: "5", Want: "18"},
+	{Name: "constant branches", Src: "read x; if x < 0 then y := 0 - x else y := x end; if 1 < 2 then write y end; if 2 < 1 then write x end",
+		Input: "-4", Want: "4"},
+	{Name: "dead stores", Src: "x := 1; x := 2; y := x; read x; write x + y", Input: "10", Want: "12"},
+	{Name: "loop variables", Src: "i := 0; s := 0; repeat s := s + i * i; i := i + 1 until i = 5; write s; write i", Want: "30 5"},
+	{Name: "relational greater", Src: "read a; read b; if a > b then write 1 end; if a <= b then write 2 end; if a >= b then write 3 end; if a <> b then write 4 end",
+		Input: "2 1", Want: "1 3 4"},
+	{Name: "relational equal", Src: "read a; read b; if a > b then write 1 end; if a <= b then write 2 end; if a >= b then write 3 end; if a <> b then write 4 end",
+		Input: "1 1", Want: "2 3"},
+	{Name: "relational at the limits", Src: "x := 0 - 9223372036854775807 - 1; y := 9223372036854775807;\n" +
+		"if x > 1 then write 1 end; if 1 > x then write 2 end; if x <= 1 then write 3 end; if y <= x then write 4 end;\n" +
+		"if x >= y then write 5 end; if y >= x then write 6 end; if x <> y then write 7 end; if y > x then write 8 end",
+		Want: "2 3 6 7 8"},
+	{Name: "while", Src: "read n; while n > 0 do write n; n := n - 2 end; write n", Input: "5", Want: "5 3 1 -1"},
+	{Name: "while skipped", Src: "read n; while n > 0 do write n; n := n - 2 end; write n", Input: "-3", Want: "-3"},
+	{Name: "gcd", Src: "read a; read b; while b <> 0 do t := b; b := a - a / b * b; a := t end; write a", Input: "1071 462", Want: "21"},
+	{Name: "while never runs", Src: "x := 5; while x < 5 do x := x + 1 end; write x", Want: "5"},
+	{Name: "for", Src: "read n; s := 0; for i := 1 to n do s := s + i end; write s; for i := 3 downto 1 step 2 do write i end",
+		Input: "100", Want: "5050 3 1"},
+	{Name: "for step", Src: "for i := 1 to 10 step 4 do write i end; write i", Want: "1 5 9 13"},
+	{Name: "for downto step", Src: "for i := 10 downto 1 step 4 do write i end", Want: "10 6 2"},
+	{Name: "for downto", Src: "n := 3; for i := n downto 1 do n := n + 1; write i end; write n", Want: "3 2 1 6"},
+	{Name: "for downto changes", Src: "n := 3; s := 0; for i := n downto 1 step 2 do n := n + 1; s := s + i end; write s; write n; write i",
+		Want: "4 5 -1"},
+	{Name: "for no iterations", Src: "for i := 2 to 1 do write i end; write i", Want: "2"},
+	{Name: "for limit and step evaluated once", Src: "g := 1; for h := g to g + 2 step g do g := g + 1 end; write g", Want: "4"},
+	{Name: "for step evaluated once", Src: "s := 1; for i := 1 to 5 step s do s := s + 1; write i end", Want: "1 2 3 4 5"},
+	{Name: "for limit sees start", Src: "k := 0; for k := 3 to k + 1 do write k end; write k", Want: "3 4 5"},
+	{Name: "for at the limits", Src: "x := 0 - 9223372036854775807 - 1; for i := x to 1 step 4611686018427387904 do write i end",
+		Want: "-9223372036854775808 -4611686018427387904 0"},
+	{Name: "downto at the limits", Src: "y := 9223372036854775807; for i := y downto 0 - 1 step 4611686018427387904 do write i end",
+		Want: "9223372036854775807 4611686018427387903 -1"},
+	{Name: "short circuit", Src: "read x; if x <> 0 and 10 / x > 1 then write 1 else write 2 end; if x = 0 or 10 / x > 1 then write 3 end; if not (x > 1) then write 4 end",
+		Input: "0", Want: "2 3 4"},
+	{Name: "logical precedence", Src: "if 1 = 1 or 1 = 2 and 1 = 2 then write 1 end; if not 1 = 2 and 2 = 2 then write 2 end", Want: "1 2"},
+	{Name: "logical constants", Src: "read x; if 1 = 1 and x > 2 or not (2 < 1) and x = 0 then write x end", Input: "0", Want: "0"},
+	{Name: "division kept before a true or", Src: "read x; if 1 / x = 1 or 1 = 1 then write 1 end", Input: "0", DivByZero: true},
+	{Name: "unary operators", Src: "read x; write -x; write - -x; write +x; write -(x + 1) * 2; write -2 * -3; write 7 / -2",
+		Input: "5", Want: "-5 5 5 -12 6 -3"},
+	{Name: "negating the most negative", Src: "x := -9223372036854775807 - 1; write -x; write - -x",
+		Want: "-9223372036854775808 -9223372036854775808"},
+}
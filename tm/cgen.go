@@ -0,0 +1,319 @@
+package tm
+
+import (
+	"fmt"
+	"io"
+
+	"tinycompiler/tiny"
+)
+
+// Options control code generation
+type Options struct {
+	File     string // Source file name for the header comment
+	Comments bool   // Annotate the code with comments pointing back to source lines
+}
+
+// generator holds the state of a code generation run
+type generator struct {
+	emitter
+	table     *tiny.SymbolTable
+	tmpOffset int // Offset from mp of the next free temporary
+}
+
+// Generate writes TM assembly for the program rooted at tree. Variables are
+// stored at the locations given by table; if table is nil it is built from
+// the tree.
+func Generate(w io.Writer, tree *tiny.TreeNode, table *tiny.SymbolTable, opts Options) error {
+	if table == nil {
+		table, _ = tiny.BuildSymtab(tree)
+	}
+
+	g := &generator{
+		emitter: emitter{w: w, comments: opts.Comments},
+		table:   table,
+	}
+	g.emitComment("TINY Compilation to TM Code")
+	if opts.File != "" {
+		g.emitComment("File: " + opts.File)
+	}
+
+	// Generate standard prelude
+	g.emitComment("Standard prelude:")
+	g.emitRM("LD", mp, 0, ac, "load maxaddress from location 0")
+	g.emitRM("ST", ac, 0, ac, "clear location 0")
+	g.emitComment("End of standard prelude.")
+
+	// Generate code for TINY program
+	g.cGen(tree)
+
+	// Finish
+	g.emitComment("End of execution.")
+	g.emitRO("HALT", 0, 0, 0, "")
+	return g.err
+}
+
+// cGen generates code for a statement sequence or a single expression
+func (g *generator) cGen(node *tiny.TreeNode) {
+	for ; node != nil; node = node.Sibling {
+		switch node.NodeKind {
+		case tiny.StmtK:
+			g.genStmt(node)
+		case tiny.ExpK:
+			g.genExp(node)
+		default:
+			if g.err == nil {
+				g.err = fmt.Errorf("line %d: cannot generate code for a syntax error", node.LineNum)
+			}
+		}
+	}
+}
+
+func (g *generator) genStmt(node *tiny.TreeNode) {
+	switch node.StmtKind {
+	case tiny.IfK:
+		g.emitComment(fmt.Sprintf("-> if (line %d)", node.LineNum))
+		g.cGen(node.Children[0])
+		savedLoc1 := g.emitSkip(1)
+		g.emitComment("if: jump to else belongs here")
+		g.cGen(node.Children[1])
+		savedLoc2 := g.emitSkip(1)
+		g.emitComment("if: jump to end belongs here")
+		currentLoc := g.emitSkip(0)
+		g.emitBackup(savedLoc1)
+		g.emitRMAbs("JEQ", ac, currentLoc, "if: jmp to else")
+		g.emitRestore()
+		g.cGen(node.Children[2])
+		currentLoc = g.emitSkip(0)
+		g.emitBackup(savedLoc2)
+		g.emitRMAbs("LDA", pc, currentLoc, "jmp to end")
+		g.emitRestore()
+		g.emitComment("<- if")
+
+	case tiny.RepeatK:
+		g.emitComment(fmt.Sprintf("-> repeat (line %d)", node.LineNum))
+		savedLoc := g.emitSkip(0)
+		g.emitComment("repeat: jump after body comes back here")
+		g.cGen(node.Children[0])
+		g.cGen(node.Children[1])
+		g.emitRMAbs("JEQ", ac, savedLoc, "repeat: jmp back to body")
+		g.emitComment("<- repeat")
+
+	case tiny.WhileK:
+		g.emitComment(fmt.Sprintf("-> while (line %d)", node.LineNum))
+		top := g.emitSkip(0)
+		g.emitComment("while: jump after body comes back here")
+		g.cGen(node.Children[0])
+		savedLoc := g.emitSkip(1)
+		g.emitComment("while: jump to end belongs here")
+		g.cGen(node.Children[1])
+		g.emitRMAbs("LDA", pc, top, "while: jmp back to test")
+		currentLoc := g.emitSkip(0)
+		g.emitBackup(savedLoc)
+		g.emitRMAbs("JEQ", ac, currentLoc, "while: jmp to end")
+		g.emitRestore()
+		g.emitComment("<- while")
+
+	case tiny.ForK:
+		g.emitComment(fmt.Sprintf("-> for (line %d)", node.LineNum))
+		loc := g.location(node.Name)
+		exit, update, op := "JGT", "ADD", "op +"
+		if node.Op == "downto" {
+			exit, update, op = "JLT", "SUB", "op -"
+		}
+		g.cGen(node.Children[0])
+		g.emitRM("ST", ac, loc, gp, "for: store start")
+		// The limit and step are evaluated once and kept as temporaries
+		// until the loop ends
+		limit := g.tmpOffset
+		g.cGen(node.Children[1])
+		g.emitRM("ST", ac, limit, mp, "for: push limit")
+		g.tmpOffset--
+		step := g.tmpOffset
+		if node.Children[2] != nil {
+			g.cGen(node.Children[2])
+			g.emitRM("ST", ac, step, mp, "for: push step")
+			g.tmpOffset--
+		}
+		top := g.emitSkip(0)
+		g.emitComment("for: jump after body comes back here")
+		g.emitRM("LD", ac1, loc, gp, "for: load variable")
+		g.emitRM("LD", ac, limit, mp, "for: load limit")
+		g.genOrder("for: compare with limit")
+		savedLoc := g.emitSkip(1)
+		g.emitComment("for: jump to end belongs here")
+		g.cGen(node.Children[3])
+		if node.Children[2] != nil {
+			g.emitRM("LD", ac, step, mp, "for: load step")
+		} else {
+			g.emitRM("LDC", ac, 1, 0, "for: default step")
+		}
+		g.emitRM("LD", ac1, loc, gp, "for: load variable")
+		g.emitRO(update, ac, ac1, ac, op)
+		g.emitRM("ST", ac, loc, gp, "for: store variable")
+		g.emitRMAbs("LDA", pc, top, "for: jmp back to test")
+		currentLoc := g.emitSkip(0)
+		g.emitBackup(savedLoc)
+		g.emitRMAbs(exit, ac, currentLoc, "for: jmp to end")
+		g.emitRestore()
+		g.tmpOffset = limit
+		g.emitComment("<- for")
+
+	case tiny.AssignK:
+		g.emitComment(fmt.Sprintf("-> assign (line %d)", node.LineNum))
+		g.cGen(node.Children[0])
+		g.emitRM("ST", ac, g.location(node.Name), gp, "assign: store value")
+		g.emitComment("<- assign")
+
+	case tiny.ReadK:
+		g.emitComment(fmt.Sprintf("-> read (line %d)", node.LineNum))
+		g.emitRO("IN", ac, 0, 0, "read integer value")
+		g.emitRM("ST", ac, g.location(node.Name), gp, "read: store value")
+		g.emitComment("<- read")
+
+	case tiny.WriteK:
+		g.emitComment(fmt.Sprintf("-> write (line %d)", node.LineNum))
+		g.cGen(node.Children[0])
+		g.emitRO("OUT", ac, 0, 0, "write ac")
+		g.emitComment("<- write")
+	}
+}
+
+func (g *generator) genExp(node *tiny.TreeNode) {
+	switch node.ExpKind {
+	case tiny.ConstK:
+		g.emitComment("-> Const")
+		g.emitRM("LDC", ac, node.Value, 0, "load const")
+		g.emitComment("<- Const")
+
+	case tiny.IdK:
+		g.emitComment("-> Id")
+		g.emitRM("LD", ac, g.location(node.Name), gp, "load id value")
+		g.emitComment("<- Id")
+
+	case tiny.UnaryK:
+		g.emitComment("-> Unary")
+		g.cGen(node.Children[0])
+		switch node.Op {
+		case "not":
+			g.emitRM("JEQ", ac, 2, pc, "not: br if false")
+			g.emitRM("LDC", ac, 0, ac, "true case")
+			g.emitRM("LDA", pc, 1, pc, "unconditional jmp")
+			g.emitRM("LDC", ac, 1, ac, "false case")
+		case "-":
+			g.emitRM("LDC", ac1, 0, 0, "unary -: load 0")
+			g.emitRO("SUB", ac, ac1, ac, "unary -")
+		case "+":
+		default:
+			g.emitComment("BUG: Unknown operator")
+		}
+		g.emitComment("<- Unary")
+
+	case tiny.OpK:
+		if node.Op == "and" || node.Op == "or" {
+			g.genLogical(node)
+			return
+		}
+		g.emitComment("-> Op")
+		// Gen code for ac = left arg, pushed on the temporary stack
+		g.cGen(node.Children[0])
+		g.emitRM("ST", ac, g.tmpOffset, mp, "op: push left")
+		g.tmpOffset--
+		// Gen code for ac = right operand
+		g.cGen(node.Children[1])
+		// Now load left operand
+		g.tmpOffset++
+		g.emitRM("LD", ac1, g.tmpOffset, mp, "op: load left")
+
+		switch node.Op {
+		case "+":
+			g.emitRO("ADD", ac, ac1, ac, "op +")
+		case "-":
+			g.emitRO("SUB", ac, ac1, ac, "op -")
+		case "*":
+			g.emitRO("MUL", ac, ac1, ac, "op *")
+		case "/":
+			g.emitRO("DIV", ac, ac1, ac, "op /")
+		case "<":
+			g.genCompare("JLT", "op <")
+		case ">":
+			g.genCompare("JGT", "op >")
+		case "<=":
+			g.genCompare("JLE", "op <=")
+		case ">=":
+			g.genCompare("JGE", "op >=")
+		case "=":
+			g.genCompare("JEQ", "op ==")
+		case "<>":
+			g.genCompare("JNE", "op !=")
+		default:
+			g.emitComment("BUG: Unknown operator")
+		}
+		g.emitComment("<- Op")
+	}
+}
+
+// genLogical leaves 1 in ac if the and or or at node holds, else 0. The
+// right operand is skipped when the left one decides the result.
+func (g *generator) genLogical(node *tiny.TreeNode) {
+	g.emitComment("-> " + node.Op)
+	g.cGen(node.Children[0])
+	savedLoc1 := g.emitSkip(1)
+	g.emitComment(node.Op + ": jump past right operand belongs here")
+	g.cGen(node.Children[1])
+	savedLoc2 := g.emitSkip(1)
+	g.emitComment(node.Op + ": jump to end if false belongs here")
+	trueLoc := g.emitSkip(0)
+	g.emitRM("LDC", ac, 1, 0, "true case")
+	endLoc := g.emitSkip(0)
+	g.emitBackup(savedLoc1)
+	if node.Op == "and" {
+		g.emitRMAbs("JEQ", ac, endLoc, "and: jmp to end if left is false")
+	} else {
+		g.emitRMAbs("JNE", ac, trueLoc, "or: jmp to true case if left is true")
+	}
+	g.emitBackup(savedLoc2)
+	g.emitRMAbs("JEQ", ac, endLoc, node.Op+": jmp to end if right is false")
+	g.emitRestore()
+	g.emitComment("<- " + node.Op)
+}
+
+// genCompare leaves 1 in ac if ac1 - ac satisfies the jump jmp, else 0.
+// A wrapped difference is still zero exactly when the operands are equal,
+// so only the ordering tests need genOrder.
+func (g *generator) genCompare(jmp, c string) {
+	if jmp == "JEQ" || jmp == "JNE" {
+		g.emitRO("SUB", ac, ac1, ac, c)
+	} else {
+		g.genOrder(c)
+	}
+	g.emitRM(jmp, ac, 2, pc, "br if true")
+	g.emitRM("LDC", ac, 0, ac, "false case")
+	g.emitRM("LDA", pc, 1, pc, "unconditional jmp")
+	g.emitRM("LDC", ac, 1, ac, "true case")
+}
+
+// genOrder leaves in ac a value with the sign of ac1 - ac. The difference
+// can overflow when the operands have opposite signs, so it is only
+// computed when they have the same sign; otherwise the sign of the left
+// operand decides.
+func (g *generator) genOrder(c string) {
+	g.emitRM("JLT", ac1, 3, pc, c+": br if left < 0")
+	g.emitRM("JGE", ac, 5, pc, "br to subtract if right >= 0")
+	g.emitRM("LDC", ac, 1, 0, "left >= 0 > right")
+	g.emitRM("LDA", pc, 4, pc, "unconditional jmp")
+	g.emitRM("JLT", ac, 2, pc, "br to subtract if right < 0")
+	g.emitRM("LDC", ac, -1, 0, "left < 0 <= right")
+	g.emitRM("LDA", pc, 1, pc, "unconditional jmp")
+	g.emitRO("SUB", ac, ac1, ac, c)
+}
+
+// location returns the memory location of a variable
+func (g *generator) location(name string) int {
+	if sym := g.table.Lookup(name); sym != nil {
+		return sym.Location
+	}
+	if g.err == nil {
+		g.err = fmt.Errorf("variable %s is not in the symbol table", name)
+	}
+	return 0
+}
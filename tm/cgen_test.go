@@ -0,0 +1,156 @@
+package tm
+
+import (
+	"bytes"
+	"fmt"
+	"math"
+	"strings"
+	"testing"
+
+	"tinycompiler/tiny/tinytest"
+)
+
+// generate compiles src to TM assembly, failing the test on any error
+func generate(t *testing.T, src string, opts Options) string {
+	t.Helper()
+	var b strings.Builder
+	if err := Generate(&b, tinytest.Parse(t, src), nil, opts); err != nil {
+		t.Fatal(err)
+	}
+	return b.String()
+}
+
+// execute loads code into a new machine and runs it with the given input,
+// returning what it wrote and how it stopped
+func execute(t *testing.T, code, input string) (string, StepResult) {
+	t.Helper()
+	var out bytes.Buffer
+	m := NewMachine(strings.NewReader(input), &out)
+	if err := m.Load(strings.NewReader(code)); err != nil {
+		t.Fatalf("load: %v\n%s", err, code)
+	}
+	result := m.Run()
+	return strings.Join(strings.Fields(out.String()), " "), result
+}
+
+// TestGenerateCompare checks that < tests the signs of its operands before
+// subtracting them, since the difference can overflow, while = subtracts
+// straight away
+func TestGenerateCompare(t *testing.T) {
+	tests := []struct {
+		op   string
+		want []string // Operations from loading the left operand to the branch
+	}{
+		{"<", []string{"LD", "JLT", "JGE", "LDC", "LDA", "JLT", "LDC", "LDA", "SUB", "JLT"}},
+		{"=", []string{"LD", "SUB", "JEQ"}},
+	}
+	for _, tt := range tests {
+		code := generate(t, "read x; read y; if x "+tt.op+" y then write 1 end", Options{})
+		var ops []string
+		for _, line := range strings.Split(code, "\n") {
+			f := strings.Fields(line)
+			if len(f) > 2 && (ops != nil || f[1] == "LD" && f[2] == "1,0(6)") && len(ops) < len(tt.want) {
+				ops = append(ops, f[1])
+			}
+		}
+		if strings.Join(ops, " ") != strings.Join(tt.want, " ") {
+			t.Errorf("x %s y compiles to %v, want %v\n%s", tt.op, ops, tt.want, code)
+		}
+	}
+}
+
+// TestGenerateCompareLimits checks the comparisons and the for loop exit
+// at the ends of the integer range, where the difference of the operands
+// overflows
+func TestGenerateCompareLimits(t *testing.T) {
+	values := []struct {
+		exp string
+		v   int64
+	}{
+		{"0 - 9223372036854775807 - 1", math.MinInt64},
+		{"0 - 1", -1},
+		{"0", 0},
+		{"1", 1},
+		{"9223372036854775807", math.MaxInt64},
+	}
+	ops := []struct {
+		op  string
+		cmp func(a, b int64) bool
+	}{
+		{"<", func(a, b int64) bool { return a < b }},
+		{"=", func(a, b int64) bool { return a == b }},
+		{">", func(a, b int64) bool { return a > b }},
+		{"<=", func(a, b int64) bool { return a <= b }},
+		{">=", func(a, b int64) bool { return a >= b }},
+		{"<>", func(a, b int64) bool { return a != b }},
+	}
+	for _, op := range ops {
+		for _, a := range values {
+			for _, b := range values {
+				src := fmt.Sprintf("x := %s; y := %s; if x %s y then write 1 else write 0 end", a.exp, b.exp, op.op)
+				want := "0"
+				if op.cmp(a.v, b.v) {
+					want = "1"
+				}
+				if got, result := execute(t, generate(t, src, Options{}), ""); result != Halted || got != want {
+					t.Errorf("%d %s %d: wrote %q and stopped with %v, want %q", a.v, op.op, b.v, got, result, want)
+				}
+			}
+		}
+	}
+
+	loops := []struct {
+		src  string
+		want string
+	}{
+		{"x := 0 - 9223372036854775807 - 1; for i := x to 1 step 4611686018427387904 do write i end",
+			"-9223372036854775808 -4611686018427387904 0"},
+		{"y := 9223372036854775807; for i := y downto 0 - 1 step 4611686018427387904 do write i end",
+			"9223372036854775807 4611686018427387903 -1"},
+	}
+	for _, tt := range loops {
+		if got, result := execute(t, generate(t, tt.src, Options{}), ""); result != Halted || got != tt.want {
+			t.Errorf("%q: wrote %q and stopped with %v, want %q", tt.src, got, result, tt.want)
+		}
+	}
+}
+
+// TestGenerateDivideByZero checks that the simulator stops on a division
+// by zero after the output that came before it
+func TestGenerateDivideByZero(t *testing.T) {
+	code := generate(t, "read x; write 1; write 1 / x; write 2", Options{})
+	got, result := execute(t, code, "0")
+	if result != ZeroDivide || got != "1" {
+		t.Errorf("wrote %q and stopped with %v, want %q and %v", got, result, "1", ZeroDivide)
+	}
+}
+
+// TestGenerateComments checks the header and the annotations that Comments
+// adds, which must not change the code
+func TestGenerateComments(t *testing.T) {
+	src := "read x;\nwrite x"
+	plain := generate(t, src, Options{})
+	annotated := generate(t, src, Options{File: "prog.tny", Comments: true})
+
+	if strings.Contains(plain, "*") {
+		t.Errorf("comments without Comments:\n%s", plain)
+	}
+	if !strings.HasPrefix(annotated, "* TINY Compilation to TM Code\n* File: prog.tny\n") {
+		t.Errorf("missing header:\n%s", annotated)
+	}
+	if !strings.Contains(annotated, "* -> read (line 1)\n") || !strings.Contains(annotated, "* -> write (line 2)\n") {
+		t.Errorf("missing line annotations:\n%s", annotated)
+	}
+	instructions := func(code string) []string {
+		var lines []string
+		for _, line := range strings.Split(code, "\n") {
+			if line = strings.TrimSpace(line); line != "" && line[0] != '*' {
+				lines = append(lines, strings.Join(strings.Fields(line)[:3], " "))
+			}
+		}
+		return lines
+	}
+	if a, b := instructions(plain), instructions(annotated); strings.Join(a, "\n") != strings.Join(b, "\n") {
+		t.Errorf("instructions differ:\n%v\n%v", a, b)
+	}
+}
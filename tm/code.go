@@ -0,0 +1,95 @@
+// Package tm generates code for the TM (Tiny Machine) of the TINY textbook
+// compiler.
+package tm
+
+import (
+	"fmt"
+	"io"
+)
+
+// Register numbers
+const (
+	ac  = 0 // Accumulator
+	ac1 = 1 // Second accumulator
+	gp  = 5 // Global pointer: base of the variables, i.e. location 0
+	mp  = 6 // Memory pointer: top of memory, used for temporaries
+	pc  = 7 // Program counter
+)
+
+// emitter writes TM assembly, keeping track of the next instruction
+// location so that jumps can be backpatched
+type emitter struct {
+	w        io.Writer
+	comments bool // Emit comments describing each instruction
+	emitLoc  int  // Location of the next instruction
+	highLoc  int  // Highest location emitted so far
+	err      error
+}
+
+func (e *emitter) printf(format string, args ...any) {
+	if e.err != nil {
+		return
+	}
+	_, e.err = fmt.Fprintf(e.w, format, args...)
+}
+
+// emitComment prints a comment line if comments are enabled
+func (e *emitter) emitComment(c string) {
+	if e.comments {
+		e.printf("* %s\n", c)
+	}
+}
+
+// emitRO emits a register-only instruction: op r,s,t
+func (e *emitter) emitRO(op string, r, s, t int, c string) {
+	e.printf("%3d:  %5s  %d,%d,%d ", e.emitLoc, op, r, s, t)
+	e.emitTrailer(c)
+}
+
+// emitRM emits a register-memory instruction: op r,d(s)
+func (e *emitter) emitRM(op string, r, d, s int, c string) {
+	e.printf("%3d:  %5s  %d,%d(%d) ", e.emitLoc, op, r, d, s)
+	e.emitTrailer(c)
+}
+
+// emitRMAbs emits a register-memory instruction whose target is the
+// absolute location a, converted to an offset from the pc
+func (e *emitter) emitRMAbs(op string, r, a int, c string) {
+	e.printf("%3d:  %5s  %d,%d(%d) ", e.emitLoc, op, r, a-(e.emitLoc+1), pc)
+	e.emitTrailer(c)
+}
+
+func (e *emitter) emitTrailer(c string) {
+	if e.comments {
+		e.printf("\t%s", c)
+	}
+	e.printf("\n")
+	e.emitLoc++
+	if e.highLoc < e.emitLoc {
+		e.highLoc = e.emitLoc
+	}
+}
+
+// emitSkip skips howMany locations for later backpatching and returns the
+// current location
+func (e *emitter) emitSkip(howMany int) int {
+	i := e.emitLoc
+	e.emitLoc += howMany
+	if e.highLoc < e.emitLoc {
+		e.highLoc = e.emitLoc
+	}
+	return i
+}
+
+// emitBackup moves back to a previously skipped location
+func (e *emitter) emitBackup(loc int) {
+	if loc > e.highLoc {
+		e.emitComment("BUG in emitBackup")
+	}
+	e.emitLoc = loc
+}
+
+// emitRestore returns to the highest location emitted so far
+func (e *emitter) emitRestore() {
+	e.emitLoc = e.highLoc
+}
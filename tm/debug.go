@@ -0,0 +1,142 @@
+package tm
+
+import (
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+)
+
+const debugHelp = `Commands are:
+  s(tep <n>      Execute n (default 1) TM instructions
+  g(o            Execute TM instructions until HALT or a breakpoint
+  r(egs          Print the contents of the registers
+  i(Mem <b <n>>  Print n iMem locations starting at b
+  d(Mem <b <n>>  Print n dMem locations starting at b
+  b(reak <a>     Toggle a breakpoint on instruction address a
+  t(race         Toggle instruction trace
+  c(lear         Reset simulator for new execution of program
+  h(elp          Cause this list of commands to be printed
+  q(uit          Terminate the simulation
+`
+
+// Debug runs an interactive session in the style of the textbook TM
+// simulator. Commands are read from the machine's input, so they share one
+// stream with the program's IN instructions; messages are written to w.
+func (m *Machine) Debug(w io.Writer) error {
+	result := OK
+	iloc, dloc := 0, 0
+
+	for {
+		fmt.Fprint(w, "Enter command: ")
+		line, err := m.in.ReadString('\n')
+		if err != nil && line == "" {
+			if err == io.EOF {
+				fmt.Fprintln(w)
+				return nil
+			}
+			return err
+		}
+
+		fields := strings.Fields(line)
+		if len(fields) == 0 {
+			continue
+		}
+		args := make([]int, 0, 2)
+		for _, f := range fields[1:] {
+			n, err := strconv.Atoi(f)
+			if err != nil {
+				fmt.Fprintf(w, "Bad number %q\n", f)
+				args = nil
+				break
+			}
+			args = append(args, n)
+		}
+		if args == nil {
+			continue
+		}
+		arg := func(i, def int) int {
+			if i < len(args) {
+				return args[i]
+			}
+			return def
+		}
+
+		switch fields[0][0] {
+		case 's':
+			if result != OK && result != Break {
+				fmt.Fprintf(w, "Simulation stopped: %v\n", result)
+				continue
+			}
+			result = OK
+			for n := arg(0, 1); n > 0 && result == OK; n-- {
+				pc := m.Reg[PCReg]
+				if !m.Trace && pc >= 0 && pc < IAddrSize {
+					fmt.Fprintf(w, "%5d: %s\n", pc, m.IMem[pc])
+				}
+				result = m.Step()
+			}
+			if result != OK {
+				fmt.Fprintf(w, "%v\n", result)
+			}
+
+		case 'g':
+			if result != OK && result != Break {
+				fmt.Fprintf(w, "Simulation stopped: %v\n", result)
+				continue
+			}
+			result = m.Run()
+			if result == Break {
+				fmt.Fprintf(w, "Breakpoint at %d\n", m.Reg[PCReg])
+			} else {
+				fmt.Fprintf(w, "%v\n", result)
+			}
+			fmt.Fprintf(w, "Number of instructions executed = %d\n", m.Steps)
+
+		case 'r':
+			m.DumpRegs(w)
+
+		case 'i':
+			iloc = arg(0, iloc)
+			m.DumpIMem(w, iloc, arg(1, 1))
+
+		case 'd':
+			dloc = arg(0, dloc)
+			m.DumpDMem(w, dloc, arg(1, 1))
+
+		case 'b':
+			if len(args) == 0 {
+				fmt.Fprintln(w, "Breakpoint needs an address")
+				continue
+			}
+			on := !m.Breakpoint(args[0])
+			m.SetBreakpoint(args[0], on)
+			if on {
+				fmt.Fprintf(w, "Breakpoint set at %d\n", args[0])
+			} else {
+				fmt.Fprintf(w, "Breakpoint cleared at %d\n", args[0])
+			}
+
+		case 't':
+			m.Trace = !m.Trace
+			if m.Trace {
+				fmt.Fprintln(w, "Tracing now on.")
+			} else {
+				fmt.Fprintln(w, "Tracing now off.")
+			}
+
+		case 'c':
+			m.Reset()
+			result = OK
+
+		case 'h':
+			fmt.Fprint(w, debugHelp)
+
+		case 'q':
+			return nil
+
+		default:
+			fmt.Fprintf(w, "Command %s unknown.\n", fields[0])
+		}
+	}
+}
@@ -0,0 +1,152 @@
+package tm
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+)
+
+// Load reads TM assembly into instruction memory, replacing the previous
+// program, and resets the machine. Each instruction line has the form
+// "loc: op r,s,t" or "loc: op r,d(s)"; anything after the operands is a
+// comment, as are lines starting with '*'.
+func (m *Machine) Load(r io.Reader) error {
+	for i := range m.IMem {
+		m.IMem[i] = Instruction{Op: HALT}
+	}
+	m.Reset()
+
+	sc := bufio.NewScanner(r)
+	for lineNo := 1; sc.Scan(); lineNo++ {
+		line := strings.TrimSpace(sc.Text())
+		if line == "" || line[0] == '*' {
+			continue
+		}
+
+		loc, in, err := parseInstruction(line)
+		if err != nil {
+			return fmt.Errorf("line %d: %v", lineNo, err)
+		}
+		if loc < 0 || loc >= IAddrSize {
+			return fmt.Errorf("line %d: location %d out of range", lineNo, loc)
+		}
+		m.IMem[loc] = in
+	}
+	return sc.Err()
+}
+
+// parseInstruction decodes a single instruction line
+func parseInstruction(line string) (int, Instruction, error) {
+	var in Instruction
+	p := &lineParser{s: line}
+
+	loc, err := p.number()
+	if err != nil {
+		return 0, in, fmt.Errorf("missing location: %v", err)
+	}
+	if !p.skip(':') {
+		return 0, in, fmt.Errorf("missing ':' after location")
+	}
+
+	name := p.word()
+	op, ok := lookupOpcode(name)
+	if !ok {
+		return 0, in, fmt.Errorf("illegal opcode %q", name)
+	}
+	in.Op = op
+
+	if in.Arg1, err = p.register(); err != nil {
+		return 0, in, err
+	}
+	if !p.skip(',') {
+		return 0, in, fmt.Errorf("missing ',' after first operand")
+	}
+
+	if op.Class() == OpClassRR {
+		if in.Arg2, err = p.register(); err != nil {
+			return 0, in, err
+		}
+		if !p.skip(',') {
+			return 0, in, fmt.Errorf("missing ',' after second operand")
+		}
+		if in.Arg3, err = p.register(); err != nil {
+			return 0, in, err
+		}
+		return loc, in, nil
+	}
+
+	if in.Arg2, err = p.number(); err != nil {
+		return 0, in, fmt.Errorf("bad displacement: %v", err)
+	}
+	if !p.skip('(') {
+		return 0, in, fmt.Errorf("missing '(' after displacement")
+	}
+	if in.Arg3, err = p.register(); err != nil {
+		return 0, in, err
+	}
+	if !p.skip(')') {
+		return 0, in, fmt.Errorf("missing ')' after base register")
+	}
+	return loc, in, nil
+}
+
+func lookupOpcode(name string) (Opcode, bool) {
+	for op, opName := range opcodeNames {
+		if opName == name {
+			return Opcode(op), true
+		}
+	}
+	return 0, false
+}
+
+// lineParser reads the fields of an instruction line, skipping blanks
+type lineParser struct {
+	s   string
+	pos int
+}
+
+func (p *lineParser) skipBlanks() {
+	for p.pos < len(p.s) && (p.s[p.pos] == ' ' || p.s[p.pos] == '\t') {
+		p.pos++
+	}
+}
+
+func (p *lineParser) skip(c byte) bool {
+	p.skipBlanks()
+	if p.pos < len(p.s) && p.s[p.pos] == c {
+		p.pos++
+		return true
+	}
+	return false
+}
+
+func (p *lineParser) word() string {
+	p.skipBlanks()
+	start := p.pos
+	for p.pos < len(p.s) && ((p.s[p.pos] >= 'A' && p.s[p.pos] <= 'Z') || (p.s[p.pos] >= 'a' && p.s[p.pos] <= 'z')) {
+		p.pos++
+	}
+	return strings.ToUpper(p.s[start:p.pos])
+}
+
+func (p *lineParser) number() (int, error) {
+	p.skipBlanks()
+	start := p.pos
+	if p.pos < len(p.s) && (p.s[p.pos] == '-' || p.s[p.pos] == '+') {
+		p.pos++
+	}
+	for p.pos < len(p.s) && p.s[p.pos] >= '0' && p.s[p.pos] <= '9' {
+		p.pos++
+	}
+	return strconv.Atoi(p.s[start:p.pos])
+}
+
+func (p *lineParser) register() (int, error) {
+	r, err := p.number()
+	if err != nil || r < 0 || r >= NoRegs {
+		return 0, fmt.Errorf("bad register %q", p.s[:p.pos])
+	}
+	return r, nil
+}
@@ -0,0 +1,294 @@
+package tm
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+)
+
+// Machine sizes
+const (
+	IAddrSize = 1024 // Instruction memory size
+	DAddrSize = 1024 // Data memory size
+	NoRegs    = 8    // Number of registers
+	PCReg     = 7    // Register used as the program counter
+)
+
+// OpClass tells how the operands of an instruction are written
+type OpClass int
+
+const (
+	OpClassRR OpClass = iota // Register only: op r,s,t
+	OpClassRM                // Register to memory: op r,d(s) with address d+reg[s]
+	OpClassRA                // Register to address: op r,d(s) using d+reg[s] itself
+)
+
+// Opcode is a TM instruction
+type Opcode int
+
+const (
+	// RR instructions
+	HALT Opcode = iota // Stop execution, operands ignored
+	IN                 // reg[r] <- integer read from the input
+	OUT                // reg[r] -> output
+	ADD                // reg[r] = reg[s] + reg[t]
+	SUB                // reg[r] = reg[s] - reg[t]
+	MUL                // reg[r] = reg[s] * reg[t]
+	DIV                // reg[r] = reg[s] / reg[t]
+
+	// RM instructions
+	LD // reg[r] = dMem[d+reg[s]]
+	ST // dMem[d+reg[s]] = reg[r]
+
+	// RA instructions
+	LDA // reg[r] = d+reg[s]
+	LDC // reg[r] = d
+	JLT // if reg[r] < 0 then reg[7] = d+reg[s]
+	JLE // if reg[r] <= 0 then reg[7] = d+reg[s]
+	JGT // if reg[r] > 0 then reg[7] = d+reg[s]
+	JGE // if reg[r] >= 0 then reg[7] = d+reg[s]
+	JEQ // if reg[r] == 0 then reg[7] = d+reg[s]
+	JNE // if reg[r] != 0 then reg[7] = d+reg[s]
+)
+
+var opcodeNames = [...]string{
+	"HALT", "IN", "OUT", "ADD", "SUB", "MUL", "DIV",
+	"LD", "ST",
+	"LDA", "LDC", "JLT", "JLE", "JGT", "JGE", "JEQ", "JNE",
+}
+
+func (op Opcode) String() string {
+	return opcodeNames[op]
+}
+
+// Class returns the operand class of the opcode
+func (op Opcode) Class() OpClass {
+	switch {
+	case op <= DIV:
+		return OpClassRR
+	case op <= ST:
+		return OpClassRM
+	default:
+		return OpClassRA
+	}
+}
+
+// Instruction is a decoded TM instruction. For RR instructions the
+// arguments are r, s and t; for RM and RA instructions they are r, d and s.
+type Instruction struct {
+	Op   Opcode
+	Arg1 int
+	Arg2 int
+	Arg3 int
+}
+
+func (in Instruction) String() string {
+	if in.Op.Class() == OpClassRR {
+		return fmt.Sprintf("%6s%3d,%3d,%3d", in.Op, in.Arg1, in.Arg2, in.Arg3)
+	}
+	return fmt.Sprintf("%6s%3d,%3d(%d)", in.Op, in.Arg1, in.Arg2, in.Arg3)
+}
+
+// StepResult is the outcome of executing instructions
+type StepResult int
+
+const (
+	OK         StepResult = iota // The instruction executed normally
+	Halted                       // A HALT instruction was executed
+	IMemErr                      // The pc left instruction memory
+	DMemErr                      // A load or store left data memory
+	ZeroDivide                   // DIV by zero
+	InputErr                     // IN could not read an integer
+	Break                        // Execution stopped at a breakpoint
+)
+
+func (r StepResult) String() string {
+	return [...]string{
+		"OK",
+		"Halted",
+		"Instruction Memory Fault",
+		"Data Memory Fault",
+		"Division by 0",
+		"Bad input",
+		"Breakpoint",
+	}[r]
+}
+
+// Machine simulates the Tiny Machine. Program input and output go through
+// the reader and writer given to NewMachine, like the interpreter's.
+type Machine struct {
+	IMem [IAddrSize]Instruction
+	DMem [DAddrSize]int
+	Reg  [NoRegs]int
+
+	Trace    bool      // Print each instruction before it executes
+	TraceOut io.Writer // Destination of the trace, the output if nil
+	Steps    int       // Instructions executed since the last Reset
+
+	in          *bufio.Reader
+	out         io.Writer
+	breakpoints map[int]bool
+}
+
+// NewMachine creates a machine that reads from in and writes to out. Its
+// instruction memory is filled with HALT instructions.
+func NewMachine(in io.Reader, out io.Writer) *Machine {
+	m := &Machine{
+		in:          bufio.NewReader(in),
+		out:         out,
+		breakpoints: make(map[int]bool),
+	}
+	m.Reset()
+	return m
+}
+
+// Reset clears registers and data memory for a new run of the loaded
+// program. Location 0 of data memory holds the highest legal address.
+func (m *Machine) Reset() {
+	m.Reg = [NoRegs]int{}
+	m.DMem = [DAddrSize]int{}
+	m.DMem[0] = DAddrSize - 1
+	m.Steps = 0
+}
+
+// SetBreakpoint sets or clears a breakpoint on an instruction address
+func (m *Machine) SetBreakpoint(addr int, on bool) {
+	if on {
+		m.breakpoints[addr] = true
+	} else {
+		delete(m.breakpoints, addr)
+	}
+}
+
+// Breakpoint reports whether addr has a breakpoint
+func (m *Machine) Breakpoint(addr int) bool {
+	return m.breakpoints[addr]
+}
+
+// Step executes a single instruction
+func (m *Machine) Step() StepResult {
+	pc := m.Reg[PCReg]
+	if pc < 0 || pc >= IAddrSize {
+		return IMemErr
+	}
+	m.Reg[PCReg] = pc + 1
+	in := m.IMem[pc]
+	if m.Trace {
+		fmt.Fprintf(m.traceOut(), "%5d: %s\n", pc, in)
+	}
+	m.Steps++
+
+	r := in.Arg1
+	switch in.Op.Class() {
+	case OpClassRR:
+		s, t := in.Arg2, in.Arg3
+		switch in.Op {
+		case HALT:
+			return Halted
+		case IN:
+			var value int
+			if _, err := fmt.Fscan(m.in, &value); err != nil {
+				return InputErr
+			}
+			m.Reg[r] = value
+		case OUT:
+			fmt.Fprintln(m.out, m.Reg[r])
+		case ADD:
+			m.Reg[r] = m.Reg[s] + m.Reg[t]
+		case SUB:
+			m.Reg[r] = m.Reg[s] - m.Reg[t]
+		case MUL:
+			m.Reg[r] = m.Reg[s] * m.Reg[t]
+		case DIV:
+			if m.Reg[t] == 0 {
+				return ZeroDivide
+			}
+			m.Reg[r] = m.Reg[s] / m.Reg[t]
+		}
+
+	case OpClassRM:
+		addr := in.Arg2 + m.Reg[in.Arg3]
+		if addr < 0 || addr >= DAddrSize {
+			return DMemErr
+		}
+		switch in.Op {
+		case LD:
+			m.Reg[r] = m.DMem[addr]
+		case ST:
+			m.DMem[addr] = m.Reg[r]
+		}
+
+	case OpClassRA:
+		addr := in.Arg2 + m.Reg[in.Arg3]
+		switch in.Op {
+		case LDA:
+			m.Reg[r] = addr
+		case LDC:
+			m.Reg[r] = in.Arg2
+		case JLT:
+			m.jumpIf(m.Reg[r] < 0, addr)
+		case JLE:
+			m.jumpIf(m.Reg[r] <= 0, addr)
+		case JGT:
+			m.jumpIf(m.Reg[r] > 0, addr)
+		case JGE:
+			m.jumpIf(m.Reg[r] >= 0, addr)
+		case JEQ:
+			m.jumpIf(m.Reg[r] == 0, addr)
+		case JNE:
+			m.jumpIf(m.Reg[r] != 0, addr)
+		}
+	}
+	return OK
+}
+
+func (m *Machine) jumpIf(cond bool, addr int) {
+	if cond {
+		m.Reg[PCReg] = addr
+	}
+}
+
+func (m *Machine) traceOut() io.Writer {
+	if m.TraceOut != nil {
+		return m.TraceOut
+	}
+	return m.out
+}
+
+// Run executes instructions until the program halts, fails or reaches a
+// breakpoint. A breakpoint on the first instruction is ignored, so calling
+// Run again continues past the breakpoint it stopped at.
+func (m *Machine) Run() StepResult {
+	for first := true; ; first = false {
+		if !first && m.breakpoints[m.Reg[PCReg]] {
+			return Break
+		}
+		if result := m.Step(); result != OK {
+			return result
+		}
+	}
+}
+
+// DumpRegs prints the contents of the registers
+func (m *Machine) DumpRegs(w io.Writer) {
+	for i := 0; i < NoRegs; i++ {
+		fmt.Fprintf(w, "r[%1d] = %-4d ", i, m.Reg[i])
+		if i%4 == 3 {
+			fmt.Fprintln(w)
+		}
+	}
+}
+
+// DumpIMem prints n instruction memory locations starting at start
+func (m *Machine) DumpIMem(w io.Writer, start, n int) {
+	for addr := max(start, 0); addr < start+n && addr < IAddrSize; addr++ {
+		fmt.Fprintf(w, "%5d: %s\n", addr, m.IMem[addr])
+	}
+}
+
+// DumpDMem prints n data memory locations starting at start
+func (m *Machine) DumpDMem(w io.Writer, start, n int) {
+	for addr := max(start, 0); addr < start+n && addr < DAddrSize; addr++ {
+		fmt.Fprintf(w, "%5d: %5d\n", addr, m.DMem[addr])
+	}
+}
@@ -0,0 +1,184 @@
+package tm
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+)
+
+// TestLoad checks instruction decoding and the errors of malformed lines
+func TestLoad(t *testing.T) {
+	m := NewMachine(strings.NewReader(""), &bytes.Buffer{})
+	code := "* a comment\n" +
+		"  0:  LDC  0,-3(0)  load\n" +
+		"\n" +
+		"  1:  ADD 1,0,0\n" +
+		"  5:  ST 1,2(6)\n"
+	if err := m.Load(strings.NewReader(code)); err != nil {
+		t.Fatal(err)
+	}
+	want := []Instruction{
+		{LDC, 0, -3, 0},
+		{ADD, 1, 0, 0},
+		{HALT, 0, 0, 0},
+		{HALT, 0, 0, 0},
+		{HALT, 0, 0, 0},
+		{ST, 1, 2, 6},
+	}
+	for i, in := range want {
+		if m.IMem[i] != in {
+			t.Errorf("IMem[%d] = %v, want %v", i, m.IMem[i], in)
+		}
+	}
+
+	tests := []struct {
+		line string
+		want string
+	}{
+		{"x: HALT 0,0,0", "line 1: missing location"},
+		{"0 HALT 0,0,0", "line 1: missing ':' after location"},
+		{"0: JMP 0,0(0)", `line 1: illegal opcode "JMP"`},
+		{"0: ADD 0,0", "line 1: missing ',' after second operand"},
+		{"0: ADD 8,0,0", "line 1: bad register"},
+		{"0: LD 0,0", "line 1: missing '(' after displacement"},
+		{"0: LD 0,0(1", "line 1: missing ')' after base register"},
+		{"1024: HALT 0,0,0", "line 1: location 1024 out of range"},
+	}
+	for _, tt := range tests {
+		err := m.Load(strings.NewReader(tt.line))
+		if err == nil || !strings.HasPrefix(err.Error(), tt.want) {
+			t.Errorf("Load(%q) = %v, want %q", tt.line, err, tt.want)
+		}
+	}
+}
+
+// TestStep checks how each kind of failure stops the machine
+func TestStep(t *testing.T) {
+	tests := []struct {
+		name  string
+		code  string
+		input string
+		want  StepResult
+	}{
+		{"halt", "0: HALT 0,0,0", "", Halted},
+		{"division by zero", "0: LDC 0,1(0)\n1: DIV 0,0,1", "", ZeroDivide},
+		{"load below memory", "0: LD 0,-1(0)", "", DMemErr},
+		{"store above memory", "0: ST 0,1024(0)", "", DMemErr},
+		{"jump out of memory", "0: LDC 1,-5(0)\n1: JEQ 0,0(1)", "", IMemErr},
+		{"bad input", "0: IN 0,0,0", "x", InputErr},
+		{"end of input", "0: IN 0,0,0", "", InputErr},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, result := execute(t, tt.code, tt.input)
+			if result != tt.want {
+				t.Errorf("stopped with %v, want %v", result, tt.want)
+			}
+		})
+	}
+}
+
+// TestInstructions checks the arithmetic, memory and jump instructions
+func TestInstructions(t *testing.T) {
+	code := `
+ 0: IN 0,0,0
+ 1: LDC 1,3(0)
+ 2: ADD 2,0,1
+ 3: OUT 2,0,0
+ 4: SUB 2,0,1
+ 5: OUT 2,0,0
+ 6: MUL 2,0,1
+ 7: OUT 2,0,0
+ 8: DIV 2,0,1
+ 9: OUT 2,0,0
+10: LDA 3,7(1)
+11: OUT 3,0,0
+12: ST 0,4(1)
+13: LD 4,7(6)
+14: OUT 4,0,0
+15: LDC 1,-1(0)
+16: JLT 1,2(7)
+17: OUT 1,0,0
+18: OUT 1,0,0
+19: JGE 1,0(0)
+20: LDC 1,0(0)
+21: JEQ 1,23(6)
+22: OUT 1,0,0
+23: LD 5,0(6)
+24: OUT 5,0,0
+`
+	got, result := execute(t, code, "-7")
+	if result != Halted {
+		t.Errorf("stopped with %v", result)
+	}
+	if want := "-4 -10 -21 -2 10 -7 1023"; got != want {
+		t.Errorf("wrote %q, want %q", got, want)
+	}
+}
+
+// TestTraceAndBreakpoints checks the trace output and that Run stops at a
+// breakpoint and continues past it when called again
+func TestTraceAndBreakpoints(t *testing.T) {
+	var out, trace bytes.Buffer
+	m := NewMachine(strings.NewReader(""), &out)
+	code := "0: LDC 0,1(0)\n1: OUT 0,0,0\n2: LDC 0,2(0)\n3: OUT 0,0,0\n"
+	if err := m.Load(strings.NewReader(code)); err != nil {
+		t.Fatal(err)
+	}
+	m.Trace, m.TraceOut = true, &trace
+	m.SetBreakpoint(2, true)
+
+	if result := m.Run(); result != Break || m.Reg[PCReg] != 2 {
+		t.Fatalf("stopped with %v at %d, want %v at 2", result, m.Reg[PCReg], Break)
+	}
+	if out.String() != "1\n" {
+		t.Errorf("wrote %q before the breakpoint", out.String())
+	}
+	if result := m.Run(); result != Halted {
+		t.Fatalf("stopped with %v, want %v", result, Halted)
+	}
+	if out.String() != "1\n2\n" || m.Steps != 5 {
+		t.Errorf("wrote %q in %d steps, want %q in 5", out.String(), m.Steps, "1\n2\n")
+	}
+	want := "    0:    LDC  0,  1(0)\n" +
+		"    1:    OUT  0,  0,  0\n" +
+		"    2:    LDC  0,  2(0)\n" +
+		"    3:    OUT  0,  0,  0\n" +
+		"    4:   HALT  0,  0,  0\n"
+	if trace.String() != want {
+		t.Errorf("trace:\n%s\nwant:\n%s", trace.String(), want)
+	}
+
+	m.SetBreakpoint(2, false)
+	if m.Breakpoint(2) {
+		t.Error("breakpoint not cleared")
+	}
+}
+
+// TestDebug runs a short interactive session
+func TestDebug(t *testing.T) {
+	commands := "b 2\ng\nr\nd 1 1\ns\nx\nc\ng\ng\nq\n"
+	var out bytes.Buffer
+	m := NewMachine(strings.NewReader(commands), &out)
+	code := "0: LDC 0,5(0)\n1: ST 0,1(1)\n2: OUT 0,0,0\n"
+	if err := m.Load(strings.NewReader(code)); err != nil {
+		t.Fatal(err)
+	}
+	if err := m.Debug(&out); err != nil {
+		t.Fatal(err)
+	}
+	got := out.String()
+	for _, want := range []string{
+		"Breakpoint set at 2\n",
+		"Breakpoint at 2\nNumber of instructions executed = 2\n",
+		"r[0] = 5    ",
+		"    1:     5\n",
+		"    2:    OUT  0,  0,  0\n5\n",
+		"Command x unknown.\n",
+		"Halted\nNumber of instructions executed = 4\n",
+	} {
+		if !strings.Contains(got, want) {
+			t.Errorf("session output lacks %q:\n%s", want, got)
+		}
+	}
+}
@@ -8,21 +8,23 @@ import (
 	"fyne.io/fyne/v2"
 	"fyne.io/fyne/v2/widget"
 	"fyne.io/x/fyne/widget/diagramwidget"
+
+	"tinycompiler/tiny"
 )
 
 type TreeVisualizer struct {
 	widget.BaseWidget
 	diagram *diagramwidget.DiagramWidget
-	tree    *TreeNode
-	nodes   map[*TreeNode]*diagramwidget.DiagramNode
+	tree    *tiny.TreeNode
+	nodes   map[*tiny.TreeNode]*diagramwidget.DiagramNode
 	links   []*diagramwidget.BaseDiagramLink
 }
 
-func NewTreeVisualizer(tree *TreeNode, diagram *diagramwidget.DiagramWidget) *TreeVisualizer {
+func NewTreeVisualizer(tree *tiny.TreeNode, diagram *diagramwidget.DiagramWidget) *TreeVisualizer {
 	v := &TreeVisualizer{
 		diagram: diagram,
 		tree:    tree,
-		nodes:   make(map[*TreeNode]*diagramwidget.DiagramNode),
+		nodes:   make(map[*tiny.TreeNode]*diagramwidget.DiagramNode),
 		links:   make([]*diagramwidget.BaseDiagramLink, 0),
 	}
 	v.ExtendBaseWidget(v)
@@ -48,7 +50,7 @@ func (v *TreeVisualizer) createDiagram() {
 	// }
 }
 
-func (v *TreeVisualizer) createNodes(node *TreeNode, level, index int, xPos, yPos float32, levelOffsets map[int]float32) {
+func (v *TreeVisualizer) createNodes(node *tiny.TreeNode, level, index int, xPos, yPos float32, levelOffsets map[int]float32) {
 	if node == nil {
 		return
 	}
@@ -72,7 +74,7 @@ func (v *TreeVisualizer) createNodes(node *TreeNode, level, index int, xPos, yPo
 	// Create diagram node
 	diagNode := diagramwidget.NewDiagramNode(v.diagram, label, fmt.Sprintf("node-%p", node))
 	// Set to red color if Leaf node
-	if node.ExpKind == ConstK || node.ExpKind == IdK {
+	if node.NodeKind == tiny.ExpK && (node.ExpKind == tiny.ConstK || node.ExpKind == tiny.IdK) {
 		diagNode.SetForegroundColor(color.RGBA{255, 0, 0, 255})
 	}
 	v.nodes[node] = &diagNode
@@ -84,7 +86,7 @@ func (v *TreeVisualizer) createNodes(node *TreeNode, level, index int, xPos, yPo
 	var childSpacing float32 = 150.0 // Base spacing between children
 	childXStart := xPos - (float32(numOfChildNodes-1) * childSpacing / 2)
 
-	for i := 0; i < 3; i++ {
+	for i := range node.Children {
 		if node.Children[i] != nil {
 			childXPos := childXStart + float32(i)*childSpacing
 			v.createNodes(node.Children[i], level+1, index, childXPos, yPos+100, levelOffsets)
@@ -98,41 +100,50 @@ func (v *TreeVisualizer) createNodes(node *TreeNode, level, index int, xPos, yPo
 	}
 }
 
-func (v *TreeVisualizer) getNodeLabel(node *TreeNode) string {
+func (v *TreeVisualizer) getNodeLabel(node *tiny.TreeNode) string {
 	var nodeType, details string
 
 	// Determine node type
 	switch node.NodeKind {
-	case StmtK:
+	case tiny.StmtK:
 		nodeType = "Statement"
 		switch node.StmtKind {
-		case IfK:
+		case tiny.IfK:
 			details = "If"
-		case RepeatK:
+		case tiny.RepeatK:
 			details = "Repeat"
-		case AssignK:
+		case tiny.WhileK:
+			details = "While"
+		case tiny.ForK:
+			details = fmt.Sprintf("For\n%s %s", node.Name, node.Op)
+		case tiny.AssignK:
 			details = fmt.Sprintf("Assign\n%s", node.Name)
-		case ReadK:
+		case tiny.ReadK:
 			details = fmt.Sprintf("Read\n%s", node.Name)
-		case WriteK:
+		case tiny.WriteK:
 			details = "Write"
 		}
-	case ExpK:
+	case tiny.ExpK:
 		nodeType = "Expression"
 		switch node.ExpKind {
-		case OpK:
+		case tiny.OpK:
 			details = fmt.Sprintf("Op\n%s", node.Op)
-		case ConstK:
+		case tiny.ConstK:
 			details = fmt.Sprintf("Const\n%d", node.Value)
-		case IdK:
+		case tiny.IdK:
 			details = fmt.Sprintf("Id\n%s", node.Name)
+		case tiny.UnaryK:
+			details = fmt.Sprintf("Unary\n%s", node.Op)
 		}
+	case tiny.ErrorK:
+		nodeType = "Error"
+		details = fmt.Sprintf("line %d", node.LineNum)
 	}
 
 	return fmt.Sprintf("%s\n%s", nodeType, details)
 }
 
-func (v *TreeVisualizer) createLinks(node *TreeNode) {
+func (v *TreeVisualizer) createLinks(node *tiny.TreeNode) {
 	if node == nil {
 		return
 	}
@@ -140,7 +151,7 @@ func (v *TreeVisualizer) createLinks(node *TreeNode) {
 	currentNode := *v.nodes[node]
 
 	// Create links to children
-	for i := 0; i < 3; i++ {
+	for i := range node.Children {
 		if node.Children[i] != nil {
 			childNode := *v.nodes[node.Children[i]]
 			link := diagramwidget.NewDiagramLink(v.diagram, fmt.Sprintf("link-%p-%d", node, i))
@@ -161,7 +172,7 @@ func (v *TreeVisualizer) createLinks(node *TreeNode) {
 	}
 
 	// Recursively create links for children
-	for i := 0; i < 3; i++ {
+	for i := range node.Children {
 		v.createLinks(node.Children[i])
 	}
 
@@ -185,3 +196,13 @@ func (v *TreeVisualizer) avoidOverlap(x, y float32, currentNode diagramwidget.Di
 	}
 	return x, y
 }
+
+func getNumChildNodes(node *tiny.TreeNode) int {
+	var count int
+	for i := range node.Children {
+		if node.Children[i] != nil {
+			count++
+		}
+	}
+	return count
+}
@@ -0,0 +1,370 @@
+package wasm
+
+import (
+	"errors"
+	"fmt"
+
+	"tinycompiler/tiny"
+)
+
+// Type indices of the module's function signatures
+const (
+	typeMain  = iota // [] -> []
+	typeRead         // [] -> [i64]
+	typeWrite        // [i64] -> [], also the type of divzero
+	typeDiv          // [i64 i64 i64] -> [i64]
+)
+
+// Function indices: imports come first
+const (
+	funcRead = iota
+	funcWrite
+	funcDivZero
+	funcMain
+	funcDiv
+)
+
+// compiler holds the state of a compilation
+type compiler struct {
+	code   []byte // Body of main being generated
+	table  *tiny.SymbolTable
+	hidden int // Locals after the variables, for values no variable names
+	err    error
+}
+
+// Compile translates the program rooted at tree to a WebAssembly module
+func Compile(tree *tiny.TreeNode) ([]byte, error) {
+	table, _ := tiny.BuildSymtab(tree)
+	c := &compiler{table: table}
+	c.stmtSeq(tree)
+	c.code = append(c.code, opEnd)
+	if c.err != nil {
+		return nil, c.err
+	}
+
+	m := []byte(magic + version)
+
+	var types []byte
+	types = appendULEB(types, 4)
+	types = append(types, typeFunc, 0, 0)
+	types = append(types, typeFunc, 0, 1, typeI64)
+	types = append(types, typeFunc, 1, typeI64, 0)
+	types = append(types, typeFunc, 3, typeI64, typeI64, typeI64, 1, typeI64)
+	m = appendSection(m, secType, types)
+
+	var imports []byte
+	imports = appendULEB(imports, 3)
+	imports = appendName(appendName(imports, "env"), "read")
+	imports = append(imports, kindFunc, typeRead)
+	imports = appendName(appendName(imports, "env"), "write")
+	imports = append(imports, kindFunc, typeWrite)
+	imports = appendName(appendName(imports, "env"), "divzero")
+	imports = append(imports, kindFunc, typeWrite)
+	m = appendSection(m, secImport, imports)
+
+	m = appendSection(m, secFunction, []byte{2, typeMain, typeDiv})
+
+	var exports []byte
+	exports = appendULEB(exports, 1)
+	exports = appendName(exports, "main")
+	exports = append(exports, kindFunc, funcMain)
+	m = appendSection(m, secExport, exports)
+
+	var code []byte
+	code = appendULEB(code, 2)
+	code = appendFunc(code, table.Len()+c.hidden, c.code)
+	code = appendFunc(code, 0, divBody)
+	m = appendSection(m, secCode, code)
+
+	return m, nil
+}
+
+// divBody is the body of the division helper, whose third parameter is the
+// source line. On division by zero it passes the line to divzero and traps.
+// Unlike i64.div_s it does not trap when dividing the most negative value
+// by -1.
+var divBody = []byte{
+	opLocalGet, 1, opI64Eqz,
+	opIf, blockVoid,
+	opLocalGet, 2, opCall, funcDivZero, opUnreachable,
+	opEnd,
+	opLocalGet, 1, opI64Const, 0x7F, opI64Eq,
+	opIf, typeI64,
+	opI64Const, 0, opLocalGet, 0, opI64Sub,
+	opElse,
+	opLocalGet, 0, opLocalGet, 1, opI64DivS,
+	opEnd,
+	opEnd,
+}
+
+// appendFunc appends a function body with nlocals i64 locals
+func appendFunc(b []byte, nlocals int, body []byte) []byte {
+	var f []byte
+	if nlocals == 0 {
+		f = appendULEB(f, 0)
+	} else {
+		f = appendULEB(f, 1)
+		f = appendULEB(f, uint64(nlocals))
+		f = append(f, typeI64)
+	}
+	f = append(f, body...)
+	b = appendULEB(b, uint64(len(f)))
+	return append(b, f...)
+}
+
+func (c *compiler) emit(b ...byte) {
+	c.code = append(c.code, b...)
+}
+
+// local returns the local index of a variable
+func (c *compiler) local(name string) uint64 {
+	return uint64(c.table.Lookup(name).Location)
+}
+
+// newLocal allocates a local that no variable uses
+func (c *compiler) newLocal() uint64 {
+	c.hidden++
+	return uint64(c.table.Len() + c.hidden - 1)
+}
+
+// set pops the top of the stack into local i
+func (c *compiler) set(i uint64) {
+	c.emit(opLocalSet)
+	c.code = appendULEB(c.code, i)
+}
+
+// get pushes local i
+func (c *compiler) get(i uint64) {
+	c.emit(opLocalGet)
+	c.code = appendULEB(c.code, i)
+}
+
+func (c *compiler) fail(node *tiny.TreeNode, msg string) {
+	if c.err != nil {
+		return
+	}
+	if node != nil {
+		msg = fmt.Sprintf("line %d: %s", node.LineNum, msg)
+	}
+	c.err = errors.New(msg)
+}
+
+func (c *compiler) stmtSeq(node *tiny.TreeNode) {
+	for ; node != nil; node = node.Sibling {
+		c.stmt(node)
+	}
+}
+
+func (c *compiler) stmt(node *tiny.TreeNode) {
+	if node.NodeKind != tiny.StmtK {
+		c.fail(node, "cannot compile a syntax error")
+		return
+	}
+
+	switch node.StmtKind {
+	case tiny.IfK:
+		c.cond(node.Children[0])
+		c.emit(opIf, blockVoid)
+		c.stmtSeq(node.Children[1])
+		if node.Children[2] != nil {
+			c.emit(opElse)
+			c.stmtSeq(node.Children[2])
+		}
+		c.emit(opEnd)
+
+	case tiny.RepeatK:
+		c.emit(opLoop, blockVoid)
+		c.stmtSeq(node.Children[0])
+		c.cond(node.Children[1])
+		c.emit(opI32Eqz, opBrIf, 0, opEnd)
+
+	case tiny.WhileK:
+		// Test once on entry, then at the bottom of each iteration, which
+		// avoids the unconditional branch and the block around the loop
+		c.cond(node.Children[0])
+		c.emit(opIf, blockVoid, opLoop, blockVoid)
+		c.stmtSeq(node.Children[1])
+		c.cond(node.Children[0])
+		c.emit(opBrIf, 0, opEnd, opEnd)
+
+	case tiny.ForK:
+		// Laid out like a while loop, with the test repeated at the bottom.
+		// The limit and step are evaluated once, into locals of their own.
+		i := c.local(node.Name)
+		c.exp(node.Children[0])
+		c.set(i)
+		limit := c.newLocal()
+		c.exp(node.Children[1])
+		c.set(limit)
+		var step uint64
+		if node.Children[2] != nil {
+			step = c.newLocal()
+			c.exp(node.Children[2])
+			c.set(step)
+		}
+		c.forTest(node, i, limit)
+		c.emit(opIf, blockVoid, opLoop, blockVoid)
+		c.stmtSeq(node.Children[3])
+		c.get(i)
+		if node.Children[2] != nil {
+			c.get(step)
+		} else {
+			c.emit(opI64Const, 1)
+		}
+		if node.Op == "downto" {
+			c.emit(opI64Sub)
+		} else {
+			c.emit(opI64Add)
+		}
+		c.set(i)
+		c.forTest(node, i, limit)
+		c.emit(opBrIf, 0, opEnd, opEnd)
+
+	case tiny.AssignK:
+		c.exp(node.Children[0])
+		c.emit(opLocalSet)
+		c.code = appendULEB(c.code, c.local(node.Name))
+
+	case tiny.ReadK:
+		c.emit(opCall, funcRead, opLocalSet)
+		c.code = appendULEB(c.code, c.local(node.Name))
+
+	case tiny.WriteK:
+		c.exp(node.Children[0])
+		c.emit(opCall, funcWrite)
+	}
+}
+
+// forTest leaves an i32 telling whether the variable of the for loop node,
+// local i, has not yet passed the limit held in local limit
+func (c *compiler) forTest(node *tiny.TreeNode, i, limit uint64) {
+	c.get(i)
+	c.get(limit)
+	if node.Op == "downto" {
+		c.emit(opI64GeS)
+	} else {
+		c.emit(opI64LeS)
+	}
+}
+
+// comparisons maps TINY comparison operators to the i64 instructions
+// that implement them
+var comparisons = map[string]byte{
+	"<":  opI64LtS,
+	">":  opI64GtS,
+	"<=": opI64LeS,
+	">=": opI64GeS,
+	"=":  opI64Eq,
+	"<>": opI64Ne,
+}
+
+// isComparison reports whether node is a comparison
+func isComparison(node *tiny.TreeNode) bool {
+	_, ok := comparisons[node.Op]
+	return node.NodeKind == tiny.ExpK && node.ExpKind == tiny.OpK && ok
+}
+
+// isBoolean reports whether node is a comparison or logical operator,
+// whose truth value cond computes directly
+func isBoolean(node *tiny.TreeNode) bool {
+	switch {
+	case node.NodeKind != tiny.ExpK:
+		return false
+	case node.ExpKind == tiny.UnaryK:
+		return node.Op == "not"
+	case node.ExpKind == tiny.OpK:
+		return node.Op == "and" || node.Op == "or" || isComparison(node)
+	}
+	return false
+}
+
+// cond leaves the truth value of node on the stack as an i32. The right
+// operand of and and or is only evaluated if the left one does not decide
+// the result.
+func (c *compiler) cond(node *tiny.TreeNode) {
+	if node == nil || !isBoolean(node) {
+		c.exp(node)
+		c.emit(opI64Const, 0, opI64Ne)
+		return
+	}
+
+	switch node.Op {
+	case "not":
+		c.cond(node.Children[0])
+		c.emit(opI32Eqz)
+	case "and":
+		c.cond(node.Children[0])
+		c.emit(opIf, typeI32)
+		c.cond(node.Children[1])
+		c.emit(opElse, opI32Const, 0, opEnd)
+	case "or":
+		c.cond(node.Children[0])
+		c.emit(opIf, typeI32, opI32Const, 1, opElse)
+		c.cond(node.Children[1])
+		c.emit(opEnd)
+	default:
+		c.compare(node)
+	}
+}
+
+// compare emits a comparison, leaving an i32
+func (c *compiler) compare(node *tiny.TreeNode) {
+	c.exp(node.Children[0])
+	c.exp(node.Children[1])
+	c.emit(comparisons[node.Op])
+}
+
+// exp leaves the value of node on the stack as an i64
+func (c *compiler) exp(node *tiny.TreeNode) {
+	if node == nil || node.NodeKind != tiny.ExpK {
+		c.fail(node, "cannot compile a syntax error")
+		return
+	}
+
+	switch node.ExpKind {
+	case tiny.ConstK:
+		c.emit(opI64Const)
+		c.code = appendSLEB(c.code, int64(node.Value))
+
+	case tiny.IdK:
+		c.emit(opLocalGet)
+		c.code = appendULEB(c.code, c.local(node.Name))
+
+	case tiny.OpK, tiny.UnaryK:
+		if isBoolean(node) {
+			c.cond(node)
+			c.emit(opI64ExtendU)
+			return
+		}
+		if node.ExpKind == tiny.UnaryK {
+			switch node.Op {
+			case "-":
+				c.emit(opI64Const, 0)
+				c.exp(node.Children[0])
+				c.emit(opI64Sub)
+			case "+":
+				c.exp(node.Children[0])
+			default:
+				c.fail(node, "unknown operator "+node.Op)
+			}
+			return
+		}
+
+		c.exp(node.Children[0])
+		c.exp(node.Children[1])
+		switch node.Op {
+		case "+":
+			c.emit(opI64Add)
+		case "-":
+			c.emit(opI64Sub)
+		case "*":
+			c.emit(opI64Mul)
+		case "/":
+			c.emit(opI64Const)
+			c.code = appendSLEB(c.code, int64(node.LineNum))
+			c.emit(opCall, funcDiv)
+		default:
+			c.fail(node, "unknown operator "+node.Op)
+		}
+	}
+}
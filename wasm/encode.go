@@ -0,0 +1,104 @@
+// Package wasm compiles TINY programs to binary WebAssembly modules.
+//
+// A compiled module imports three host functions, "env" "read" of type
+// [] -> [i64], "env" "write" of type [i64] -> [] and "env" "divzero" of
+// type [i64] -> [], and exports the program as "main" of type [] -> [].
+// Variables are i64 locals of main. Division by zero calls divzero with
+// the source line, so that the host can report it, and then traps.
+package wasm
+
+// Module layout
+const (
+	magic   = "\x00asm"
+	version = "\x01\x00\x00\x00"
+)
+
+// Section ids
+const (
+	secType     = 1
+	secImport   = 2
+	secFunction = 3
+	secExport   = 7
+	secCode     = 10
+)
+
+// Value types and other type encodings
+const (
+	typeI32   = 0x7F
+	typeI64   = 0x7E
+	typeFunc  = 0x60
+	blockVoid = 0x40
+	kindFunc  = 0x00
+)
+
+// Instruction opcodes used by the compiler
+const (
+	opUnreachable = 0x00
+	opLoop        = 0x03
+	opIf          = 0x04
+	opElse        = 0x05
+	opEnd         = 0x0B
+	opBrIf        = 0x0D
+	opCall        = 0x10
+	opLocalGet    = 0x20
+	opLocalSet    = 0x21
+	opI32Const    = 0x41
+	opI64Const    = 0x42
+	opI32Eqz      = 0x45
+	opI64Eqz      = 0x50
+	opI64Eq       = 0x51
+	opI64Ne       = 0x52
+	opI64LtS      = 0x53
+	opI64GtS      = 0x55
+	opI64LeS      = 0x57
+	opI64GeS      = 0x59
+	opI64Add      = 0x7C
+	opI64Sub      = 0x7D
+	opI64Mul      = 0x7E
+	opI64DivS     = 0x7F
+	opI64ExtendU  = 0xAD // i64.extend_i32_u
+)
+
+// appendULEB appends v in unsigned LEB128
+func appendULEB(b []byte, v uint64) []byte {
+	for {
+		c := byte(v & 0x7F)
+		v >>= 7
+		if v != 0 {
+			c |= 0x80
+		}
+		b = append(b, c)
+		if v == 0 {
+			return b
+		}
+	}
+}
+
+// appendSLEB appends v in signed LEB128
+func appendSLEB(b []byte, v int64) []byte {
+	for {
+		c := byte(v & 0x7F)
+		v >>= 7
+		done := (v == 0 && c&0x40 == 0) || (v == -1 && c&0x40 != 0)
+		if !done {
+			c |= 0x80
+		}
+		b = append(b, c)
+		if done {
+			return b
+		}
+	}
+}
+
+// appendName appends a length-prefixed UTF-8 name
+func appendName(b []byte, name string) []byte {
+	b = appendULEB(b, uint64(len(name)))
+	return append(b, name...)
+}
+
+// appendSection appends a section with its id and size
+func appendSection(b []byte, id byte, contents []byte) []byte {
+	b = append(b, id)
+	b = appendULEB(b, uint64(len(contents)))
+	return append(b, contents...)
+}
@@ -0,0 +1,509 @@
+package wasm
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+)
+
+// funcType is a decoded function signature
+type funcType struct {
+	params, results []byte
+}
+
+// numericOps gives the operand and result types of the stack-only
+// instructions the validator understands
+var numericOps = map[byte]funcType{
+	opI32Eqz:     {[]byte{typeI32}, []byte{typeI32}},
+	opI64Eqz:     {[]byte{typeI64}, []byte{typeI32}},
+	opI64Eq:      {[]byte{typeI64, typeI64}, []byte{typeI32}},
+	opI64Ne:      {[]byte{typeI64, typeI64}, []byte{typeI32}},
+	opI64LtS:     {[]byte{typeI64, typeI64}, []byte{typeI32}},
+	opI64GtS:     {[]byte{typeI64, typeI64}, []byte{typeI32}},
+	opI64LeS:     {[]byte{typeI64, typeI64}, []byte{typeI32}},
+	opI64GeS:     {[]byte{typeI64, typeI64}, []byte{typeI32}},
+	opI64Add:     {[]byte{typeI64, typeI64}, []byte{typeI64}},
+	opI64Sub:     {[]byte{typeI64, typeI64}, []byte{typeI64}},
+	opI64Mul:     {[]byte{typeI64, typeI64}, []byte{typeI64}},
+	opI64DivS:    {[]byte{typeI64, typeI64}, []byte{typeI64}},
+	opI64ExtendU: {[]byte{typeI32}, []byte{typeI64}},
+}
+
+// reader decodes the primitive encodings of a module
+type reader struct {
+	b   []byte
+	pos int
+}
+
+var errEOF = errors.New("unexpected end of module")
+
+func (r *reader) done() bool {
+	return r.pos >= len(r.b)
+}
+
+func (r *reader) byte() (byte, error) {
+	if r.done() {
+		return 0, errEOF
+	}
+	c := r.b[r.pos]
+	r.pos++
+	return c, nil
+}
+
+func (r *reader) bytes(n uint64) ([]byte, error) {
+	if n > uint64(len(r.b)-r.pos) {
+		return nil, errEOF
+	}
+	b := r.b[r.pos : r.pos+int(n)]
+	r.pos += int(n)
+	return b, nil
+}
+
+func (r *reader) uleb() (uint64, error) {
+	var v uint64
+	for shift := 0; shift < 64; shift += 7 {
+		c, err := r.byte()
+		if err != nil {
+			return 0, err
+		}
+		v |= uint64(c&0x7F) << shift
+		if c&0x80 == 0 {
+			return v, nil
+		}
+	}
+	return 0, fmt.Errorf("offset %d: integer too long", r.pos)
+}
+
+func (r *reader) sleb() (int64, error) {
+	var v int64
+	for shift := 0; shift < 70; shift += 7 {
+		c, err := r.byte()
+		if err != nil {
+			return 0, err
+		}
+		v |= int64(c&0x7F) << shift
+		if c&0x80 == 0 {
+			if shift+7 < 64 && c&0x40 != 0 {
+				v |= -1 << (shift + 7)
+			}
+			return v, nil
+		}
+	}
+	return 0, fmt.Errorf("offset %d: integer too long", r.pos)
+}
+
+func (r *reader) name() (string, error) {
+	n, err := r.uleb()
+	if err != nil {
+		return "", err
+	}
+	b, err := r.bytes(n)
+	return string(b), err
+}
+
+func (r *reader) valTypes() ([]byte, error) {
+	n, err := r.uleb()
+	if err != nil {
+		return nil, err
+	}
+	types, err := r.bytes(n)
+	if err != nil {
+		return nil, err
+	}
+	for _, t := range types {
+		if t != typeI32 && t != typeI64 {
+			return nil, fmt.Errorf("offset %d: unsupported value type %#x", r.pos, t)
+		}
+	}
+	return types, nil
+}
+
+// module is the decoded part of a module that validation needs
+type module struct {
+	types   []funcType
+	funcs   []uint64 // Type index of every function, imports first
+	imports int      // Number of imported functions
+	bodies  [][]byte
+}
+
+// Validate checks that b is a well-formed module whose functions type-check.
+// It understands the subset of WebAssembly that Compile produces.
+func Validate(b []byte) error {
+	if !bytes.HasPrefix(b, []byte(magic+version)) {
+		return errors.New("missing module header")
+	}
+	r := &reader{b: b, pos: len(magic + version)}
+	var m module
+	var last byte
+	for !r.done() {
+		id, err := r.byte()
+		if err != nil {
+			return err
+		}
+		size, err := r.uleb()
+		if err != nil {
+			return err
+		}
+		contents, err := r.bytes(size)
+		if err != nil {
+			return err
+		}
+		if id == 0 {
+			continue // Custom sections may appear anywhere
+		}
+		if id <= last {
+			return fmt.Errorf("section %d out of order", id)
+		}
+		last = id
+		if err := m.section(id, &reader{b: contents}); err != nil {
+			return fmt.Errorf("section %d: %w", id, err)
+		}
+	}
+
+	if len(m.bodies) != len(m.funcs)-m.imports {
+		return fmt.Errorf("%d function bodies for %d functions", len(m.bodies), len(m.funcs)-m.imports)
+	}
+	for i, body := range m.bodies {
+		if err := m.validateFunc(m.types[m.funcs[m.imports+i]], body); err != nil {
+			return fmt.Errorf("function %d: %w", m.imports+i, err)
+		}
+	}
+	return nil
+}
+
+// section decodes the contents of the section with the given id
+func (m *module) section(id byte, r *reader) error {
+	n, err := r.uleb()
+	if err != nil {
+		return err
+	}
+	for i := uint64(0); i < n; i++ {
+		switch id {
+		case secType:
+			form, err := r.byte()
+			if err != nil {
+				return err
+			}
+			if form != typeFunc {
+				return fmt.Errorf("type %d: bad form %#x", i, form)
+			}
+			var t funcType
+			if t.params, err = r.valTypes(); err != nil {
+				return err
+			}
+			if t.results, err = r.valTypes(); err != nil {
+				return err
+			}
+			m.types = append(m.types, t)
+
+		case secImport:
+			if _, err := r.name(); err != nil {
+				return err
+			}
+			if _, err := r.name(); err != nil {
+				return err
+			}
+			kind, err := r.byte()
+			if err != nil {
+				return err
+			}
+			if kind != kindFunc {
+				return fmt.Errorf("import %d: unsupported kind %#x", i, kind)
+			}
+			if err := m.addFunc(r); err != nil {
+				return err
+			}
+			m.imports++
+
+		case secFunction:
+			if err := m.addFunc(r); err != nil {
+				return err
+			}
+
+		case secExport:
+			if _, err := r.name(); err != nil {
+				return err
+			}
+			kind, err := r.byte()
+			if err != nil {
+				return err
+			}
+			index, err := r.uleb()
+			if err != nil {
+				return err
+			}
+			if kind != kindFunc {
+				return fmt.Errorf("export %d: unsupported kind %#x", i, kind)
+			}
+			if index >= uint64(len(m.funcs)) {
+				return fmt.Errorf("export %d: function %d out of range", i, index)
+			}
+
+		case secCode:
+			size, err := r.uleb()
+			if err != nil {
+				return err
+			}
+			body, err := r.bytes(size)
+			if err != nil {
+				return err
+			}
+			m.bodies = append(m.bodies, body)
+
+		default:
+			return errors.New("unsupported section")
+		}
+	}
+	if !r.done() {
+		return errors.New("trailing bytes")
+	}
+	return nil
+}
+
+// addFunc reads a type index and declares a function of that type
+func (m *module) addFunc(r *reader) error {
+	t, err := r.uleb()
+	if err != nil {
+		return err
+	}
+	if t >= uint64(len(m.types)) {
+		return fmt.Errorf("type %d out of range", t)
+	}
+	m.funcs = append(m.funcs, t)
+	return nil
+}
+
+// frame is an entry of the control stack during validation
+type frame struct {
+	op          byte   // opLoop, opIf or opElse, or 0 for the function body
+	results     []byte // Types left on the stack by the construct
+	height      int    // Operand stack height at entry
+	unreachable bool   // Set after unreachable, when any operands may be popped
+}
+
+// validator type-checks one function body
+type validator struct {
+	locals   []byte
+	operands []byte
+	controls []frame
+}
+
+func (m *module) validateFunc(t funcType, body []byte) error {
+	v := &validator{locals: append([]byte(nil), t.params...)}
+	r := &reader{b: body}
+	groups, err := r.uleb()
+	if err != nil {
+		return err
+	}
+	for i := uint64(0); i < groups; i++ {
+		n, err := r.uleb()
+		if err != nil {
+			return err
+		}
+		typ, err := r.byte()
+		if err != nil {
+			return err
+		}
+		if typ != typeI32 && typ != typeI64 {
+			return fmt.Errorf("unsupported local type %#x", typ)
+		}
+		if n > uint64(len(body)) {
+			return errors.New("too many locals") // Guard against huge counts
+		}
+		v.locals = append(v.locals, bytes.Repeat([]byte{typ}, int(n))...)
+	}
+
+	v.controls = []frame{{results: t.results}}
+	for len(v.controls) > 0 {
+		at := r.pos
+		op, err := r.byte()
+		if err != nil {
+			return err
+		}
+		if err := v.instr(m, op, r); err != nil {
+			return fmt.Errorf("offset %d: %w", at, err)
+		}
+	}
+	if !r.done() {
+		return errors.New("code after end of function")
+	}
+	return nil
+}
+
+func (v *validator) push(types ...byte) {
+	v.operands = append(v.operands, types...)
+}
+
+// pop removes the given types from the top of the operand stack
+func (v *validator) pop(types ...byte) error {
+	top := v.controls[len(v.controls)-1]
+	for i := len(types) - 1; i >= 0; i-- {
+		n := len(v.operands)
+		if n <= top.height {
+			if top.unreachable {
+				continue
+			}
+			return errors.New("operand stack underflow")
+		}
+		if v.operands[n-1] != types[i] {
+			return fmt.Errorf("operand has type %#x, want %#x", v.operands[n-1], types[i])
+		}
+		v.operands = v.operands[:n-1]
+	}
+	return nil
+}
+
+// localType returns the type of the local whose index comes next in r
+func (v *validator) localType(r *reader) (byte, error) {
+	i, err := r.uleb()
+	if err != nil {
+		return 0, err
+	}
+	if i >= uint64(len(v.locals)) {
+		return 0, fmt.Errorf("local %d out of range", i)
+	}
+	return v.locals[i], nil
+}
+
+// blockType reads the result type of a structured instruction
+func blockType(r *reader) ([]byte, error) {
+	t, err := r.byte()
+	if err != nil {
+		return nil, err
+	}
+	switch t {
+	case blockVoid:
+		return nil, nil
+	case typeI32, typeI64:
+		return []byte{t}, nil
+	}
+	return nil, fmt.Errorf("unsupported block type %#x", t)
+}
+
+// endFrame checks that the innermost construct leaves exactly its results
+func (v *validator) endFrame() error {
+	f := v.controls[len(v.controls)-1]
+	if err := v.pop(f.results...); err != nil {
+		return err
+	}
+	if len(v.operands) != f.height {
+		return errors.New("values left on the stack at end of block")
+	}
+	return nil
+}
+
+func (v *validator) instr(m *module, op byte, r *reader) error {
+	if t, ok := numericOps[op]; ok {
+		if err := v.pop(t.params...); err != nil {
+			return err
+		}
+		v.push(t.results...)
+		return nil
+	}
+
+	switch op {
+	case opLoop, opIf:
+		results, err := blockType(r)
+		if err != nil {
+			return err
+		}
+		if op == opIf {
+			if err := v.pop(typeI32); err != nil {
+				return err
+			}
+		}
+		v.controls = append(v.controls, frame{op: op, results: results, height: len(v.operands)})
+
+	case opElse:
+		f := &v.controls[len(v.controls)-1]
+		if f.op != opIf {
+			return errors.New("else outside if")
+		}
+		if err := v.endFrame(); err != nil {
+			return err
+		}
+		f.op = opElse
+		f.unreachable = false
+
+	case opEnd:
+		f := v.controls[len(v.controls)-1]
+		if f.op == opIf && len(f.results) > 0 {
+			return errors.New("if with a result needs an else")
+		}
+		if err := v.endFrame(); err != nil {
+			return err
+		}
+		v.controls = v.controls[:len(v.controls)-1]
+		v.push(f.results...)
+
+	case opUnreachable:
+		f := &v.controls[len(v.controls)-1]
+		v.operands = v.operands[:f.height]
+		f.unreachable = true
+
+	case opBrIf:
+		depth, err := r.uleb()
+		if err != nil {
+			return err
+		}
+		if depth >= uint64(len(v.controls)) {
+			return fmt.Errorf("branch depth %d out of range", depth)
+		}
+		if err := v.pop(typeI32); err != nil {
+			return err
+		}
+		target := v.controls[len(v.controls)-1-int(depth)]
+		var labels []byte // A branch to a loop restarts it, with no values
+		if target.op != opLoop {
+			labels = target.results
+		}
+		if err := v.pop(labels...); err != nil {
+			return err
+		}
+		v.push(labels...)
+
+	case opCall:
+		index, err := r.uleb()
+		if err != nil {
+			return err
+		}
+		if index >= uint64(len(m.funcs)) {
+			return fmt.Errorf("function %d out of range", index)
+		}
+		t := m.types[m.funcs[index]]
+		if err := v.pop(t.params...); err != nil {
+			return err
+		}
+		v.push(t.results...)
+
+	case opLocalGet:
+		t, err := v.localType(r)
+		if err != nil {
+			return err
+		}
+		v.push(t)
+
+	case opLocalSet:
+		t, err := v.localType(r)
+		if err != nil {
+			return err
+		}
+		return v.pop(t)
+
+	case opI32Const:
+		if _, err := r.sleb(); err != nil {
+			return err
+		}
+		v.push(typeI32)
+
+	case opI64Const:
+		if _, err := r.sleb(); err != nil {
+			return err
+		}
+		v.push(typeI64)
+
+	default:
+		return fmt.Errorf("unsupported opcode %#x", op)
+	}
+	return nil
+}
@@ -0,0 +1,97 @@
+package wasm
+
+import (
+	"bytes"
+	"encoding/hex"
+	"flag"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"tinycompiler/tiny"
+	"tinycompiler/tiny/tinytest"
+)
+
+var update = flag.Bool("update", false, "rewrite the golden files")
+
+// TestGolden compiles every program in testdata, validates the module and
+// compares a hex dump of it with the matching .golden file
+func TestGolden(t *testing.T) {
+	files, err := filepath.Glob(filepath.Join("testdata", "*.tny"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(files) == 0 {
+		t.Fatal("no test programs")
+	}
+	for _, file := range files {
+		name := strings.TrimSuffix(filepath.Base(file), ".tny")
+		t.Run(name, func(t *testing.T) {
+			src, err := os.ReadFile(file)
+			if err != nil {
+				t.Fatal(err)
+			}
+			module, err := Compile(tinytest.Parse(t, string(src)))
+			if err != nil {
+				t.Fatal(err)
+			}
+			if err := Validate(module); err != nil {
+				t.Fatalf("validate: %v", err)
+			}
+
+			got := hex.Dump(module)
+			golden := strings.TrimSuffix(file, ".tny") + ".golden"
+			if *update {
+				if err := os.WriteFile(golden, []byte(got), 0o644); err != nil {
+					t.Fatal(err)
+				}
+				return
+			}
+			want, err := os.ReadFile(golden)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got != string(want) {
+				t.Errorf("module differs from %s:\ngot:\n%s\nwant:\n%s", golden, got, want)
+			}
+		})
+	}
+}
+
+// TestValidateRejects checks that the validator catches broken modules
+func TestValidateRejects(t *testing.T) {
+	tree := &tiny.TreeNode{
+		NodeKind: tiny.StmtK, StmtKind: tiny.WriteK,
+		Children: [4]*tiny.TreeNode{{NodeKind: tiny.ExpK, ExpKind: tiny.ConstK, Value: 1}},
+	}
+	module, err := Compile(tree)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := Validate(module); err != nil {
+		t.Fatalf("valid module rejected: %v", err)
+	}
+
+	// The body of main is "i64.const 1; call write; end". Calling read
+	// instead leaves an i64 on the stack at the end of the function.
+	i := bytes.Index(module, []byte{opI64Const, 1, opCall, funcWrite, opEnd})
+	if i < 0 {
+		t.Fatal("body of main not found")
+	}
+	bad := bytes.Clone(module)
+	bad[i+3] = funcRead
+	if err := Validate(bad); err == nil {
+		t.Error("unbalanced stack accepted")
+	}
+
+	bad = bytes.Clone(module)
+	bad[i+2] = 0xFF
+	if err := Validate(bad); err == nil {
+		t.Error("unknown opcode accepted")
+	}
+
+	if err := Validate(module[:len(module)-1]); err == nil {
+		t.Error("truncated module accepted")
+	}
+}